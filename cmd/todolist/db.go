@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	sqlitedb "go.altair.com/todolist/pkg/db"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manages the Todolist database schema",
+	Long:  ``,
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Applies all pending schema migrations",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	RunE:  doMigrate,
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Reverts the most recently applied schema migrations",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	RunE:  doRollback,
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Lists the schema migrations and whether they are applied",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	RunE:  doStatus,
+}
+
+var (
+	rollbackSteps int
+)
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(migrateCmd, rollbackCmd, statusCmd)
+	rollbackCmd.Flags().IntVarP(&rollbackSteps, "steps", "n", 1, "number of migrations to roll back")
+}
+
+func doMigrate(cmd *cobra.Command, args []string) error {
+	tododb, err := sqlitedb.Open(dbOptions())
+	if err != nil {
+		return err
+	}
+	defer tododb.Close()
+
+	applied, err := sqlitedb.Migrate(tododb)
+	if err != nil {
+		return err
+	}
+	log.Info().Int("applied", applied).Msg("Migrations applied")
+	return nil
+}
+
+func doRollback(cmd *cobra.Command, args []string) error {
+	if rollbackSteps < 1 {
+		return fmt.Errorf("steps should be at least 1, but got %d", rollbackSteps)
+	}
+
+	tododb, err := sqlitedb.Open(dbOptions())
+	if err != nil {
+		return err
+	}
+	defer tododb.Close()
+
+	reverted, err := sqlitedb.Rollback(tododb, rollbackSteps)
+	if err != nil {
+		return err
+	}
+	log.Info().Int("reverted", reverted).Msg("Migrations rolled back")
+	return nil
+}
+
+func doStatus(cmd *cobra.Command, args []string) error {
+	tododb, err := sqlitedb.Open(dbOptions())
+	if err != nil {
+		return err
+	}
+	defer tododb.Close()
+
+	statuses, err := sqlitedb.Status(tododb)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		state, appliedAt := "pending", "-"
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
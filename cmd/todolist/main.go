@@ -3,9 +3,12 @@ package main
 import (
 	"os"
 
+	sqlitedb "go.altair.com/todolist/pkg/db"
+
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var rootCmd = &cobra.Command{
@@ -17,15 +20,45 @@ var rootCmd = &cobra.Command{
 }
 
 var (
-	debug bool
+	debug    bool
+	dbDriver string
+	dbDSN    string
 )
 
 const (
-	description = "todolist server"
+	description    = "todolist server"
+	dbEnvVar       = "TODOLIST_DB"
+	dbDriverEnvVar = "TODOLIST_DB_DRIVER"
 )
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "enable debug logging")
+	rootCmd.PersistentFlags().StringVar(&dbDriver, "driver", envOrDefault(dbDriverEnvVar, sqlitedb.DriverSQLite),
+		"database driver, "+sqlitedb.DriverSQLite+" or "+sqlitedb.DriverPostgres+" (env "+dbDriverEnvVar+")")
+	rootCmd.PersistentFlags().StringVar(&dbDSN, "db", os.Getenv(dbEnvVar),
+		"database DSN, alias --dsn; for SQLite a file path, "+sqlitedb.MemoryDSN+" or full DSN (env "+dbEnvVar+", defaults to todolist.db next to the executable)")
+	rootCmd.SetGlobalNormalizationFunc(normalizeFlagName)
+}
+
+func normalizeFlagName(f *pflag.FlagSet, name string) pflag.NormalizedName {
+	if name == "dsn" {
+		name = "db"
+	}
+	return pflag.NormalizedName(name)
+}
+
+func envOrDefault(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func dbOptions() sqlitedb.Options {
+	return sqlitedb.Options{
+		Driver: dbDriver,
+		DSN:    dbDSN,
+	}
 }
 
 func doPersistentPreRun(cmd *cobra.Command, args []string) {
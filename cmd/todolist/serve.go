@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"go.altair.com/todolist/pkg/auth"
 	sqlitedb "go.altair.com/todolist/pkg/db"
 	"go.altair.com/todolist/pkg/todolist"
 	"go.altair.com/todolist/pkg/todolist/store"
@@ -22,34 +23,100 @@ var serveCmd = &cobra.Command{
 }
 
 var (
-	bindAddress string
+	bindAddress      string
+	ephemeral        bool
+	rankStrategy     string
+	completionPolicy string
+	userHeader       string
+	trashRetention   time.Duration
+	attachmentsDir   string
+	attachmentSize   int64
+	attachmentQuota  int64
 )
 
 func init() {
 	rootCmd.AddCommand(serveCmd)
 	serveCmd.Flags().StringVarP(&bindAddress, "bind", "b", "0.0.0.0:8080", "set the bind address for the server")
+	serveCmd.Flags().BoolVar(&ephemeral, "ephemeral", false, "keep all data in memory, it is lost when the server stops")
+	serveCmd.Flags().StringVar(&rankStrategy, "rank-strategy", string(store.DenseRanking),
+		"how item positions are stored, "+string(store.DenseRanking)+" or "+string(store.LexoRanking)+" (a move writes a single row)")
+	serveCmd.Flags().StringVar(&completionPolicy, "completion-policy", string(store.KeepPlace),
+		"where completed items go, "+string(store.KeepPlace)+" (their place), "+string(store.SinkToBottom)+
+			" (below the open items) or "+string(store.LeaveSequence)+" (out of the order)")
+	serveCmd.Flags().StringVar(&userHeader, "user-header", "",
+		"header an authenticating reverse proxy sets to the user name, e.g. X-Forwarded-User; without it all requests share the anonymous user's data")
+	serveCmd.Flags().DurationVar(&trashRetention, "trash-retention", 30*24*time.Hour,
+		"how long deleted items stay in the trash before they are purged, 0 keeps them forever")
+	serveCmd.Flags().StringVar(&attachmentsDir, "attachments-dir", "",
+		"directory the files attached to items are kept in; without it items have no attachments")
+	serveCmd.Flags().Int64Var(&attachmentSize, "attachment-max-size", 10<<20, "largest file that can be attached to an item, in bytes")
+	serveCmd.Flags().Int64Var(&attachmentQuota, "attachment-quota", 100<<20, "total size of the files a user can attach, in bytes")
 }
 
 func newRouter() *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(chimw.Recoverer)
 	router.Use(chimw.Timeout(60 * time.Second))
+	if userHeader != "" {
+		router.Use(auth.Header(userHeader))
+	}
 	return router
 }
 
+func newStore() (store.Store, error) {
+	policy, err := store.ParseCompletionPolicy(completionPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	if ephemeral {
+		log.Warn().Msg("Using an ephemeral in-memory store, all data is lost when the server stops")
+		return store.NewMemoryStore(store.WithCompletionPolicy(policy)), nil
+	}
+
+	strategy, err := store.ParseRankStrategy(rankStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	tododb, err := sqlitedb.CreateDb(dbOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.PrepareRanks(tododb, strategy)
+	if err != nil {
+		return nil, err
+	}
+	return store.NewSqlStore(tododb, store.WithRankStrategy(strategy), store.WithCompletionPolicy(policy)), nil
+}
+
 func doServe(cmd *cobra.Command, args []string) error {
 	log.Info().Msg(description + " starting")
 
-	tododb, err := sqlitedb.CreateDb()
+	todostore, err := newStore()
 	if err != nil {
 		return err
 	}
 
-	todostore := store.NewSqlStore(tododb)
+	if trashRetention > 0 {
+		go store.PurgeTrashEvery(cmd.Context(), todostore, trashRetention, time.Hour)
+	}
+
 	todoService := todolist.NewItemsService(todostore)
 
 	handler := &todolist.ItemsHandlers{
 		ItemsService: todoService,
+		ListsService: todolist.NewListsService(todostore),
+	}
+
+	if attachmentsDir != "" {
+		blobs, err := store.NewBlobs(attachmentsDir)
+		if err != nil {
+			return err
+		}
+		handler.AttachmentsService = todolist.NewAttachmentsService(todostore, blobs, attachmentSize, attachmentQuota)
+		go store.CollectBlobsEvery(cmd.Context(), todostore, blobs, time.Hour, time.Hour)
 	}
 
 	router := newRouter()
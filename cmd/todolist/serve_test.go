@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	_ "github.com/jackc/pgx/v4/stdlib"
 	. "github.com/onsi/ginkgo/v2"
@@ -27,6 +29,12 @@ func TestTodoServe(t *testing.T) {
 }
 
 func testRequest(ts *httptest.Server, method, path string, requestBody interface{}, decodedRespBody interface{}) *http.Response {
+	return testRequestAs(ts, "", method, path, requestBody, decodedRespBody)
+}
+
+// testRequestAs makes the request on behalf of user, through the header an
+// authenticating proxy would set. No header is sent for an empty user.
+func testRequestAs(ts *httptest.Server, user, method, path string, requestBody interface{}, decodedRespBody interface{}) *http.Response {
 
 	var body io.Reader
 	if requestBody != nil {
@@ -37,6 +45,9 @@ func testRequest(ts *httptest.Server, method, path string, requestBody interface
 
 	req, err := http.NewRequest(method, ts.URL+path, body)
 	Expect(err).NotTo(HaveOccurred())
+	if user != "" {
+		req.Header.Set("X-Forwarded-User", user)
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	Expect(err).NotTo(HaveOccurred())
@@ -54,12 +65,17 @@ var _ = Describe("Todo Serve tests", func() {
 	Context("When serving", Ordered, func() {
 		var ts *httptest.Server
 		BeforeAll(func() {
-			tododb, err := sqlitedb.CreateDb()
+			tododb, err := sqlitedb.CreateDb(sqlitedb.Options{DSN: sqlitedb.MemoryDSN})
 			Expect(err).NotTo(HaveOccurred())
 			todostore := store.NewSqlStore(tododb)
 			todoService := todolist.NewItemsService(todostore)
+			blobs, err := store.NewBlobs(GinkgoT().TempDir())
+			Expect(err).NotTo(HaveOccurred())
 			handler := &todolist.ItemsHandlers{
 				ItemsService: todoService,
+				ListsService: todolist.NewListsService(todostore),
+				// small enough to run into
+				AttachmentsService: todolist.NewAttachmentsService(todostore, blobs, 16, 32),
 			}
 			router := newRouter()
 			handler.ConfigureRoutes(router)
@@ -80,13 +96,14 @@ var _ = Describe("Todo Serve tests", func() {
 		Context("When todo item created", func() {
 			var item structs.TodoItem
 			BeforeEach(func() {
-				item = structs.TodoItem{Id: "7efc0335-8da6-45f7-a9b6-d4a46ba3044b", Item: "Service motorbike", Order: 1}
+				item = structs.TodoItem{Id: "7efc0335-8da6-45f7-a9b6-d4a46ba3044b", ListId: store.DefaultListId, Item: "Service motorbike", Order: 1}
+				// along with its version and creation time
 				resp := testRequest(
 					ts,
 					"POST",
 					"/todolist",
 					&item,
-					nil)
+					&item)
 				Expect(resp.StatusCode).To(Equal(202))
 			})
 
@@ -97,7 +114,7 @@ var _ = Describe("Todo Serve tests", func() {
 					"/todolist/7efc0335-8da6-45f7-a9b6-d4a46ba3044b",
 					nil,
 					nil)
-				Expect(resp.StatusCode).To(Equal(204))
+				Expect(resp.StatusCode).To(Equal(200))
 			})
 
 			Specify("Item is returned from get", func() {
@@ -123,7 +140,7 @@ var _ = Describe("Todo Serve tests", func() {
 			Context("When todo item modified", func() {
 				var updatedItem structs.TodoItem
 				BeforeEach(func() {
-					updatedItem = structs.TodoItem{Id: "7efc0335-8da6-45f7-a9b6-d4a46ba3044b", Item: "Service motorbike and book MOT"}
+					updatedItem = structs.TodoItem{Id: "7efc0335-8da6-45f7-a9b6-d4a46ba3044b", ListId: store.DefaultListId, Item: "Service motorbike and book MOT"}
 					resp := testRequest(ts, "PUT", "/todolist/7efc0335-8da6-45f7-a9b6-d4a46ba3044b", updatedItem, nil)
 					Expect(resp.StatusCode).To(Equal(202))
 				})
@@ -138,6 +155,11 @@ var _ = Describe("Todo Serve tests", func() {
 						&gItem)
 
 					Expect(resp.StatusCode).To(Equal(200))
+					Expect(gItem.Version).To(Equal(item.Version + 1))
+					Expect(gItem.CreatedAt).To(Equal(item.CreatedAt))
+					Expect(gItem.Order).To(Equal(item.Order), "without an order the item stays where it is")
+					updatedItem.Order = item.Order
+					updatedItem.Version, updatedItem.CreatedAt, updatedItem.UpdatedAt = gItem.Version, gItem.CreatedAt, gItem.UpdatedAt
 					Expect(gItem).To(Equal(updatedItem))
 					Expect(gItem).NotTo(Equal(item))
 				})
@@ -146,13 +168,13 @@ var _ = Describe("Todo Serve tests", func() {
 			Context("When second todo item created", func() {
 				var secondItem structs.TodoItem
 				BeforeEach(func() {
-					secondItem = structs.TodoItem{Id: "dac2581f-9c76-47aa-877e-6c15ddcfb064", Item: "Book holiday", Order: 2}
+					secondItem = structs.TodoItem{Id: "dac2581f-9c76-47aa-877e-6c15ddcfb064", ListId: store.DefaultListId, Item: "Book holiday", Order: 2}
 					resp := testRequest(
 						ts,
 						"POST",
 						"/todolist",
 						&secondItem,
-						nil)
+						&secondItem)
 					Expect(resp.StatusCode).To(Equal(202))
 				})
 
@@ -163,7 +185,7 @@ var _ = Describe("Todo Serve tests", func() {
 						"/todolist/dac2581f-9c76-47aa-877e-6c15ddcfb064",
 						nil,
 						nil)
-					Expect(resp.StatusCode).To(Equal(204))
+					Expect(resp.StatusCode).To(Equal(200))
 				})
 
 				Specify("Item is returned from get", func() {
@@ -187,5 +209,858 @@ var _ = Describe("Todo Serve tests", func() {
 				})
 			})
 		})
+
+		Context("When an item in the middle is deleted", func() {
+			BeforeEach(func() {
+				for i, name := range []string{"Wash car", "Fix bike", "Book holiday"} {
+					resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: name, Order: i + 1}, nil)
+					Expect(resp.StatusCode).To(Equal(202))
+				}
+			})
+
+			AfterEach(func() {
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				for _, item := range items.Items {
+					resp := testRequest(ts, "DELETE", "/todolist/"+item.Id, nil, nil)
+					Expect(resp.StatusCode).To(Equal(200))
+				}
+			})
+
+			Specify("The gap is closed and the shifted items are returned", func() {
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				var middle structs.TodoItem
+				for _, item := range items.Items {
+					if item.Order == 2 {
+						middle = item
+					}
+				}
+
+				var shifted structs.TodoItemList
+				resp := testRequest(ts, "DELETE", "/todolist/"+middle.Id, nil, &shifted)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(shifted.Count).To(Equal(1))
+				Expect(shifted.Items[0].Item).To(Equal("Book holiday"))
+				Expect(shifted.Items[0].Order).To(Equal(2))
+
+				resp = testRequest(ts, "GET", "/todolist", nil, &items)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(items.Count).To(Equal(2))
+				Expect(items.Items).To(ContainElement(shifted.Items[0]))
+
+				// the next item goes right after the last one
+				resp = testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Service motorbike", Order: 3}, nil)
+				Expect(resp.StatusCode).To(Equal(202))
+			})
+		})
+
+		Context("When items are created without an order or in between", func() {
+			AfterEach(func() {
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				for _, item := range items.Items {
+					resp := testRequest(ts, "DELETE", "/todolist/"+item.Id, nil, nil)
+					Expect(resp.StatusCode).To(Equal(200))
+				}
+			})
+
+			Specify("Items are appended by default and inserted at the given order", func() {
+				var created structs.TodoItem
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Wash car"}, &created)
+				Expect(resp.StatusCode).To(Equal(202))
+				Expect(created.Id).NotTo(BeEmpty())
+				Expect(created.Order).To(Equal(1))
+
+				resp = testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Book holiday"}, &created)
+				Expect(resp.StatusCode).To(Equal(202))
+				Expect(created.Order).To(Equal(2))
+
+				resp = testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Fix bike", Order: 1}, &created)
+				Expect(resp.StatusCode).To(Equal(202))
+				Expect(created.Order).To(Equal(1))
+
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				orders := map[string]int{}
+				for _, item := range items.Items {
+					orders[item.Item] = item.Order
+				}
+				Expect(orders).To(Equal(map[string]int{"Fix bike": 1, "Wash car": 2, "Book holiday": 3}))
+			})
+
+			Specify("Orders past the end are rejected", func() {
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Wash car", Order: 2}, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+			})
+		})
+
+		Context("When an item is tracked", func() {
+			var item structs.TodoItem
+			BeforeEach(func() {
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Pay bills"}, &item)
+				Expect(resp.StatusCode).To(Equal(202))
+			})
+
+			AfterEach(func() {
+				resp := testRequest(ts, "DELETE", "/todolist/"+item.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(200))
+			})
+
+			Specify("Items are completed and opened again", func() {
+				var completed structs.TodoItem
+				resp := testRequest(ts, "POST", "/todolist/"+item.Id+"/complete", nil, &completed)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(completed.Done).To(BeTrue())
+				Expect(completed.CompletedAt).NotTo(BeNil())
+				Expect(completed.Order).To(Equal(item.Order))
+
+				var got structs.TodoItem
+				testRequest(ts, "GET", "/todolist/"+item.Id, nil, &got)
+				Expect(got.Done).To(BeTrue())
+
+				var opened structs.TodoItem
+				resp = testRequest(ts, "POST", "/todolist/"+item.Id+"/uncomplete", nil, &opened)
+				Expect(resp.StatusCode).To(Equal(200))
+				// completing the item and opening it again were two writes to it
+				Expect(opened.Version).To(Equal(item.Version + 2))
+				opened.Version, opened.UpdatedAt = item.Version, item.UpdatedAt
+				Expect(opened).To(Equal(item))
+			})
+
+			Specify("Due dates are rendered in the requested time zone", func() {
+				due := time.Date(2024, 7, 1, 9, 30, 0, 0, time.UTC)
+				var created structs.TodoItem
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Renew passport", DueAt: &due}, &created)
+				Expect(resp.StatusCode).To(Equal(202))
+				defer testRequest(ts, "DELETE", "/todolist/"+created.Id, nil, nil)
+
+				var body map[string]interface{}
+				resp = testRequest(ts, "GET", "/todolist/"+created.Id+"?tz=Europe/Athens", nil, &body)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(body["dueAt"]).To(Equal("2024-07-01T12:30:00+03:00"))
+
+				req, err := http.NewRequest("GET", ts.URL+"/todolist/"+created.Id, nil)
+				Expect(err).NotTo(HaveOccurred())
+				req.Header.Set("Time-Zone", "America/New_York")
+				resp, err = http.DefaultClient.Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+				resp.Body.Close()
+				Expect(body["dueAt"]).To(Equal("2024-07-01T05:30:00-04:00"))
+
+				resp = testRequest(ts, "GET", "/todolist/"+created.Id+"?tz=Local", nil, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+			})
+
+			Specify("Items are queried by due date", func() {
+				due := time.Date(2024, 7, 1, 21, 30, 0, 0, time.UTC)
+				var created structs.TodoItem
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Renew passport", DueAt: &due}, &created)
+				Expect(resp.StatusCode).To(Equal(202))
+				defer testRequest(ts, "DELETE", "/todolist/"+created.Id, nil, nil)
+
+				var items structs.TodoItemList
+				resp = testRequest(ts, "GET", "/todolist?overdue=true", nil, &items)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(items.Count).To(Equal(1))
+				Expect(items.Items[0].Id).To(Equal(created.Id))
+
+				// it is already July 2nd in Athens
+				resp = testRequest(ts, "GET", "/todolist?due_before=2024-07-02", nil, &items)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(items.Count).To(Equal(1))
+				resp = testRequest(ts, "GET", "/todolist?due_before=2024-07-02&tz=Europe/Athens", nil, &items)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(items.Count).To(Equal(0))
+
+				resp = testRequest(ts, "GET", "/todolist?due_before=tomorrow", nil, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+			})
+
+			Specify("Items are tagged and filtered by tag and priority", func() {
+				var tagged structs.TodoItem
+				resp := testRequest(ts, "PUT", "/todolist/"+item.Id+"/tags/Home", nil, &tagged)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(tagged.Tags).To(Equal([]string{"home"}))
+
+				var urgent structs.TodoItem
+				resp = testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Call plumber", Priority: structs.PriorityHigh}, &urgent)
+				Expect(resp.StatusCode).To(Equal(202))
+				defer testRequest(ts, "DELETE", "/todolist/"+urgent.Id, nil, nil)
+				resp = testRequest(ts, "PUT", "/todolist/"+urgent.Id+"/tags/home", nil, nil)
+				Expect(resp.StatusCode).To(Equal(200))
+
+				var tags structs.Tags
+				resp = testRequest(ts, "GET", "/tags", nil, &tags)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(tags.Items).To(Equal([]structs.Tag{{Name: "home", Count: 2}}))
+
+				var items structs.TodoItemList
+				resp = testRequest(ts, "GET", "/todolist?tag=home&priority=high", nil, &items)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(items.Count).To(Equal(1))
+				Expect(items.Items[0].Id).To(Equal(urgent.Id))
+
+				var untagged structs.TodoItem
+				resp = testRequest(ts, "DELETE", "/todolist/"+item.Id+"/tags/home", nil, &untagged)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(untagged.Version).To(Equal(item.Version + 2))
+				untagged.Version, untagged.UpdatedAt = item.Version, item.UpdatedAt
+				Expect(untagged).To(Equal(item))
+
+				resp = testRequest(ts, "PUT", "/todolist/"+item.Id+"/tags/at%20home", nil, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+				resp = testRequest(ts, "GET", "/todolist?priority=urgent", nil, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+				resp = testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Call plumber", Priority: "urgent"}, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+			})
+
+			Specify("Notes are rendered as sanitized HTML on request", func() {
+				notes := "**Gas** and [water](https://example.com)\n\n<script>alert(1)</script>\n\n[click](javascript:alert(1))"
+				update := structs.TodoItem{Item: item.Item, Notes: notes, Order: item.Order}
+				resp := testRequest(ts, "PUT", "/todolist/"+item.Id, update, nil)
+				Expect(resp.StatusCode).To(Equal(202))
+
+				var got structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/"+item.Id, nil, &got)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(got.Notes).To(Equal(notes))
+				Expect(got.NotesHTML).To(BeEmpty())
+
+				var rendered structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/"+item.Id+"?render=html", nil, &rendered)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(rendered.Notes).To(Equal(notes))
+				Expect(rendered.NotesHTML).To(ContainSubstring("<strong>Gas</strong>"))
+				Expect(rendered.NotesHTML).To(ContainSubstring(`<a href="https://example.com" rel="nofollow">water</a>`))
+				Expect(rendered.NotesHTML).NotTo(ContainSubstring("<script>"))
+				Expect(rendered.NotesHTML).NotTo(ContainSubstring("javascript:"))
+
+				resp = testRequest(ts, "GET", "/todolist/"+item.Id+"?render=pdf", nil, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+			})
+
+			Specify("Writes made with a stale ETag are rejected", func() {
+				// ifMatch makes a request with an If-Match header
+				ifMatch := func(method, path, etag string, requestBody interface{}) *http.Response {
+					var body io.Reader
+					if requestBody != nil {
+						jsonData, err := json.Marshal(requestBody)
+						Expect(err).NotTo(HaveOccurred())
+						body = bytes.NewBuffer(jsonData)
+					}
+					req, err := http.NewRequest(method, ts.URL+path, body)
+					Expect(err).NotTo(HaveOccurred())
+					req.Header.Set("If-Match", etag)
+					resp, err := http.DefaultClient.Do(req)
+					Expect(err).NotTo(HaveOccurred())
+					resp.Body.Close()
+					return resp
+				}
+
+				resp := testRequest(ts, "GET", "/todolist/"+item.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(200))
+				stale := resp.Header.Get("ETag")
+				Expect(stale).To(HavePrefix(`"1-`))
+				listed := testRequest(ts, "GET", "/todolist", nil, nil).Header.Get("ETag")
+				Expect(listed).NotTo(BeEmpty())
+
+				// another tab edits the item in the meantime
+				update := structs.TodoItem{Item: "Pay the bills", Order: item.Order}
+				resp = ifMatch("PUT", "/todolist/"+item.Id, stale, update)
+				Expect(resp.StatusCode).To(Equal(202))
+				fresh := resp.Header.Get("ETag")
+				Expect(fresh).To(HavePrefix(`"2-`))
+				Expect(testRequest(ts, "GET", "/todolist", nil, nil).Header.Get("ETag")).NotTo(Equal(listed))
+
+				update.Item = "Pay bills late"
+				resp = ifMatch("PUT", "/todolist/"+item.Id, stale, update)
+				Expect(resp.StatusCode).To(Equal(412))
+				resp = ifMatch("PUT", "/todolist/"+item.Id+"/reorder", stale, structs.ReorderRequest{Order: 1})
+				Expect(resp.StatusCode).To(Equal(412))
+				resp = ifMatch("DELETE", "/todolist/"+item.Id, stale, nil)
+				Expect(resp.StatusCode).To(Equal(412))
+				resp = ifMatch("DELETE", "/todolist/"+item.Id, `W/"2"`, nil)
+				Expect(resp.StatusCode).To(Equal(412))
+
+				var got structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/"+item.Id, nil, &got)
+				Expect(resp.Header.Get("ETag")).To(Equal(fresh))
+				Expect(got.Item).To(Equal("Pay the bills"))
+				Expect(got.Version).To(Equal(2))
+
+				resp = ifMatch("PUT", "/todolist/"+item.Id+"/reorder", `"1", `+fresh, structs.ReorderRequest{Order: 1})
+				Expect(resp.StatusCode).To(Equal(202))
+				Expect(resp.Header.Get("ETag")).To(HavePrefix(`"3-`))
+				resp = ifMatch("PUT", "/todolist/"+item.Id, "*", update)
+				Expect(resp.StatusCode).To(Equal(202))
+			})
+
+			Specify("Items are patched field by field", func() {
+				var plants structs.TodoItem
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Water plants", Notes: "the ferns"}, &plants)
+				Expect(resp.StatusCode).To(Equal(202))
+				defer testRequest(ts, "DELETE", "/todolist/"+plants.Id, nil, nil)
+
+				var patched structs.TodoItem
+				resp = testRequest(ts, "PATCH", "/todolist/"+plants.Id, map[string]interface{}{"priority": "high", "notes": nil}, &patched)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(patched.Item).To(Equal("Water plants"))
+				Expect(patched.Priority).To(Equal(structs.PriorityHigh))
+				Expect(patched.Notes).To(BeEmpty())
+				Expect(patched.Order).To(Equal(plants.Order))
+				Expect(resp.Header.Get("ETag")).To(HavePrefix(`"2-`))
+
+				var moved structs.TodoItem
+				resp = testRequest(ts, "PATCH", "/todolist/"+plants.Id, map[string]interface{}{"order": item.Order, "item": "Water the plants"}, &moved)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(moved.Order).To(Equal(item.Order))
+				Expect(moved.Item).To(Equal("Water the plants"))
+				Expect(moved.Version).To(Equal(patched.Version+1), "a patch is a single write")
+				Expect(moved.Priority).To(Equal(structs.PriorityHigh))
+				var shifted structs.TodoItem
+				testRequest(ts, "GET", "/todolist/"+item.Id, nil, &shifted)
+				Expect(shifted.Order).To(Equal(item.Order + 1))
+
+				// the patched item is validated, and only some fields are patched
+				for _, patch := range []interface{}{
+					map[string]interface{}{"item": nil},
+					map[string]interface{}{"priority": "urgent"},
+					map[string]interface{}{"recurrence": "FREQ=DAILY"},
+					map[string]interface{}{"done": true},
+					map[string]interface{}{"order": 50},
+					[]string{"item"},
+				} {
+					resp = testRequest(ts, "PATCH", "/todolist/"+plants.Id, patch, nil)
+					Expect(resp.StatusCode).To(Equal(400))
+				}
+				// the same goes for the order of an item put as a whole
+				resp = testRequest(ts, "PUT", "/todolist/"+plants.Id, structs.TodoItem{Item: "Water the plants", Order: 50}, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+				var unchanged structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/"+plants.Id, nil, &unchanged)
+				Expect(unchanged.Version).To(Equal(moved.Version))
+				Expect(testRequest(ts, "PATCH", "/todolist/"+plants.Id, map[string]interface{}{}, nil).Header.Get("ETag")).To(Equal(resp.Header.Get("ETag")))
+			})
+
+			Specify("Items get sub-tasks, which are indented, outdented and listed as a tree", func() {
+				var electricity, water structs.TodoItem
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Electricity", ParentId: item.Id}, &electricity)
+				Expect(resp.StatusCode).To(Equal(202))
+				Expect(electricity.Order).To(Equal(1))
+				resp = testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Water"}, &water)
+				Expect(resp.StatusCode).To(Equal(202))
+				defer testRequest(ts, "DELETE", "/todolist/"+water.Id, nil, nil)
+				Expect(water.Order).To(Equal(item.Order + 1))
+
+				var indented structs.TodoItem
+				resp = testRequest(ts, "PUT", "/todolist/"+water.Id+"/indent", nil, &indented)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(indented.ParentId).To(Equal(item.Id))
+				Expect(indented.Order).To(Equal(2))
+
+				var tree structs.TodoItemTree
+				resp = testRequest(ts, "GET", "/todolist?tree=true", nil, &tree)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(tree.Count).To(Equal(3))
+				Expect(tree.Items).To(HaveLen(1))
+				Expect(tree.Items[0].Id).To(Equal(item.Id))
+				Expect(tree.Items[0].Subtasks).To(HaveLen(2))
+				Expect(tree.Items[0].Subtasks[0].Id).To(Equal(electricity.Id))
+				Expect(tree.Items[0].Subtasks[1].Id).To(Equal(water.Id))
+
+				// an item cannot be moved under its own sub-tasks
+				resp = testRequest(ts, "PUT", "/todolist/"+item.Id+"/parent", structs.ParentRequest{ParentId: electricity.Id}, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+				resp = testRequest(ts, "PUT", "/todolist/"+electricity.Id+"/indent", nil, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+
+				var outdented structs.TodoItem
+				resp = testRequest(ts, "PUT", "/todolist/"+water.Id+"/outdent", nil, &outdented)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(outdented.ParentId).To(BeEmpty())
+				Expect(outdented.Order).To(Equal(item.Order + 1))
+				resp = testRequest(ts, "PUT", "/todolist/"+water.Id+"/outdent", nil, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+
+				var reparented structs.TodoItem
+				resp = testRequest(ts, "PUT", "/todolist/"+water.Id+"/parent", structs.ParentRequest{ParentId: electricity.Id}, &reparented)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(reparented.ParentId).To(Equal(electricity.Id))
+				Expect(reparented.Order).To(Equal(1))
+			})
+
+			Specify("Deleted items go to the trash and are restored from there", func() {
+				var electricity structs.TodoItem
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Electricity", ParentId: item.Id}, &electricity)
+				Expect(resp.StatusCode).To(Equal(202))
+
+				resp = testRequest(ts, "DELETE", "/todolist/"+item.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(200))
+				resp = testRequest(ts, "GET", "/todolist/"+item.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(404))
+				resp = testRequest(ts, "GET", "/todolist/"+electricity.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(404))
+
+				// the sub-task is in the trash with its item, not on its own
+				var trash structs.TodoItemList
+				resp = testRequest(ts, "GET", "/trash", nil, &trash)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(trash.Items).NotTo(BeEmpty())
+				Expect(trash.Items[0].Id).To(Equal(item.Id))
+				Expect(trash.Items[0].DeletedAt).NotTo(BeNil())
+				Expect(trash.Items[0].Order).To(Equal(item.Order))
+				for _, trashed := range trash.Items {
+					Expect(trashed.Id).NotTo(Equal(electricity.Id))
+				}
+
+				resp = testRequest(ts, "POST", "/trash/"+item.Id+"/restore", structs.RestoreRequest{Order: -1}, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+
+				var restored structs.TodoItem
+				resp = testRequest(ts, "POST", "/trash/"+item.Id+"/restore", nil, &restored)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(restored.Order).To(Equal(item.Order))
+				Expect(restored.DeletedAt).To(BeNil())
+				Expect(resp.Header.Get("ETag")).To(HavePrefix(`"3-`))
+				resp = testRequest(ts, "GET", "/todolist/"+electricity.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(200))
+
+				resp = testRequest(ts, "POST", "/trash/"+item.Id+"/restore", nil, nil)
+				Expect(resp.StatusCode).To(Equal(404))
+			})
+
+			Specify("Completing a recurring item adds its next occurrence", func() {
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Water plants", Recurrence: "FREQ=DAILY"}, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+				due := time.Date(2099, 7, 1, 13, 0, 0, 0, time.UTC)
+				resp = testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Water plants", DueAt: &due, Recurrence: "FREQ=HOURLY"}, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+
+				// the rule is worked out in the zone of the request
+				var plants structs.TodoItem
+				resp = testRequest(ts, "POST", "/todolist?tz=America/New_York", structs.TodoItem{Item: "Water plants", DueAt: &due, Recurrence: "FREQ=DAILY;COUNT=2"}, &plants)
+				Expect(resp.StatusCode).To(Equal(202))
+				defer testRequest(ts, "DELETE", "/todolist/"+plants.Id, nil, nil)
+				Expect(plants.TimeZone).To(Equal("America/New_York"))
+
+				var completed structs.TodoItem
+				resp = testRequest(ts, "POST", "/todolist/"+plants.Id+"/complete", nil, &completed)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(completed.NextId).NotTo(BeEmpty())
+				defer testRequest(ts, "DELETE", "/todolist/"+completed.NextId, nil, nil)
+
+				var body map[string]interface{}
+				resp = testRequest(ts, "GET", "/todolist/"+completed.NextId+"?tz=America/New_York", nil, &body)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(body["dueAt"]).To(Equal("2099-07-02T09:00:00-04:00"))
+				Expect(body["recurrence"]).To(Equal("FREQ=DAILY;COUNT=1"))
+				Expect(body["done"]).To(BeFalse())
+
+				// the last occurrence has no next one
+				var last structs.TodoItem
+				resp = testRequest(ts, "POST", "/todolist/"+completed.NextId+"/complete", nil, &last)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(last.NextId).To(BeEmpty())
+			})
+
+			Specify("Files are attached, downloaded in ranges and deleted", func() {
+				attach := func(name, content string) *http.Response {
+					var body bytes.Buffer
+					form := multipart.NewWriter(&body)
+					file, err := form.CreateFormFile("file", name)
+					Expect(err).NotTo(HaveOccurred())
+					_, err = file.Write([]byte(content))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(form.Close()).To(Succeed())
+					resp, err := http.Post(ts.URL+"/todolist/"+item.Id+"/attachments", form.FormDataContentType(), &body)
+					Expect(err).NotTo(HaveOccurred())
+					return resp
+				}
+
+				resp := attach("bill.txt", "Gas: 42.00 EUR")
+				Expect(resp.StatusCode).To(Equal(202))
+				var bill structs.Attachment
+				Expect(json.NewDecoder(resp.Body).Decode(&bill)).To(Succeed())
+				resp.Body.Close()
+				Expect(bill.Name).To(Equal("bill.txt"))
+				Expect(bill.ContentType).To(HavePrefix("text/plain"))
+				Expect(bill.Size).To(Equal(int64(14)))
+
+				var attachments structs.Attachments
+				resp = testRequest(ts, "GET", "/todolist/"+item.Id+"/attachments", nil, &attachments)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(attachments.Items).To(ConsistOf(bill))
+
+				req, err := http.NewRequest("GET", ts.URL+"/todolist/"+item.Id+"/attachments/"+bill.Id, nil)
+				Expect(err).NotTo(HaveOccurred())
+				req.Header.Set("Range", "bytes=5-9")
+				resp, err = http.DefaultClient.Do(req)
+				Expect(err).NotTo(HaveOccurred())
+				content, err := io.ReadAll(resp.Body)
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(206))
+				Expect(string(content)).To(Equal("42.00"))
+				Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/plain"))
+				Expect(resp.Header.Get("Content-Disposition")).To(Equal(`attachment; filename=bill.txt`))
+
+				// over the size limit, and then over the quota
+				resp = attach("big.txt", "more than sixteen bytes")
+				Expect(resp.StatusCode).To(Equal(413))
+				resp = attach("copy.txt", "Gas: 42.00 EUR")
+				Expect(resp.StatusCode).To(Equal(202))
+				resp = attach("third.txt", "Gas: 42.00 EUR")
+				Expect(resp.StatusCode).To(Equal(413))
+
+				resp = testRequest(ts, "DELETE", "/todolist/"+item.Id+"/attachments/"+bill.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(200))
+				resp = testRequest(ts, "GET", "/todolist/"+item.Id+"/attachments/"+bill.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(404))
+				resp = testRequest(ts, "GET", "/lists/"+store.DefaultListId+"/items/"+item.Id+"/attachments", nil, &attachments)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(attachments.Count).To(Equal(1))
+				resp = testRequest(ts, "GET", "/todolist/5b0e5a4e-3c0f-4f52-9a53-0c6f2f6c1d2e/attachments", nil, nil)
+				Expect(resp.StatusCode).To(Equal(404))
+			})
+
+			Specify("Items wait for their blockers and are sorted after them", func() {
+				var meter structs.TodoItem
+				resp := testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Read the meter"}, &meter)
+				Expect(resp.StatusCode).To(Equal(202))
+				defer testRequest(ts, "DELETE", "/todolist/"+meter.Id, nil, nil)
+
+				var blocked structs.TodoItem
+				resp = testRequest(ts, "PUT", "/todolist/"+item.Id+"/blockers/"+meter.Id, nil, &blocked)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(blocked.Blocked).To(BeTrue())
+				Expect(blocked.BlockedBy).To(Equal([]string{meter.Id}))
+				Expect(resp.Header.Get("ETag")).To(HavePrefix(`"2-`))
+
+				resp = testRequest(ts, "PUT", "/todolist/"+meter.Id+"/blockers/"+item.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+
+				var sorted structs.TodoItemList
+				resp = testRequest(ts, "POST", "/todolist/topological-sort", nil, &sorted)
+				Expect(resp.StatusCode).To(Equal(200))
+				orders := map[string]int{}
+				for _, listed := range sorted.Items {
+					orders[listed.Id] = listed.Order
+				}
+				Expect(orders[meter.Id]).To(BeNumerically("<", orders[item.Id]))
+
+				var unblocked structs.TodoItem
+				resp = testRequest(ts, "DELETE", "/todolist/"+item.Id+"/blockers/"+meter.Id, nil, &unblocked)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(unblocked.Blocked).To(BeFalse())
+				Expect(unblocked.BlockedBy).To(BeEmpty())
+			})
+
+			Specify("Unknown items cannot be completed", func() {
+				resp := testRequest(ts, "POST", "/todolist/5b0e5a4e-3c0f-4f52-9a53-0c6f2f6c1d2e/complete", nil, nil)
+				Expect(resp.StatusCode).To(Equal(404))
+			})
+		})
+
+		Context("When items are kept in several lists", func() {
+			var groceries structs.List
+			BeforeEach(func() {
+				resp := testRequest(ts, "POST", "/lists", structs.List{Name: "Groceries"}, &groceries)
+				Expect(resp.StatusCode).To(Equal(202))
+				Expect(groceries.Order).To(Equal(2))
+			})
+
+			AfterEach(func() {
+				resp := testRequest(ts, "DELETE", "/lists/"+groceries.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(200))
+
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				for _, item := range items.Items {
+					resp := testRequest(ts, "DELETE", "/todolist/"+item.Id, nil, nil)
+					Expect(resp.StatusCode).To(Equal(200))
+				}
+			})
+
+			Specify("Every list has its own items and ordering", func() {
+				var milk, chores structs.TodoItem
+				resp := testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Milk"}, &milk)
+				Expect(resp.StatusCode).To(Equal(202))
+				Expect(milk.ListId).To(Equal(groceries.Id))
+				Expect(milk.Order).To(Equal(1))
+				resp = testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Chores"}, &chores)
+				Expect(resp.StatusCode).To(Equal(202))
+				Expect(chores.Order).To(Equal(1))
+
+				var items structs.TodoItemList
+				resp = testRequest(ts, "GET", "/lists/"+groceries.Id+"/items", nil, &items)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(items.Items).To(Equal([]structs.TodoItem{milk}))
+
+				// items are only reachable through their own list
+				resp = testRequest(ts, "GET", "/todolist/"+milk.Id, nil, nil)
+				Expect(resp.StatusCode).To(Equal(404))
+
+				var lists structs.Lists
+				resp = testRequest(ts, "GET", "/lists", nil, &lists)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(lists.Count).To(Equal(2))
+				Expect(lists.Items[1]).To(Equal(groceries))
+			})
+
+			Specify("Items move between lists", func() {
+				var milk structs.TodoItem
+				testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Milk"}, &milk)
+				testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Bread"}, nil)
+				testRequest(ts, "POST", "/todolist", structs.TodoItem{Item: "Chores"}, nil)
+
+				resp := testRequest(ts, "PUT", "/lists/"+groceries.Id+"/items/"+milk.Id+"/move",
+					structs.MoveRequest{ListId: store.DefaultListId, Order: 1}, nil)
+				Expect(resp.StatusCode).To(Equal(202))
+
+				var moved structs.TodoItem
+				resp = testRequest(ts, "GET", "/todolist/"+milk.Id, nil, &moved)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(moved.Order).To(Equal(1))
+
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/lists/"+groceries.Id+"/items", nil, &items)
+				Expect(items.Count).To(Equal(1))
+				Expect(items.Items[0].Item).To(Equal("Bread"))
+				Expect(items.Items[0].Order).To(Equal(1))
+			})
+
+			Specify("Items are put in a whole new order at once", func() {
+				var milk, bread, eggs structs.TodoItem
+				testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Milk"}, &milk)
+				testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Bread"}, &bread)
+				testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Eggs"}, &eggs)
+
+				var items structs.TodoItemList
+				resp := testRequest(ts, "PUT", "/lists/"+groceries.Id+"/items/order",
+					structs.OrderRequest{Ids: []string{eggs.Id, milk.Id, bread.Id}}, &items)
+				Expect(resp.StatusCode).To(Equal(200))
+				orders := map[string]int{}
+				for _, listed := range items.Items {
+					orders[listed.Item] = listed.Order
+				}
+				Expect(orders).To(Equal(map[string]int{"Eggs": 1, "Milk": 2, "Bread": 3}))
+
+				// a client that missed an item is told which
+				var conflict structs.OrderConflict
+				resp = testRequest(ts, "PUT", "/lists/"+groceries.Id+"/items/order",
+					structs.OrderRequest{Ids: []string{bread.Id, milk.Id}}, &conflict)
+				Expect(resp.StatusCode).To(Equal(409))
+				Expect(conflict.Missing).To(Equal([]string{eggs.Id}))
+				Expect(conflict.Unexpected).To(BeEmpty())
+
+				resp = testRequest(ts, "PUT", "/lists/"+groceries.Id+"/items/order",
+					structs.OrderRequest{Ids: []string{eggs.Id, eggs.Id, milk.Id, bread.Id}}, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+			})
+
+			Specify("Items are moved relative to each other", func() {
+				var milk, bread, eggs structs.TodoItem
+				testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Milk"}, &milk)
+				testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Bread"}, &bread)
+				testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Eggs"}, &eggs)
+
+				var moved structs.TodoItem
+				resp := testRequest(ts, "POST", "/lists/"+groceries.Id+"/items/"+eggs.Id+"/move", "top", &moved)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(moved.Order).To(Equal(1))
+				Expect(resp.Header.Get("ETag")).To(HavePrefix(`"2-`))
+
+				var after structs.TodoItem
+				resp = testRequest(ts, "POST", "/lists/"+groceries.Id+"/items/"+eggs.Id+"/move", structs.RelativeMove{After: bread.Id}, &after)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(after.Order).To(Equal(3))
+
+				resp = testRequest(ts, "POST", "/lists/"+groceries.Id+"/items/"+eggs.Id+"/move", "sideways", nil)
+				Expect(resp.StatusCode).To(Equal(400))
+				resp = testRequest(ts, "POST", "/lists/"+groceries.Id+"/items/"+eggs.Id+"/move", structs.RelativeMove{SwapWith: eggs.Id}, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+			})
+
+			Specify("Operations are applied in bulk, all of them or none", func() {
+				var milk structs.TodoItem
+				testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: "Milk"}, &milk)
+
+				var response structs.BulkResponse
+				resp := testRequest(ts, "POST", "/todolist/bulk", structs.BulkRequest{Operations: []structs.BulkOperation{
+					{Op: structs.BulkCreate, Item: &structs.TodoItem{Item: "Chores"}},
+					{Op: structs.BulkCreate, Item: &structs.TodoItem{Item: "Laundry", Order: 1}},
+				}}, &response)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(response.Failed).To(BeNil())
+				Expect(response.Results).To(HaveLen(2))
+				Expect(response.Results[0].Status).To(Equal(202))
+				Expect(response.Results[0].Item.Order).To(Equal(1))
+				Expect(response.Results[1].Item.Order).To(Equal(1))
+				chores, laundry := *response.Results[0].Item, *response.Results[1].Item
+
+				// the move to groceries is undone along with the rest
+				var failed structs.BulkResponse
+				resp = testRequest(ts, "POST", "/todolist/bulk", structs.BulkRequest{Operations: []structs.BulkOperation{
+					{Op: structs.BulkMove, Id: chores.Id, ListId: groceries.Id},
+					{Op: structs.BulkUpdate, Id: laundry.Id, Item: &structs.TodoItem{Item: "Laundry and ironing"}},
+					{Op: structs.BulkDelete, Id: milk.Id},
+					{Op: structs.BulkDelete, Id: laundry.Id},
+				}}, &failed)
+				Expect(resp.StatusCode).To(Equal(404))
+				Expect(*failed.Failed).To(Equal(2))
+				Expect(failed.Results[0].Status).To(Equal(424))
+				Expect(failed.Results[2].Status).To(Equal(404))
+				Expect(failed.Results[2].Error).NotTo(BeEmpty())
+				Expect(failed.Results[3].Status).To(Equal(424))
+
+				var items structs.TodoItemList
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				orders := map[string]int{}
+				for _, listed := range items.Items {
+					orders[listed.Id] = listed.Order
+				}
+				Expect(orders).To(Equal(map[string]int{laundry.Id: 1, chores.Id: 2}))
+				var unchanged structs.TodoItem
+				testRequest(ts, "GET", "/todolist/"+laundry.Id, nil, &unchanged)
+				Expect(unchanged).To(Equal(laundry))
+
+				var invalid structs.BulkResponse
+				resp = testRequest(ts, "POST", "/todolist/bulk", structs.BulkRequest{Operations: []structs.BulkOperation{
+					{Op: structs.BulkDelete, Id: laundry.Id},
+					{Op: structs.BulkCreate},
+				}}, &invalid)
+				Expect(resp.StatusCode).To(Equal(400))
+				Expect(*invalid.Failed).To(Equal(1))
+
+				var cleared structs.BulkResponse
+				resp = testRequest(ts, "POST", "/todolist/bulk", structs.BulkRequest{Operations: []structs.BulkOperation{
+					{Op: structs.BulkMove, Id: chores.Id, ListId: groceries.Id, Order: 1},
+					{Op: structs.BulkDelete, Id: laundry.Id},
+				}}, &cleared)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(cleared.Results[0].Item.ListId).To(Equal(groceries.Id))
+				Expect(cleared.Results[1].Item.Id).To(Equal(laundry.Id))
+				testRequest(ts, "GET", "/todolist", nil, &items)
+				Expect(items.Count).To(Equal(0))
+			})
+
+			Specify("Items are listed a page at a time", func() {
+				for _, name := range []string{"Milk", "Bread", "Eggs"} {
+					resp := testRequest(ts, "POST", "/lists/"+groceries.Id+"/items", structs.TodoItem{Item: name}, nil)
+					Expect(resp.StatusCode).To(Equal(202))
+				}
+
+				var first structs.TodoItemList
+				resp := testRequest(ts, "GET", "/lists/"+groceries.Id+"/items?limit=2", nil, &first)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(first.Count).To(Equal(3))
+				Expect(first.Items).To(HaveLen(2))
+				Expect(first.Items[0].Item).To(Equal("Milk"))
+				Expect(first.Prev).To(BeEmpty())
+				Expect(first.Next).NotTo(BeEmpty())
+
+				var second structs.TodoItemTree
+				resp = testRequest(ts, "GET", "/lists/"+groceries.Id+"/items?tree=true&limit=2&cursor="+first.Next, nil, &second)
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(second.Count).To(Equal(3))
+				Expect(second.Items).To(HaveLen(1))
+				Expect(second.Items[0].Item).To(Equal("Eggs"))
+				Expect(second.Next).To(BeEmpty())
+
+				var back structs.TodoItemList
+				testRequest(ts, "GET", "/lists/"+groceries.Id+"/items?limit=2&cursor="+second.Prev, nil, &back)
+				Expect(back.Items).To(Equal(first.Items))
+
+				for _, query := range []string{"limit=-1", "limit=1001", "limit=two", "cursor=nonsense"} {
+					resp = testRequest(ts, "GET", "/lists/"+groceries.Id+"/items?"+query, nil, nil)
+					Expect(resp.StatusCode).To(Equal(400))
+				}
+			})
+
+			Specify("The default list cannot be deleted", func() {
+				resp := testRequest(ts, "DELETE", "/lists/"+store.DefaultListId, nil, nil)
+				Expect(resp.StatusCode).To(Equal(400))
+			})
+		})
+	})
+
+	Context("When users are authenticated by a header", Ordered, func() {
+		var ts *httptest.Server
+		BeforeAll(func() {
+			tododb, err := sqlitedb.CreateDb(sqlitedb.Options{DSN: sqlitedb.MemoryDSN})
+			Expect(err).NotTo(HaveOccurred())
+			todostore := store.NewSqlStore(tododb)
+			handler := &todolist.ItemsHandlers{
+				ItemsService: todolist.NewItemsService(todostore),
+				ListsService: todolist.NewListsService(todostore),
+			}
+			userHeader = "X-Forwarded-User"
+			router := newRouter()
+			handler.ConfigureRoutes(router)
+			ts = httptest.NewServer(router)
+		})
+
+		AfterAll(func() {
+			userHeader = ""
+			ts.Close()
+		})
+
+		Specify("Requests without a user are rejected", func() {
+			resp := testRequest(ts, "GET", "/todolist", nil, nil)
+			Expect(resp.StatusCode).To(Equal(401))
+		})
+
+		Specify("Users only see their own items", func() {
+			var milk structs.TodoItem
+			resp := testRequestAs(ts, "alice", "POST", "/todolist", structs.TodoItem{Item: "Milk"}, &milk)
+			Expect(resp.StatusCode).To(Equal(202))
+			Expect(milk.Order).To(Equal(1))
+
+			// bob has a default list of their own, ordered independently
+			var bread structs.TodoItem
+			resp = testRequestAs(ts, "bob", "POST", "/todolist", structs.TodoItem{Item: "Bread"}, &bread)
+			Expect(resp.StatusCode).To(Equal(202))
+			Expect(bread.Order).To(Equal(1))
+
+			var items structs.TodoItemList
+			resp = testRequestAs(ts, "bob", "GET", "/todolist", nil, &items)
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(items.Items).To(Equal([]structs.TodoItem{bread}))
+
+			// another user's item is not found, whatever is done with it
+			resp = testRequestAs(ts, "bob", "GET", "/todolist/"+milk.Id, nil, nil)
+			Expect(resp.StatusCode).To(Equal(404))
+			resp = testRequestAs(ts, "bob", "PUT", "/todolist/"+milk.Id, structs.TodoItem{Item: "Beer", Order: 1}, nil)
+			Expect(resp.StatusCode).To(Equal(404))
+			resp = testRequestAs(ts, "bob", "PUT", "/todolist/"+milk.Id+"/reorder", structs.ReorderRequest{Order: 1}, nil)
+			Expect(resp.StatusCode).To(Equal(404))
+			resp = testRequestAs(ts, "bob", "DELETE", "/todolist/"+milk.Id, nil, nil)
+			Expect(resp.StatusCode).To(Equal(404))
+
+			var kept structs.TodoItem
+			resp = testRequestAs(ts, "alice", "GET", "/todolist/"+milk.Id, nil, &kept)
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(kept).To(Equal(milk))
+		})
+
+		Specify("Users only see their own lists", func() {
+			var work structs.List
+			resp := testRequestAs(ts, "alice", "POST", "/lists", structs.List{Name: "Work"}, &work)
+			Expect(resp.StatusCode).To(Equal(202))
+
+			resp = testRequestAs(ts, "bob", "GET", "/lists/"+work.Id+"/items", nil, nil)
+			Expect(resp.StatusCode).To(Equal(404))
+			resp = testRequestAs(ts, "bob", "DELETE", "/lists/"+work.Id, nil, nil)
+			Expect(resp.StatusCode).To(Equal(404))
+
+			var lists structs.Lists
+			resp = testRequestAs(ts, "bob", "GET", "/lists", nil, &lists)
+			Expect(resp.StatusCode).To(Equal(200))
+			Expect(lists.Count).To(Equal(1))
+			Expect(lists.Items[0].Id).To(Equal(store.DefaultListId))
+		})
 	})
 })
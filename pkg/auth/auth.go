@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+// Anonymous is the principal of every request when authentication is off. It
+// owns the data created before the service had users.
+const Anonymous = "anonymous"
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated principal.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Principal returns the principal ctx was authenticated as, or Anonymous.
+func Principal(ctx context.Context) string {
+	if principal, ok := ctx.Value(principalKey{}).(string); ok && principal != "" {
+		return principal
+	}
+	return Anonymous
+}
+
+// Header authenticates requests by the user name a trusted reverse proxy puts
+// in the named header, e.g. X-Forwarded-User. Requests without it are
+// rejected, so nobody falls back to the anonymous user's data.
+func Header(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := r.Header.Get(name)
+			if principal == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrincipal(t *testing.T) {
+	assert.Equal(t, Anonymous, Principal(context.Background()))
+	assert.Equal(t, "alice", Principal(WithPrincipal(context.Background(), "alice")))
+}
+
+func TestHeader(t *testing.T) {
+	var principal string
+	handler := Header("X-Forwarded-User")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = Principal(r.Context())
+	}))
+
+	t.Run("Authenticated", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/todolist", nil)
+		req.Header.Set("X-Forwarded-User", "alice")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "alice", principal)
+	})
+
+	t.Run("Missing header", func(t *testing.T) {
+		principal = ""
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/todolist", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Empty(t, principal)
+	})
+}
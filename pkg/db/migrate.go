@@ -0,0 +1,249 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a numbered schema change loaded from
+// migrations/<dialect>/NNNN_name.(up|down).sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".sql") {
+			continue
+		}
+
+		// 0001_create_todolist.up.sql -> "0001_create_todolist", "up"
+		base := strings.TrimSuffix(fileName, ".sql")
+		dot := strings.LastIndex(base, ".")
+		if dot < 0 {
+			return nil, fmt.Errorf("migration %s: missing up/down suffix", fileName)
+		}
+		base, direction := base[:dot], base[dot+1:]
+
+		versionStr, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", fileName, err)
+		}
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
+		}
+
+		switch direction {
+		case "up":
+			m.Up = string(content)
+		case "down":
+			m.Down = string(content)
+		default:
+			return nil, fmt.Errorf("migration %s: unknown direction %q", fileName, direction)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no up script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrations returns the known migrations for a sqlx driver name sorted by version.
+func Migrations(driverName string) ([]Migration, error) {
+	dir, err := dialect(driverName)
+	if err != nil {
+		return nil, err
+	}
+	return loadMigrations(migrationFiles, path.Join("migrations", dir))
+}
+
+func ensureMigrationsTable(db *sqlx.DB) error {
+	_, err := db.Exec(`
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER NOT NULL PRIMARY KEY,
+    name       VARCHAR(250) NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+);`)
+	return err
+}
+
+func appliedMigrations(db *sqlx.DB) (map[int]time.Time, error) {
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func runMigration(db *sqlx.DB, m Migration, up bool) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	script := m.Down
+	if up {
+		script = m.Up
+	}
+	if _, err := tx.Exec(script); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+	}
+
+	if up {
+		_, err = tx.Exec(tx.Rebind(`INSERT INTO schema_migrations(version, name, applied_at) VALUES(?, ?, ?)`),
+			m.Version, m.Name, time.Now().UTC())
+	} else {
+		_, err = tx.Exec(tx.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), m.Version)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Migrate applies every pending migration in order and returns how many were applied.
+func Migrate(db *sqlx.DB) (int, error) {
+	migrations, err := Migrations(db.DriverName())
+	if err != nil {
+		return 0, err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		log.Debug().Int("version", m.Version).Str("name", m.Name).Msg("Applying migration")
+		if err := runMigration(db, m, true); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Rollback reverts the most recently applied migrations, at most steps of them.
+func Rollback(db *sqlx.DB, steps int) (int, error) {
+	migrations, err := Migrations(db.DriverName())
+	if err != nil {
+		return 0, err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return count, fmt.Errorf("migration %d (%s) cannot be rolled back", m.Version, m.Name)
+		}
+		log.Debug().Int("version", m.Version).Str("name", m.Name).Msg("Rolling back migration")
+		if err := runMigration(db, m, false); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status reports every known migration and whether it has been applied.
+func Status(db *sqlx.DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Migration: m}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,286 @@
+package db
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openInMemoryDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+	// every new connection to :memory: is a fresh database, so keep a single one
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("Sorted by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"m/0002_second.up.sql":   {Data: []byte("UP 2")},
+			"m/0002_second.down.sql": {Data: []byte("DOWN 2")},
+			"m/0001_first.up.sql":    {Data: []byte("UP 1")},
+			"m/README.md":            {Data: []byte("ignored")},
+		}
+		migrations, err := loadMigrations(fsys, "m")
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{
+			{Version: 1, Name: "first", Up: "UP 1"},
+			{Version: 2, Name: "second", Up: "UP 2", Down: "DOWN 2"},
+		}, migrations)
+	})
+
+	t.Run("Missing up script", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"m/0001_first.down.sql": {Data: []byte("DOWN 1")},
+		}
+		_, err := loadMigrations(fsys, "m")
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"m/first.up.sql": {Data: []byte("UP 1")},
+		}
+		_, err := loadMigrations(fsys, "m")
+		assert.Error(t, err)
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	db := openInMemoryDB(t)
+
+	migrations, err := Migrations(db.DriverName())
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	applied, err := Migrate(db)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), applied)
+
+	// running it again is a no-op
+	applied, err = Migrate(db)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, applied)
+
+	statuses, err := Status(db)
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.True(t, s.Applied, "migration %d should be applied", s.Version)
+		assert.NotNil(t, s.AppliedAt)
+	}
+
+	_, err = db.Exec(`INSERT INTO todolist (id, item, "order") VALUES (?, ?, ?)`, "1", "Test Item", 1)
+	assert.NoError(t, err)
+}
+
+func TestMigratePreservesData(t *testing.T) {
+	db := openInMemoryDB(t)
+
+	_, err := Migrate(db)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO todolist (id, item, "order") VALUES (?, ?, ?)`, "1", "Test Item", 1)
+	require.NoError(t, err)
+
+	// simulates a server restart
+	_, err = Migrate(db)
+	require.NoError(t, err)
+
+	var count int
+	err = db.Get(&count, `SELECT COUNT(*) FROM todolist`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestRollback(t *testing.T) {
+	db := openInMemoryDB(t)
+
+	migrations, err := Migrations(db.DriverName())
+	require.NoError(t, err)
+	_, err = Migrate(db)
+	require.NoError(t, err)
+
+	reverted, err := Rollback(db, len(migrations)+1)
+	assert.NoError(t, err)
+	assert.Equal(t, len(migrations), reverted)
+
+	statuses, err := Status(db)
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.False(t, s.Applied, "migration %d should be pending", s.Version)
+	}
+
+	var count int
+	err = db.Get(&count, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'todolist'`)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+// rollbackTo reverts the migrations applied after version.
+func rollbackTo(t *testing.T, db *sqlx.DB, version int) {
+	migrations, err := Migrations(db.DriverName())
+	require.NoError(t, err)
+	steps := 0
+	for _, m := range migrations {
+		if m.Version > version {
+			steps++
+		}
+	}
+	_, err = Rollback(db, steps)
+	require.NoError(t, err)
+}
+
+func TestRollbackListsKeepsItemsInOneSequence(t *testing.T) {
+	db := openInMemoryDB(t)
+
+	_, err := Migrate(db)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`INSERT INTO lists (id, name, "order") VALUES ('work', 'Work', 2)`,
+		`INSERT INTO todolist (id, list_id, item, "order") VALUES ('1', 'work', 'Report', 1)`,
+		`INSERT INTO todolist (id, list_id, item, "order") VALUES ('2', 'default', 'Milk', 1)`,
+		`INSERT INTO todolist (id, list_id, item, "order") VALUES ('3', 'default', 'Bread', 2)`,
+	} {
+		_, err = db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	rollbackTo(t, db, 3)
+
+	var ids []string
+	err = db.Select(&ids, `SELECT id FROM todolist ORDER BY "order"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "3", "1"}, ids)
+}
+
+func TestRollbackOwnersKeepsEveryOwnersData(t *testing.T) {
+	db := openInMemoryDB(t)
+
+	_, err := Migrate(db)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`INSERT INTO lists (owner, id, name, "order") VALUES ('alice', 'default', 'Todo', 1)`,
+		`INSERT INTO todolist (id, item, "order") VALUES ('1', 'Milk', 1)`,
+		`INSERT INTO todolist (owner, id, item, "order") VALUES ('alice', '2', 'Report', 1)`,
+	} {
+		_, err = db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	rollbackTo(t, db, 4)
+
+	var lists []string
+	err = db.Select(&lists, `SELECT id FROM lists ORDER BY "order"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"default", "alice-default"}, lists)
+
+	var listId string
+	err = db.Get(&listId, `SELECT list_id FROM todolist WHERE id = '2'`)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice-default", listId)
+}
+
+func TestRollbackCompletionPutsEveryItemInTheSequence(t *testing.T) {
+	db := openInMemoryDB(t)
+
+	_, err := Migrate(db)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`INSERT INTO todolist (id, item, "order", done) VALUES ('1', 'Milk', NULL, TRUE)`,
+		`INSERT INTO todolist (id, item, "order") VALUES ('2', 'Bread', 1)`,
+		`INSERT INTO todolist (id, item, "order") VALUES ('3', 'Eggs', 2)`,
+	} {
+		_, err = db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	rollbackTo(t, db, 5)
+
+	var ids []string
+	err = db.Select(&ids, `SELECT id FROM todolist ORDER BY "order"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "3", "1"}, ids)
+}
+
+func TestRollbackParentsFlattensSubtasks(t *testing.T) {
+	db := openInMemoryDB(t)
+
+	_, err := Migrate(db)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`INSERT INTO todolist (id, item, "order") VALUES ('1', 'Trip', 1)`,
+		`INSERT INTO todolist (id, item, "order") VALUES ('2', 'Taxes', 2)`,
+		`INSERT INTO todolist (id, parent_id, item, "order") VALUES ('3', '1', 'Tickets', 2)`,
+		`INSERT INTO todolist (id, parent_id, item, "order") VALUES ('4', '1', 'Hotel', 1)`,
+		`INSERT INTO todolist (id, parent_id, item, "order") VALUES ('5', '4', 'Deposit', 1)`,
+		`INSERT INTO todolist (id, parent_id, item, "order", done) VALUES ('6', '1', 'Visa', NULL, TRUE)`,
+	} {
+		_, err = db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	rollbackTo(t, db, 8)
+
+	var ids []string
+	err = db.Select(&ids, `SELECT id FROM todolist WHERE "order" IS NOT NULL ORDER BY "order"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "4", "5", "3", "2"}, ids)
+
+	var unordered int
+	err = db.Get(&unordered, `SELECT COUNT(*) FROM todolist WHERE id = '6' AND "order" IS NULL`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, unordered)
+}
+
+func TestMigrateVersionsExistingItems(t *testing.T) {
+	db := openInMemoryDB(t)
+
+	_, err := Migrate(db)
+	require.NoError(t, err)
+	rollbackTo(t, db, 10)
+	_, err = db.Exec(`INSERT INTO todolist (id, item, "order") VALUES ('1', 'Milk', 1)`)
+	require.NoError(t, err)
+
+	_, err = Migrate(db)
+	require.NoError(t, err)
+
+	var version, timed int
+	err = db.Get(&version, `SELECT version FROM todolist WHERE id = '1'`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, version)
+	err = db.Get(&timed, `SELECT COUNT(*) FROM todolist WHERE created_at IS NOT NULL AND updated_at IS NOT NULL`)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, timed)
+}
+
+func TestRollbackTrashDropsDeletedItems(t *testing.T) {
+	db := openInMemoryDB(t)
+
+	_, err := Migrate(db)
+	require.NoError(t, err)
+	for _, stmt := range []string{
+		`INSERT INTO todolist (id, item, "order") VALUES ('1', 'Milk', 1)`,
+		`INSERT INTO todolist (id, item, deleted_at, deleted_order) VALUES ('2', 'Bread', CURRENT_TIMESTAMP, 2)`,
+		`INSERT INTO item_tags (owner, item_id, tag) VALUES ('anonymous', '1', 'shop')`,
+		`INSERT INTO item_tags (owner, item_id, tag) VALUES ('anonymous', '2', 'shop')`,
+	} {
+		_, err = db.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	rollbackTo(t, db, 11)
+
+	var ids []string
+	err = db.Select(&ids, `SELECT id FROM todolist`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+
+	var tagged []string
+	err = db.Select(&tagged, `SELECT item_id FROM item_tags`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, tagged)
+}
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS todolist (
+    id    VARCHAR(40) NOT NULL,
+    item  VARCHAR(250) NOT NULL,
+    "order" INTEGER NOT NULL,
+    CONSTRAINT rid_pkey PRIMARY KEY (id)
+);
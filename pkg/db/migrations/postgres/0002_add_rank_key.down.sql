@@ -0,0 +1,7 @@
+-- items ranked by rank_key get their position back as a dense order
+UPDATE todolist SET "order" = ranked.position
+FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY rank_key) AS position FROM todolist WHERE rank_key IS NOT NULL) ranked
+WHERE todolist.id = ranked.id AND todolist."order" IS NULL;
+DROP INDEX todolist_rank_key_idx;
+ALTER TABLE todolist DROP COLUMN rank_key;
+ALTER TABLE todolist ALTER COLUMN "order" SET NOT NULL;
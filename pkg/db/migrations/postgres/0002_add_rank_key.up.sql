@@ -0,0 +1,5 @@
+-- "order" becomes nullable, since items ranked by rank_key have no stored order.
+-- rank_key uses the C collation so keys compare byte by byte.
+ALTER TABLE todolist ALTER COLUMN "order" DROP NOT NULL;
+ALTER TABLE todolist ADD COLUMN rank_key VARCHAR(64) COLLATE "C";
+CREATE INDEX todolist_rank_key_idx ON todolist (rank_key);
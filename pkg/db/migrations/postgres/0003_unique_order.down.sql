@@ -0,0 +1,3 @@
+DROP INDEX todolist_order_idx;
+DROP INDEX todolist_rank_key_idx;
+CREATE INDEX todolist_rank_key_idx ON todolist (rank_key);
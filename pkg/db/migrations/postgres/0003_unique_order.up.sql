@@ -0,0 +1,9 @@
+-- Renumber the items densely first, in case concurrent writes already stored
+-- two items with the same order.
+UPDATE todolist SET "order" = positions.position
+FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY "order", id) AS position FROM todolist WHERE "order" IS NOT NULL) positions
+WHERE todolist.id = positions.id;
+
+CREATE UNIQUE INDEX todolist_order_idx ON todolist ("order");
+DROP INDEX todolist_rank_key_idx;
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (rank_key);
@@ -0,0 +1,14 @@
+-- All items go back to a single sequence: the lists one after the other, each
+-- in its own order. Positions become dense orders, any rank keys are
+-- regenerated when the server starts with the lexorank strategy.
+DROP INDEX todolist_order_idx;
+DROP INDEX todolist_rank_key_idx;
+UPDATE todolist SET "order" = positions.position, rank_key = NULL
+FROM (SELECT t.id, ROW_NUMBER() OVER (ORDER BY l."order", l.rank_key, t."order", t.rank_key) AS position
+      FROM todolist t JOIN lists l ON l.id = t.list_id) positions
+WHERE todolist.id = positions.id;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist ("order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (rank_key);
+
+ALTER TABLE todolist DROP COLUMN list_id;
+DROP TABLE lists;
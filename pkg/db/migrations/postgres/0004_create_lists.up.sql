@@ -0,0 +1,18 @@
+-- Items belong to a list. Existing items move to the default list, which
+-- also backs the /todolist routes, and are ordered within their list.
+CREATE TABLE lists (
+    id       VARCHAR(40) NOT NULL,
+    name     VARCHAR(250) NOT NULL,
+    "order"  INTEGER,
+    rank_key VARCHAR(64) COLLATE "C",
+    CONSTRAINT lists_pkey PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX lists_order_idx ON lists ("order");
+CREATE UNIQUE INDEX lists_rank_key_idx ON lists (rank_key);
+INSERT INTO lists (id, name, "order") VALUES ('default', 'Todo', 1);
+
+ALTER TABLE todolist ADD COLUMN list_id VARCHAR(40) NOT NULL DEFAULT 'default' REFERENCES lists (id);
+DROP INDEX todolist_order_idx;
+DROP INDEX todolist_rank_key_idx;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (list_id, rank_key);
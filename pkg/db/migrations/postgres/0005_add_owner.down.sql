@@ -0,0 +1,32 @@
+-- The data of every owner is kept. The default lists of other owners than the
+-- anonymous one get an id derived from the owner, and the lists of all owners
+-- are renumbered into a single sequence, anonymous ones first. Rank keys are
+-- regenerated when the server starts with the lexorank strategy.
+ALTER TABLE todolist DROP CONSTRAINT todolist_list_id_fkey;
+DROP INDEX todolist_order_idx;
+DROP INDEX todolist_rank_key_idx;
+DROP INDEX lists_order_idx;
+DROP INDEX lists_rank_key_idx;
+
+UPDATE todolist SET list_id = substr(owner || '-default', 1, 40)
+WHERE owner != 'anonymous' AND list_id = 'default';
+UPDATE lists SET "order" = positions.position, rank_key = NULL
+FROM (SELECT owner, id, ROW_NUMBER() OVER (ORDER BY CASE WHEN owner = 'anonymous' THEN 0 ELSE 1 END, owner,
+          "order", rank_key) AS position
+      FROM lists) positions
+WHERE lists.owner = positions.owner AND lists.id = positions.id;
+UPDATE lists SET id = substr(owner || '-default', 1, 40)
+WHERE owner != 'anonymous' AND id = 'default';
+
+ALTER TABLE lists DROP CONSTRAINT lists_pkey;
+ALTER TABLE lists DROP COLUMN owner;
+ALTER TABLE lists ADD CONSTRAINT lists_pkey PRIMARY KEY (id);
+CREATE UNIQUE INDEX lists_order_idx ON lists ("order");
+CREATE UNIQUE INDEX lists_rank_key_idx ON lists (rank_key);
+
+ALTER TABLE todolist DROP CONSTRAINT rid_pkey;
+ALTER TABLE todolist DROP COLUMN owner;
+ALTER TABLE todolist ADD CONSTRAINT rid_pkey PRIMARY KEY (id);
+ALTER TABLE todolist ADD CONSTRAINT todolist_list_id_fkey FOREIGN KEY (list_id) REFERENCES lists (id);
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (list_id, rank_key);
@@ -0,0 +1,21 @@
+-- Lists and items belong to the user who created them. Ids are unique per
+-- owner, so every owner has a default list of their own. Existing data goes
+-- to the anonymous user, who makes every request when authentication is off.
+ALTER TABLE todolist DROP CONSTRAINT todolist_list_id_fkey;
+
+ALTER TABLE lists ADD COLUMN owner VARCHAR(250) NOT NULL DEFAULT 'anonymous';
+ALTER TABLE lists DROP CONSTRAINT lists_pkey;
+ALTER TABLE lists ADD CONSTRAINT lists_pkey PRIMARY KEY (owner, id);
+DROP INDEX lists_order_idx;
+DROP INDEX lists_rank_key_idx;
+CREATE UNIQUE INDEX lists_order_idx ON lists (owner, "order");
+CREATE UNIQUE INDEX lists_rank_key_idx ON lists (owner, rank_key);
+
+ALTER TABLE todolist ADD COLUMN owner VARCHAR(250) NOT NULL DEFAULT 'anonymous';
+ALTER TABLE todolist DROP CONSTRAINT rid_pkey;
+ALTER TABLE todolist ADD CONSTRAINT rid_pkey PRIMARY KEY (owner, id);
+ALTER TABLE todolist ADD CONSTRAINT todolist_list_id_fkey FOREIGN KEY (owner, list_id) REFERENCES lists (owner, id) ON UPDATE CASCADE;
+DROP INDEX todolist_order_idx;
+DROP INDEX todolist_rank_key_idx;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, rank_key);
@@ -0,0 +1,15 @@
+-- Every item gets a position again: the completed items that had left the
+-- sequence go to the end of their list. Positions become dense orders, any
+-- rank keys are regenerated when the server starts with the lexorank strategy.
+DROP INDEX todolist_order_idx;
+DROP INDEX todolist_rank_key_idx;
+UPDATE todolist SET "order" = positions.position, rank_key = NULL
+FROM (SELECT owner, id, ROW_NUMBER() OVER (PARTITION BY owner, list_id ORDER BY
+          CASE WHEN "order" IS NULL AND rank_key IS NULL THEN 1 ELSE 0 END, "order", rank_key) AS position
+      FROM todolist) positions
+WHERE todolist.owner = positions.owner AND todolist.id = positions.id;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, rank_key);
+
+ALTER TABLE todolist DROP COLUMN completed_at;
+ALTER TABLE todolist DROP COLUMN done;
@@ -0,0 +1,2 @@
+DROP INDEX todolist_due_at_idx;
+ALTER TABLE todolist DROP COLUMN due_at;
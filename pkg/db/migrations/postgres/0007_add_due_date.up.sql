@@ -0,0 +1,4 @@
+-- Items can be due at a point in time, kept in UTC. Due dates are queried
+-- within a list, e.g. for the overdue items.
+ALTER TABLE todolist ADD COLUMN due_at TIMESTAMPTZ;
+CREATE INDEX todolist_due_at_idx ON todolist (owner, list_id, due_at);
@@ -0,0 +1,3 @@
+DROP TABLE item_tags;
+DROP INDEX todolist_priority_idx;
+ALTER TABLE todolist DROP COLUMN priority;
@@ -0,0 +1,26 @@
+-- The sub-tasks are flattened into their list: every item is followed by its
+-- sub-tasks, depth first, and the ordered items are renumbered densely. Items
+-- that had left the sequence stay out of it, any rank keys are regenerated
+-- when the server starts with the lexorank strategy.
+DROP INDEX todolist_order_idx;
+DROP INDEX todolist_rank_key_idx;
+UPDATE todolist SET "order" = positions.position, rank_key = NULL
+FROM (WITH RECURSIVE siblings AS (
+          SELECT owner, id, list_id, parent_id,
+              "order" IS NOT NULL OR rank_key IS NOT NULL AS ordered,
+              lpad(ROW_NUMBER() OVER (PARTITION BY owner, list_id, parent_id ORDER BY
+                  CASE WHEN "order" IS NULL AND rank_key IS NULL THEN 1 ELSE 0 END, "order", rank_key, id)::text, 10, '0') AS position
+          FROM todolist
+      ), paths AS (
+          SELECT owner, id, list_id, ordered, position AS path FROM siblings WHERE parent_id = ''
+          UNION ALL
+          SELECT s.owner, s.id, s.list_id, s.ordered, p.path || s.position
+          FROM siblings s JOIN paths p ON s.owner = p.owner AND s.list_id = p.list_id AND s.parent_id = p.id
+      )
+      SELECT owner, id, ROW_NUMBER() OVER (PARTITION BY owner, list_id ORDER BY path) AS position
+      FROM paths WHERE ordered) positions
+WHERE todolist.owner = positions.owner AND todolist.id = positions.id;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, rank_key);
+
+ALTER TABLE todolist DROP COLUMN parent_id;
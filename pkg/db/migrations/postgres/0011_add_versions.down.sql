@@ -0,0 +1,3 @@
+ALTER TABLE todolist DROP COLUMN version;
+ALTER TABLE todolist DROP COLUMN updated_at;
+ALTER TABLE todolist DROP COLUMN created_at;
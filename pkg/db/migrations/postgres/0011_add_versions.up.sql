@@ -0,0 +1,5 @@
+-- Items carry a version that every write to them bumps, existing ones start
+-- at 1, created now.
+ALTER TABLE todolist ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE todolist ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+ALTER TABLE todolist ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,6 @@
+-- without a trash, deleted items are gone for good
+DELETE FROM item_tags WHERE (owner, item_id) IN (SELECT owner, id FROM todolist WHERE deleted_at IS NOT NULL);
+DELETE FROM todolist WHERE deleted_at IS NOT NULL;
+DROP INDEX todolist_deleted_at_idx;
+ALTER TABLE todolist DROP COLUMN deleted_order;
+ALTER TABLE todolist DROP COLUMN deleted_at;
@@ -0,0 +1,2 @@
+ALTER TABLE todolist DROP COLUMN time_zone;
+ALTER TABLE todolist DROP COLUMN recurrence;
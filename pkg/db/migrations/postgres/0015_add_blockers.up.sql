@@ -0,0 +1,13 @@
+-- Items can be blocked by other items of their owner, in any list, until
+-- those are done. The blockers never form a cycle.
+CREATE TABLE item_blockers (
+    owner      VARCHAR(250) NOT NULL,
+    item_id    VARCHAR(40) NOT NULL,
+    blocker_id VARCHAR(40) NOT NULL,
+    CONSTRAINT item_blockers_pkey PRIMARY KEY (owner, item_id, blocker_id),
+    CONSTRAINT item_blockers_item_fkey FOREIGN KEY (owner, item_id)
+        REFERENCES todolist (owner, id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT item_blockers_blocker_fkey FOREIGN KEY (owner, blocker_id)
+        REFERENCES todolist (owner, id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX item_blockers_blocker_idx ON item_blockers (owner, blocker_id);
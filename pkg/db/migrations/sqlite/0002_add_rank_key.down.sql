@@ -0,0 +1,12 @@
+CREATE TABLE todolist_old (
+    id    CHAR(40) NOT NULL,
+    item  VARCHAR(250) NOT NULL,
+    "order" INTEGER NOT NULL,
+    CONSTRAINT rid_pkey PRIMARY KEY (id)
+);
+-- items ranked by rank_key get their position back as a dense order
+INSERT INTO todolist_old (id, item, "order")
+SELECT id, item, COALESCE("order", ROW_NUMBER() OVER (ORDER BY rank_key))
+FROM todolist;
+DROP TABLE todolist;
+ALTER TABLE todolist_old RENAME TO todolist;
@@ -0,0 +1,13 @@
+-- "order" becomes nullable, since items ranked by rank_key have no stored order.
+-- SQLite cannot alter a column, so the table is rebuilt.
+CREATE TABLE todolist_new (
+    id       CHAR(40) NOT NULL,
+    item     VARCHAR(250) NOT NULL,
+    "order"  INTEGER,
+    rank_key VARCHAR(64),
+    CONSTRAINT rid_pkey PRIMARY KEY (id)
+);
+INSERT INTO todolist_new (id, item, "order") SELECT id, item, "order" FROM todolist;
+DROP TABLE todolist;
+ALTER TABLE todolist_new RENAME TO todolist;
+CREATE INDEX todolist_rank_key_idx ON todolist (rank_key);
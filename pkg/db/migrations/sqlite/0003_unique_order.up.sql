@@ -0,0 +1,12 @@
+-- Renumber the items densely first, in case concurrent writes already stored
+-- two items with the same order.
+CREATE TEMP TABLE todolist_positions AS
+SELECT id, ROW_NUMBER() OVER (ORDER BY "order", id) AS position
+FROM todolist WHERE "order" IS NOT NULL;
+UPDATE todolist SET "order" = (SELECT position FROM todolist_positions p WHERE p.id = todolist.id)
+WHERE "order" IS NOT NULL;
+DROP TABLE todolist_positions;
+
+CREATE UNIQUE INDEX todolist_order_idx ON todolist ("order");
+DROP INDEX todolist_rank_key_idx;
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (rank_key);
@@ -0,0 +1,25 @@
+-- All items go back to a single sequence: the lists one after the other, each
+-- in its own order. Positions become dense orders, any rank keys are
+-- regenerated when the server starts with the lexorank strategy.
+CREATE TEMP TABLE todolist_positions AS
+SELECT t.id, ROW_NUMBER() OVER (ORDER BY
+    CASE WHEN l."order" IS NULL THEN 1 ELSE 0 END, l."order", l.rank_key,
+    CASE WHEN t."order" IS NULL THEN 1 ELSE 0 END, t."order", t.rank_key) AS position
+FROM todolist t JOIN lists l ON l.id = t.list_id;
+
+CREATE TABLE todolist_old (
+    id       CHAR(40) NOT NULL,
+    item     VARCHAR(250) NOT NULL,
+    "order"  INTEGER,
+    rank_key VARCHAR(64),
+    CONSTRAINT rid_pkey PRIMARY KEY (id)
+);
+INSERT INTO todolist_old (id, item, "order")
+SELECT t.id, t.item, p.position FROM todolist t JOIN todolist_positions p ON p.id = t.id;
+DROP TABLE todolist;
+DROP TABLE todolist_positions;
+ALTER TABLE todolist_old RENAME TO todolist;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist ("order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (rank_key);
+
+DROP TABLE lists;
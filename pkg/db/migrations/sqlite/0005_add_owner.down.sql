@@ -0,0 +1,38 @@
+-- The data of every owner is kept. The default lists of other owners than the
+-- anonymous one get an id derived from the owner, and the lists of all owners
+-- are renumbered into a single sequence, anonymous ones first. Rank keys are
+-- regenerated when the server starts with the lexorank strategy.
+CREATE TABLE lists_old (
+    id       CHAR(40) NOT NULL,
+    name     VARCHAR(250) NOT NULL,
+    "order"  INTEGER,
+    rank_key VARCHAR(64),
+    CONSTRAINT lists_pkey PRIMARY KEY (id)
+);
+INSERT INTO lists_old (id, name, "order")
+SELECT CASE WHEN owner = 'anonymous' OR id != 'default' THEN id ELSE substr(owner || '-default', 1, 40) END,
+    name,
+    ROW_NUMBER() OVER (ORDER BY CASE WHEN owner = 'anonymous' THEN 0 ELSE 1 END, owner,
+        CASE WHEN "order" IS NULL THEN 1 ELSE 0 END, "order", rank_key)
+FROM lists;
+DROP TABLE lists;
+ALTER TABLE lists_old RENAME TO lists;
+CREATE UNIQUE INDEX lists_order_idx ON lists ("order");
+CREATE UNIQUE INDEX lists_rank_key_idx ON lists (rank_key);
+
+CREATE TABLE todolist_old (
+    id       CHAR(40) NOT NULL,
+    item     VARCHAR(250) NOT NULL,
+    "order"  INTEGER,
+    rank_key VARCHAR(64),
+    list_id  CHAR(40) NOT NULL DEFAULT 'default',
+    CONSTRAINT rid_pkey PRIMARY KEY (id)
+);
+INSERT INTO todolist_old (id, item, "order", rank_key, list_id)
+SELECT id, item, "order", rank_key,
+    CASE WHEN owner = 'anonymous' OR list_id != 'default' THEN list_id ELSE substr(owner || '-default', 1, 40) END
+FROM todolist;
+DROP TABLE todolist;
+ALTER TABLE todolist_old RENAME TO todolist;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (list_id, rank_key);
@@ -0,0 +1,33 @@
+-- Lists and items belong to the user who created them. Ids are unique per
+-- owner, so every owner has a default list of their own. Existing data goes
+-- to the anonymous user, who makes every request when authentication is off.
+CREATE TABLE lists_new (
+    owner    VARCHAR(250) NOT NULL DEFAULT 'anonymous',
+    id       CHAR(40) NOT NULL,
+    name     VARCHAR(250) NOT NULL,
+    "order"  INTEGER,
+    rank_key VARCHAR(64),
+    CONSTRAINT lists_pkey PRIMARY KEY (owner, id)
+);
+INSERT INTO lists_new (id, name, "order", rank_key)
+SELECT id, name, "order", rank_key FROM lists;
+DROP TABLE lists;
+ALTER TABLE lists_new RENAME TO lists;
+CREATE UNIQUE INDEX lists_order_idx ON lists (owner, "order");
+CREATE UNIQUE INDEX lists_rank_key_idx ON lists (owner, rank_key);
+
+CREATE TABLE todolist_new (
+    owner    VARCHAR(250) NOT NULL DEFAULT 'anonymous',
+    id       CHAR(40) NOT NULL,
+    list_id  CHAR(40) NOT NULL DEFAULT 'default',
+    item     VARCHAR(250) NOT NULL,
+    "order"  INTEGER,
+    rank_key VARCHAR(64),
+    CONSTRAINT rid_pkey PRIMARY KEY (owner, id)
+);
+INSERT INTO todolist_new (id, list_id, item, "order", rank_key)
+SELECT id, list_id, item, "order", rank_key FROM todolist;
+DROP TABLE todolist;
+ALTER TABLE todolist_new RENAME TO todolist;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, rank_key);
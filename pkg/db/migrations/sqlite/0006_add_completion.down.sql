@@ -0,0 +1,26 @@
+-- Every item gets a position again: the completed items that had left the
+-- sequence go to the end of their list. Positions become dense orders, any
+-- rank keys are regenerated when the server starts with the lexorank strategy.
+CREATE TEMP TABLE todolist_positions AS
+SELECT owner, id, ROW_NUMBER() OVER (PARTITION BY owner, list_id ORDER BY
+    CASE WHEN "order" IS NULL AND rank_key IS NULL THEN 1 ELSE 0 END,
+    CASE WHEN "order" IS NULL THEN 1 ELSE 0 END, "order", rank_key) AS position
+FROM todolist;
+
+CREATE TABLE todolist_old (
+    owner    VARCHAR(250) NOT NULL DEFAULT 'anonymous',
+    id       CHAR(40) NOT NULL,
+    list_id  CHAR(40) NOT NULL DEFAULT 'default',
+    item     VARCHAR(250) NOT NULL,
+    "order"  INTEGER,
+    rank_key VARCHAR(64),
+    CONSTRAINT rid_pkey PRIMARY KEY (owner, id)
+);
+INSERT INTO todolist_old (owner, id, list_id, item, "order")
+SELECT t.owner, t.id, t.list_id, t.item, p.position
+FROM todolist t JOIN todolist_positions p ON p.owner = t.owner AND p.id = t.id;
+DROP TABLE todolist;
+DROP TABLE todolist_positions;
+ALTER TABLE todolist_old RENAME TO todolist;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, rank_key);
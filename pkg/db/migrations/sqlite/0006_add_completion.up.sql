@@ -0,0 +1,4 @@
+-- Items can be ticked off. Depending on the completion policy, completed
+-- items may leave the sequence of their list, so they have no position.
+ALTER TABLE todolist ADD COLUMN done BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE todolist ADD COLUMN completed_at TIMESTAMP;
@@ -0,0 +1,19 @@
+DROP INDEX todolist_due_at_idx;
+
+CREATE TABLE todolist_old (
+    owner        VARCHAR(250) NOT NULL DEFAULT 'anonymous',
+    id           CHAR(40) NOT NULL,
+    list_id      CHAR(40) NOT NULL DEFAULT 'default',
+    item         VARCHAR(250) NOT NULL,
+    "order"      INTEGER,
+    rank_key     VARCHAR(64),
+    done         BOOLEAN NOT NULL DEFAULT FALSE,
+    completed_at TIMESTAMP,
+    CONSTRAINT rid_pkey PRIMARY KEY (owner, id)
+);
+INSERT INTO todolist_old (owner, id, list_id, item, "order", rank_key, done, completed_at)
+SELECT owner, id, list_id, item, "order", rank_key, done, completed_at FROM todolist;
+DROP TABLE todolist;
+ALTER TABLE todolist_old RENAME TO todolist;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, rank_key);
@@ -0,0 +1,12 @@
+-- Items have a priority, none when empty, and any number of tags. A tag is
+-- just a name, which exists as long as some item of its owner carries it.
+ALTER TABLE todolist ADD COLUMN priority VARCHAR(10) NOT NULL DEFAULT '';
+CREATE INDEX todolist_priority_idx ON todolist (owner, list_id, priority);
+
+CREATE TABLE item_tags (
+    owner   VARCHAR(250) NOT NULL,
+    item_id CHAR(40) NOT NULL,
+    tag     VARCHAR(40) NOT NULL,
+    CONSTRAINT item_tags_pkey PRIMARY KEY (owner, item_id, tag)
+);
+CREATE INDEX item_tags_tag_idx ON item_tags (owner, tag);
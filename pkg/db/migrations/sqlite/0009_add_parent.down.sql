@@ -0,0 +1,43 @@
+-- The sub-tasks are flattened into their list: every item is followed by its
+-- sub-tasks, depth first, and the ordered items are renumbered densely. Items
+-- that had left the sequence stay out of it, any rank keys are regenerated
+-- when the server starts with the lexorank strategy.
+CREATE TEMP TABLE todolist_positions AS
+WITH RECURSIVE siblings AS (
+    SELECT owner, id, list_id, parent_id,
+        CASE WHEN "order" IS NULL AND rank_key IS NULL THEN 0 ELSE 1 END AS ordered,
+        printf('%010d', ROW_NUMBER() OVER (PARTITION BY owner, list_id, parent_id ORDER BY
+            CASE WHEN "order" IS NULL AND rank_key IS NULL THEN 1 ELSE 0 END, "order", rank_key, id)) AS position
+    FROM todolist
+), paths AS (
+    SELECT owner, id, list_id, ordered, position AS path FROM siblings WHERE parent_id = ''
+    UNION ALL
+    SELECT s.owner, s.id, s.list_id, s.ordered, p.path || s.position
+    FROM siblings s JOIN paths p ON s.owner = p.owner AND s.list_id = p.list_id AND s.parent_id = p.id
+)
+SELECT owner, id, ROW_NUMBER() OVER (PARTITION BY owner, list_id ORDER BY path) AS position
+FROM paths WHERE ordered = 1;
+
+CREATE TABLE todolist_old (
+    owner        VARCHAR(250) NOT NULL DEFAULT 'anonymous',
+    id           CHAR(40) NOT NULL,
+    list_id      CHAR(40) NOT NULL DEFAULT 'default',
+    item         VARCHAR(250) NOT NULL,
+    "order"      INTEGER,
+    rank_key     VARCHAR(64),
+    done         BOOLEAN NOT NULL DEFAULT FALSE,
+    completed_at TIMESTAMP,
+    due_at       TIMESTAMP,
+    priority     VARCHAR(10) NOT NULL DEFAULT '',
+    CONSTRAINT rid_pkey PRIMARY KEY (owner, id)
+);
+INSERT INTO todolist_old (owner, id, list_id, item, "order", done, completed_at, due_at, priority)
+SELECT t.owner, t.id, t.list_id, t.item, p.position, t.done, t.completed_at, t.due_at, t.priority
+FROM todolist t LEFT JOIN todolist_positions p ON p.owner = t.owner AND p.id = t.id;
+DROP TABLE todolist;
+DROP TABLE todolist_positions;
+ALTER TABLE todolist_old RENAME TO todolist;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, rank_key);
+CREATE INDEX todolist_due_at_idx ON todolist (owner, list_id, due_at);
+CREATE INDEX todolist_priority_idx ON todolist (owner, list_id, priority);
@@ -0,0 +1,7 @@
+-- Items can be sub-tasks of another item in the same list; top-level items
+-- have an empty parent. Every group of siblings is ordered on its own.
+ALTER TABLE todolist ADD COLUMN parent_id CHAR(40) NOT NULL DEFAULT '';
+DROP INDEX todolist_order_idx;
+DROP INDEX todolist_rank_key_idx;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, parent_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, parent_id, rank_key);
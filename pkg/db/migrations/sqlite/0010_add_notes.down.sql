@@ -0,0 +1,22 @@
+CREATE TABLE todolist_old (
+    owner        VARCHAR(250) NOT NULL DEFAULT 'anonymous',
+    id           CHAR(40) NOT NULL,
+    list_id      CHAR(40) NOT NULL DEFAULT 'default',
+    item         VARCHAR(250) NOT NULL,
+    "order"      INTEGER,
+    rank_key     VARCHAR(64),
+    done         BOOLEAN NOT NULL DEFAULT FALSE,
+    completed_at TIMESTAMP,
+    due_at       TIMESTAMP,
+    priority     VARCHAR(10) NOT NULL DEFAULT '',
+    parent_id    CHAR(40) NOT NULL DEFAULT '',
+    CONSTRAINT rid_pkey PRIMARY KEY (owner, id)
+);
+INSERT INTO todolist_old (owner, id, list_id, item, "order", rank_key, done, completed_at, due_at, priority, parent_id)
+SELECT owner, id, list_id, item, "order", rank_key, done, completed_at, due_at, priority, parent_id FROM todolist;
+DROP TABLE todolist;
+ALTER TABLE todolist_old RENAME TO todolist;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, parent_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, parent_id, rank_key);
+CREATE INDEX todolist_due_at_idx ON todolist (owner, list_id, due_at);
+CREATE INDEX todolist_priority_idx ON todolist (owner, list_id, priority);
@@ -0,0 +1,2 @@
+-- Items have long-form notes in Markdown, none when empty.
+ALTER TABLE todolist ADD COLUMN notes TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- Items carry a version that every write to them bumps, existing ones start
+-- at 1, created now.
+ALTER TABLE todolist ADD COLUMN created_at TIMESTAMP;
+ALTER TABLE todolist ADD COLUMN updated_at TIMESTAMP;
+ALTER TABLE todolist ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+UPDATE todolist SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP;
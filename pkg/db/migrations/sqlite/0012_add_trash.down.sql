@@ -0,0 +1,33 @@
+-- without a trash, deleted items are gone for good
+DELETE FROM item_tags WHERE EXISTS (
+    SELECT 1 FROM todolist WHERE todolist.owner = item_tags.owner AND todolist.id = item_tags.item_id AND todolist.deleted_at IS NOT NULL
+);
+DELETE FROM todolist WHERE deleted_at IS NOT NULL;
+DROP INDEX todolist_deleted_at_idx;
+
+CREATE TABLE todolist_old (
+    owner        VARCHAR(250) NOT NULL DEFAULT 'anonymous',
+    id           CHAR(40) NOT NULL,
+    list_id      CHAR(40) NOT NULL DEFAULT 'default',
+    item         VARCHAR(250) NOT NULL,
+    "order"      INTEGER,
+    rank_key     VARCHAR(64),
+    done         BOOLEAN NOT NULL DEFAULT FALSE,
+    completed_at TIMESTAMP,
+    due_at       TIMESTAMP,
+    priority     VARCHAR(10) NOT NULL DEFAULT '',
+    parent_id    CHAR(40) NOT NULL DEFAULT '',
+    notes        TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP,
+    updated_at   TIMESTAMP,
+    version      INTEGER NOT NULL DEFAULT 1,
+    CONSTRAINT rid_pkey PRIMARY KEY (owner, id)
+);
+INSERT INTO todolist_old (owner, id, list_id, item, "order", rank_key, done, completed_at, due_at, priority, parent_id, notes, created_at, updated_at, version)
+SELECT owner, id, list_id, item, "order", rank_key, done, completed_at, due_at, priority, parent_id, notes, created_at, updated_at, version FROM todolist;
+DROP TABLE todolist;
+ALTER TABLE todolist_old RENAME TO todolist;
+CREATE UNIQUE INDEX todolist_order_idx ON todolist (owner, list_id, parent_id, "order");
+CREATE UNIQUE INDEX todolist_rank_key_idx ON todolist (owner, list_id, parent_id, rank_key);
+CREATE INDEX todolist_due_at_idx ON todolist (owner, list_id, due_at);
+CREATE INDEX todolist_priority_idx ON todolist (owner, list_id, priority);
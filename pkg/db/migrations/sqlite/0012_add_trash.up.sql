@@ -0,0 +1,6 @@
+-- Deleted items go to the trash along with their sub-tasks until they are
+-- restored or purged. deleted_order is only set on the item that was deleted
+-- itself, to the position it had, 0 when it had none.
+ALTER TABLE todolist ADD COLUMN deleted_at TIMESTAMP;
+ALTER TABLE todolist ADD COLUMN deleted_order INTEGER;
+CREATE INDEX todolist_deleted_at_idx ON todolist (deleted_at);
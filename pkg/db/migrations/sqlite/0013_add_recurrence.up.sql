@@ -0,0 +1,4 @@
+-- Items recur by an iCalendar RRULE, empty when they do not, which is worked
+-- out in time_zone, an IANA zone name, UTC when empty.
+ALTER TABLE todolist ADD COLUMN recurrence VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE todolist ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '';
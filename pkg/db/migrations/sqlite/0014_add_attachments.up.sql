@@ -0,0 +1,16 @@
+-- Items have attachments, whose content is kept on disk under its SHA-256
+-- digest, so that identical files are stored once. A file is removed once no
+-- attachment refers to it any more.
+CREATE TABLE attachments (
+    owner        VARCHAR(250) NOT NULL,
+    id           CHAR(40) NOT NULL,
+    item_id      CHAR(40) NOT NULL,
+    name         VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size         BIGINT NOT NULL,
+    digest       CHAR(64) NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    CONSTRAINT attachments_pkey PRIMARY KEY (owner, id)
+);
+CREATE INDEX attachments_item_idx ON attachments (owner, item_id);
+CREATE INDEX attachments_digest_idx ON attachments (digest);
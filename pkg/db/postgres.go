@@ -0,0 +1,15 @@
+package db
+
+import (
+	"fmt"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/jmoiron/sqlx"
+)
+
+func openPostgres(dsn string) (*sqlx.DB, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("a DSN is required for the %s driver", DriverPostgres)
+	}
+	return sqlx.Connect("pgx", dsn)
+}
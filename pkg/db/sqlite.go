@@ -3,36 +3,47 @@ package db
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/rs/zerolog/log"
 )
 
-func CreateDb() (*sqlx.DB, error) {
-	log.Debug().Msg("Creating Db")
+const (
+	MemoryDSN = ":memory:"
+)
 
+func defaultSQLiteDSN() (string, error) {
 	ex, err := os.Executable()
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(ex), "todolist.db"), nil
+}
+
+func isMemoryDSN(dsn string) bool {
+	return dsn == MemoryDSN ||
+		strings.HasPrefix(dsn, "file::memory:") ||
+		strings.Contains(dsn, "mode=memory")
+}
+
+func openSQLite(dsn string) (*sqlx.DB, error) {
+	if dsn == "" {
+		var err error
+		dsn, err = defaultSQLiteDSN()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	db, err := sqlx.Connect("sqlite3", filepath.Join(filepath.Dir(ex), "todolist.db"))
+	db, err := sqlx.Connect("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Debug().Msg("Creating Table")
-	var schema = `
-DROP TABLE IF EXISTS todolist;
-CREATE TABLE todolist (
-    id    CHAR(40) NOT NULL,
-    item  VARCHAR(250) NOT NULL,
-    "order" INTEGER NOT NULL,
-    CONSTRAINT rid_pkey PRIMARY KEY (id)
-);
-`
-	db.MustExec(schema)
-	log.Debug().Msg("DB Init Completed")
+	if isMemoryDSN(dsn) {
+		// every new connection to an in-memory database starts empty
+		db.SetMaxOpenConns(1)
+	}
 	return db, nil
 }
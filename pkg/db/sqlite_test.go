@@ -2,6 +2,8 @@ package db
 
 import (
 	"database/sql"
+	"os"
+	"path/filepath"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -54,3 +56,49 @@ func TestCreateDb(t *testing.T) {
 	assert.Equal(t, "Test Item", item, "Expected item to be 'Test Item'")
 	assert.Equal(t, 1, order, "Expected order to be 1")
 }
+
+func TestCreateDbOptions(t *testing.T) {
+	t.Run("In-memory database", func(t *testing.T) {
+		database, err := CreateDb(Options{DSN: MemoryDSN})
+		assert.NoError(t, err)
+		defer database.Close()
+
+		// the schema must survive across pooled connections
+		_, err = database.Exec(`INSERT INTO todolist (id, item, "order") VALUES (?, ?, ?)`, "1", "Test Item", 1)
+		assert.NoError(t, err)
+		var count int
+		err = database.Get(&count, `SELECT COUNT(*) FROM todolist`)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("File path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "todolist.db")
+		database, err := CreateDb(Options{DSN: path})
+		assert.NoError(t, err)
+		database.Close()
+
+		_, err = os.Stat(path)
+		assert.NoError(t, err, "Expected the database file to be created")
+	})
+
+	t.Run("DSN with pragmas", func(t *testing.T) {
+		dsn := "file:" + filepath.Join(t.TempDir(), "todolist.db") + "?_journal_mode=WAL&_busy_timeout=5000"
+		database, err := CreateDb(Options{DSN: dsn})
+		assert.NoError(t, err)
+		defer database.Close()
+
+		var journalMode string
+		err = database.Get(&journalMode, `PRAGMA journal_mode`)
+		assert.NoError(t, err)
+		assert.Equal(t, "wal", journalMode)
+	})
+}
+
+func TestIsMemoryDSN(t *testing.T) {
+	assert.True(t, isMemoryDSN(":memory:"))
+	assert.True(t, isMemoryDSN("file::memory:?cache=shared"))
+	assert.True(t, isMemoryDSN("file:todo?mode=memory"))
+	assert.False(t, isMemoryDSN("/var/lib/todolist/todolist.db"))
+	assert.False(t, isMemoryDSN("file:todolist.db?_journal_mode=WAL"))
+}
@@ -0,0 +1,36 @@
+package structs
+
+import "time"
+
+// Attachment is a file attached to an item. Its content is stored apart,
+// under Digest, and is not part of the item.
+type Attachment struct {
+	Id          string `json:"id"`
+	ItemId      string `json:"itemId"`
+	Name        string `json:"name" validate:"required,max=255"`
+	ContentType string `json:"contentType" validate:"required,max=255"`
+	Size        int64  `json:"size"`
+	// Digest is the hex SHA-256 of the content.
+	Digest    string     `json:"digest"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// In renders the times of the attachment in loc.
+func (a *Attachment) In(loc *time.Location) {
+	if a.CreatedAt != nil {
+		createdAt := a.CreatedAt.In(loc)
+		a.CreatedAt = &createdAt
+	}
+}
+
+type Attachments struct {
+	Items []Attachment `json:"items"`
+	Count int          `json:"count"`
+}
+
+// In renders the times of every attachment in loc.
+func (l *Attachments) In(loc *time.Location) {
+	for i := range l.Items {
+		l.Items[i].In(loc)
+	}
+}
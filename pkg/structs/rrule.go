@@ -0,0 +1,385 @@
+package structs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency is the FREQ of a recurrence rule.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// recurrenceHorizon bounds the search for the next occurrence, rules that
+// have none within it have run out.
+const recurrenceHorizon = 10 * 366
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// WeekdayNum is a BYDAY entry: a day of the week, only its Nth one in the
+// month or year when N is not 0, counting from the end when N is negative.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+func (w WeekdayNum) String() string {
+	day := strings.ToUpper(w.Day.String()[:2])
+	if w.N == 0 {
+		return day
+	}
+	return strconv.Itoa(w.N) + day
+}
+
+// Recurrence is an iCalendar recurrence rule (RFC 5545 RRULE), limited to
+// rules that yield at most one occurrence a day: FREQ, INTERVAL, COUNT,
+// UNTIL, BYDAY, BYMONTHDAY, BYMONTH and WKST.
+type Recurrence struct {
+	Freq Frequency
+	// Interval is 1 unless the rule says otherwise.
+	Interval int
+	// Count is the number of occurrences including the first one, 0 when
+	// the rule does not limit them.
+	Count int
+	// Until is the last time an occurrence can fall on, as written in the
+	// rule: a date, a time in UTC or a time in the zone of the occurrences.
+	Until      string
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	ByMonth    []time.Month
+	WeekStart  time.Weekday
+}
+
+// ParseRecurrence parses the value of an RRULE, with or without the "RRULE:"
+// prefix, e.g. "FREQ=MONTHLY;BYDAY=-1FR" for the last Friday of every month.
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	r := &Recurrence{Interval: 1, WeekStart: time.Monday}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s is given more than once", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			switch Frequency(value) {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = Frequency(value)
+			default:
+				err = fmt.Errorf("unsupported frequency %s", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = positive(value)
+		case "COUNT":
+			r.Count, err = positive(value)
+		case "UNTIL":
+			r.Until = value
+			_, err = r.untilIn(time.UTC)
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				var weekday WeekdayNum
+				weekday, err = parseWeekdayNum(day)
+				if err != nil {
+					break
+				}
+				r.ByDay = append(r.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				var monthDay int
+				monthDay, err = strconv.Atoi(day)
+				if err != nil || monthDay == 0 || monthDay < -31 || monthDay > 31 {
+					err = fmt.Errorf("invalid day of the month %q", day)
+					break
+				}
+				r.ByMonthDay = append(r.ByMonthDay, monthDay)
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(value, ",") {
+				var m int
+				m, err = strconv.Atoi(month)
+				if err != nil || m < 1 || m > 12 {
+					err = fmt.Errorf("invalid month %q", month)
+					break
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(m))
+			}
+		case "WKST":
+			day, known := weekdays[value]
+			if !known {
+				err = fmt.Errorf("invalid day of the week %q", value)
+			}
+			r.WeekStart = day
+		case "BYSETPOS", "BYYEARDAY", "BYWEEKNO", "BYHOUR", "BYMINUTE", "BYSECOND":
+			err = fmt.Errorf("%s is not supported", name)
+		default:
+			err = fmt.Errorf("unknown rule part %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return nil, fmt.Errorf("FREQ is required")
+	case r.Count > 0 && r.Until != "":
+		return nil, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	case r.Freq == Weekly && len(r.ByMonthDay) > 0:
+		return nil, fmt.Errorf("BYMONTHDAY cannot be used with a weekly rule")
+	}
+	for _, day := range r.ByDay {
+		limit := 53
+		if r.Freq == Monthly || (r.Freq == Yearly && len(r.ByMonth) > 0) {
+			limit = 5
+		}
+		if day.N != 0 && (r.Freq == Daily || r.Freq == Weekly) {
+			return nil, fmt.Errorf("%s only applies to monthly and yearly rules", day)
+		}
+		if day.N < -limit || day.N > limit {
+			return nil, fmt.Errorf("there is no %s", day)
+		}
+	}
+	return r, nil
+}
+
+func positive(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%q is not a positive number", value)
+	}
+	return n, nil
+}
+
+func parseWeekdayNum(value string) (WeekdayNum, error) {
+	if len(value) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid day of the week %q", value)
+	}
+	day, known := weekdays[value[len(value)-2:]]
+	if !known {
+		return WeekdayNum{}, fmt.Errorf("invalid day of the week %q", value)
+	}
+	n := 0
+	if prefix := value[:len(value)-2]; prefix != "" {
+		var err error
+		n, err = strconv.Atoi(prefix)
+		if err != nil || n == 0 {
+			return WeekdayNum{}, fmt.Errorf("invalid day of the week %q", value)
+		}
+	}
+	return WeekdayNum{N: n, Day: day}, nil
+}
+
+// String renders the rule as the value of an RRULE, with the parts in a fixed
+// order and the defaults left out.
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != "" {
+		parts = append(parts, "UNTIL="+r.Until)
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, 0, len(r.ByMonth))
+		for _, month := range r.ByMonth {
+			months = append(months, strconv.Itoa(int(month)))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, day := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, day := range r.ByDay {
+			days = append(days, day.String())
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+WeekdayNum{Day: r.WeekStart}.String())
+	}
+	return strings.Join(parts, ";")
+}
+
+// untilIn returns the last time an occurrence in loc can fall on, the end of
+// the day for a date.
+func (r *Recurrence) untilIn(loc *time.Location) (time.Time, error) {
+	switch {
+	case strings.HasSuffix(r.Until, "Z"):
+		return time.Parse("20060102T150405Z", r.Until)
+	case strings.Contains(r.Until, "T"):
+		return time.ParseInLocation("20060102T150405", r.Until, loc)
+	default:
+		date, err := time.ParseInLocation("20060102", r.Until, loc)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return date.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+}
+
+// Next returns the first occurrence of the rule that comes after both start,
+// which is the first occurrence of the series, and after. Occurrences keep the
+// wall clock time of start in its location, across daylight saving changes;
+// one that falls in the gap of a change moves forward by the length of the
+// gap. passed is the number of occurrences before it, counting start, and ok
+// is false when the rule has run out.
+func (r *Recurrence) Next(start, after time.Time) (next time.Time, passed int, ok bool) {
+	loc := start.Location()
+	until, err := r.untilIn(loc)
+	limited := r.Until != "" && err == nil
+
+	// dates are walked at noon in UTC, where every day has 24 hours
+	first := time.Date(start.Year(), start.Month(), start.Day(), 12, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 0, recurrenceHorizon)
+	if after.After(start) {
+		last = time.Date(after.Year(), after.Month(), after.Day(), 12, 0, 0, 0, time.UTC).AddDate(0, 0, recurrenceHorizon)
+	}
+	hour, minute, second := start.Clock()
+
+	passed = 1
+	for date := first.AddDate(0, 0, 1); !date.After(last); date = date.AddDate(0, 0, 1) {
+		if !r.matches(first, date) {
+			continue
+		}
+		occurrence := wallClock(date, hour, minute, second, start.Nanosecond(), loc)
+		if (limited && occurrence.After(until)) || (r.Count > 0 && passed >= r.Count) {
+			return time.Time{}, passed, false
+		}
+		if occurrence.After(after) {
+			return occurrence, passed, true
+		}
+		passed++
+	}
+	return time.Time{}, passed, false
+}
+
+// wallClock returns the time in loc at the wall clock time on date. A time
+// in the gap of a daylight saving change is taken with the offset from before
+// the change, as RFC 5545 has it, which moves it forward by the gap.
+func wallClock(date time.Time, hour, minute, second, nsec int, loc *time.Location) time.Time {
+	t := time.Date(date.Year(), date.Month(), date.Day(), hour, minute, second, nsec, loc)
+	if h, m, s := t.Clock(); h == hour && m == minute && s == second {
+		return t
+	}
+	_, offset := t.Add(-6 * time.Hour).Zone()
+	wall := time.Date(date.Year(), date.Month(), date.Day(), hour, minute, second, nsec, time.UTC)
+	return wall.Add(-time.Duration(offset) * time.Second).In(loc)
+}
+
+// matches reports whether the rule has an occurrence on date, for the series
+// starting on start. Both are dates at noon in UTC.
+func (r *Recurrence) matches(start, date time.Time) bool {
+	if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, date.Month()) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 && !r.matchesMonthDay(date) {
+		return false
+	}
+	if len(r.ByDay) > 0 && !r.matchesWeekday(date) {
+		return false
+	}
+
+	switch r.Freq {
+	case Daily:
+		return daysBetween(start, date)%r.Interval == 0
+	case Weekly:
+		if len(r.ByDay) == 0 && date.Weekday() != start.Weekday() {
+			return false
+		}
+		return daysBetween(r.weekOf(start), r.weekOf(date))/7%r.Interval == 0
+	case Monthly:
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 && date.Day() != start.Day() {
+			return false
+		}
+		months := (date.Year()-start.Year())*12 + int(date.Month()) - int(start.Month())
+		return months%r.Interval == 0
+	default:
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			if date.Day() != start.Day() || (len(r.ByMonth) == 0 && date.Month() != start.Month()) {
+				return false
+			}
+		}
+		return (date.Year()-start.Year())%r.Interval == 0
+	}
+}
+
+func (r *Recurrence) matchesMonthDay(date time.Time) bool {
+	days := daysIn(date.Year(), date.Month())
+	for _, day := range r.ByMonthDay {
+		if day == date.Day() || days+day+1 == date.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWeekday checks BYDAY, where the numbered days count within the
+// month for monthly rules and yearly ones by month, and within the year
+// otherwise.
+func (r *Recurrence) matchesWeekday(date time.Time) bool {
+	day, days := date.Day(), daysIn(date.Year(), date.Month())
+	if r.Freq == Yearly && len(r.ByMonth) == 0 {
+		day, days = date.YearDay(), time.Date(date.Year(), time.December, 31, 12, 0, 0, 0, time.UTC).YearDay()
+	}
+	for _, weekday := range r.ByDay {
+		if weekday.Day != date.Weekday() {
+			continue
+		}
+		switch {
+		case weekday.N == 0,
+			weekday.N > 0 && (day-1)/7+1 == weekday.N,
+			weekday.N < 0 && (days-day)/7+1 == -weekday.N:
+			return true
+		}
+	}
+	return false
+}
+
+// weekOf returns the first day of the week of date, which starts on WKST.
+func (r *Recurrence) weekOf(date time.Time) time.Time {
+	return date.AddDate(0, 0, -((int(date.Weekday()) - int(r.WeekStart) + 7) % 7))
+}
+
+func containsMonth(months []time.Month, month time.Month) bool {
+	for _, m := range months {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Round(time.Hour).Hours()) / 24
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 12, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,145 @@
+package structs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		// canonical is the rule as String renders it, empty when it is invalid
+		canonical string
+	}{
+		{"Daily", "FREQ=DAILY", "FREQ=DAILY"},
+		{"Prefix and lower case", "RRULE:freq=weekly;byday=mo,th", "FREQ=WEEKLY;BYDAY=MO,TH"},
+		{"Last Friday of the month", "FREQ=MONTHLY;BYDAY=-1FR", "FREQ=MONTHLY;BYDAY=-1FR"},
+		{"Every part", "WKST=SU;BYDAY=1MO;BYMONTHDAY=1,-1;BYMONTH=1,7;UNTIL=20301231;INTERVAL=2;FREQ=YEARLY",
+			"FREQ=YEARLY;INTERVAL=2;UNTIL=20301231;BYMONTH=1,7;BYMONTHDAY=1,-1;BYDAY=1MO;WKST=SU"},
+		{"Default interval", "FREQ=DAILY;INTERVAL=1;COUNT=5", "FREQ=DAILY;COUNT=5"},
+		{"Until in UTC", "FREQ=DAILY;UNTIL=20240701T120000Z", "FREQ=DAILY;UNTIL=20240701T120000Z"},
+		{"No frequency", "BYDAY=MO", ""},
+		{"Empty", "", ""},
+		{"Hourly", "FREQ=HOURLY", ""},
+		{"Unsupported part", "FREQ=MONTHLY;BYSETPOS=-1", ""},
+		{"Unknown part", "FREQ=DAILY;EVERY=2", ""},
+		{"Repeated part", "FREQ=DAILY;FREQ=WEEKLY", ""},
+		{"Zero interval", "FREQ=DAILY;INTERVAL=0", ""},
+		{"Count and until", "FREQ=DAILY;COUNT=2;UNTIL=20240701", ""},
+		{"Invalid until", "FREQ=DAILY;UNTIL=tomorrow", ""},
+		{"Unknown day", "FREQ=WEEKLY;BYDAY=XX", ""},
+		{"Numbered day of a weekly rule", "FREQ=WEEKLY;BYDAY=2MO", ""},
+		{"Sixth Monday of the month", "FREQ=MONTHLY;BYDAY=6MO", ""},
+		{"Day 32", "FREQ=MONTHLY;BYMONTHDAY=32", ""},
+		{"Month 13", "FREQ=YEARLY;BYMONTH=13", ""},
+		{"Weekly by day of the month", "FREQ=WEEKLY;BYMONTHDAY=1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRecurrence(tt.rule)
+			if tt.canonical == "" {
+				assert.Error(t, err)
+				assert.Error(t, ValidateVar(tt.rule, "rrule"))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.canonical, r.String())
+			assert.NoError(t, ValidateVar(tt.rule, "rrule"))
+		})
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, newYork)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start string
+		// after is the start when empty
+		after  string
+		next   string
+		passed int
+	}{
+		{"Daily", "FREQ=DAILY", "2024-07-01 09:00", "", "2024-07-02 09:00", 1},
+		{"Every other day", "FREQ=DAILY;INTERVAL=2", "2024-07-01 09:00", "", "2024-07-03 09:00", 1},
+		{"Weekly on the day of the start", "FREQ=WEEKLY", "2024-07-03 09:00", "", "2024-07-10 09:00", 1},
+		{"Weekly on Monday and Thursday", "FREQ=WEEKLY;BYDAY=MO,TH", "2024-07-01 09:00", "", "2024-07-04 09:00", 1},
+		{"On to the next week", "FREQ=WEEKLY;BYDAY=MO,TH", "2024-07-04 09:00", "", "2024-07-08 09:00", 1},
+		{"Every other week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "2024-07-04 09:00", "", "2024-07-15 09:00", 1},
+		{"Weeks starting on Sunday", "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,MO;WKST=SU", "2024-07-01 09:00", "", "2024-07-14 09:00", 1},
+		{"Monthly on the day of the start", "FREQ=MONTHLY", "2024-01-15 09:00", "", "2024-02-15 09:00", 1},
+		{"Months without the day are skipped", "FREQ=MONTHLY", "2024-01-31 09:00", "", "2024-03-31 09:00", 1},
+		{"Last day of the month", "FREQ=MONTHLY;BYMONTHDAY=-1", "2024-01-31 09:00", "", "2024-02-29 09:00", 1},
+		{"Last Friday of the month", "FREQ=MONTHLY;BYDAY=-1FR", "2024-01-26 17:00", "", "2024-02-23 17:00", 1},
+		{"Second Tuesday of the month", "FREQ=MONTHLY;BYDAY=2TU", "2024-07-09 10:00", "", "2024-08-13 10:00", 1},
+		{"Every quarter", "FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=1", "2024-01-01 08:00", "", "2024-04-01 08:00", 1},
+		{"Yearly", "FREQ=YEARLY", "2024-07-04 12:00", "", "2025-07-04 12:00", 1},
+		{"Leap day", "FREQ=YEARLY", "2024-02-29 12:00", "", "2028-02-29 12:00", 1},
+		{"Thanksgiving", "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", "2024-11-28 12:00", "", "2025-11-27 12:00", 1},
+		{"Last Monday of the year", "FREQ=YEARLY;BYDAY=-1MO", "2024-12-30 12:00", "", "2025-12-29 12:00", 1},
+		{"Catching up with a late completion", "FREQ=DAILY", "2024-07-01 09:00", "2024-07-10 10:00", "2024-07-11 09:00", 10},
+		{"Count left", "FREQ=DAILY;COUNT=3", "2024-07-01 09:00", "2024-07-01 12:00", "2024-07-02 09:00", 1},
+		{"Until the end of the day", "FREQ=DAILY;UNTIL=20240702", "2024-07-01 09:00", "", "2024-07-02 09:00", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRecurrence(tt.rule)
+			require.NoError(t, err)
+			start, after := at(tt.start), at(tt.start)
+			if tt.after != "" {
+				after = at(tt.after)
+			}
+
+			next, passed, ok := r.Next(start, after)
+			require.True(t, ok)
+			assert.Equal(t, at(tt.next), next)
+			assert.Equal(t, tt.passed, passed)
+		})
+	}
+
+	t.Run("Run out", func(t *testing.T) {
+		for _, tt := range []struct{ rule, start, after string }{
+			{"FREQ=DAILY;COUNT=3", "2024-07-01 09:00", "2024-07-03 09:00"},
+			{"FREQ=DAILY;UNTIL=20240702T120000Z", "2024-07-01 09:00", "2024-07-02 09:00"},
+			{"FREQ=DAILY;UNTIL=20240702T080000", "2024-07-01 09:00", "2024-07-01 09:00"},
+			{"FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30", "2024-01-30 09:00", "2024-01-30 09:00"},
+		} {
+			r, err := ParseRecurrence(tt.rule)
+			require.NoError(t, err)
+			_, _, ok := r.Next(at(tt.start), at(tt.after))
+			assert.False(t, ok, tt.rule)
+		}
+	})
+
+	t.Run("Daylight saving time", func(t *testing.T) {
+		r, err := ParseRecurrence("FREQ=DAILY")
+		require.NoError(t, err)
+
+		// the wall clock time is kept, so the time in UTC moves by an hour
+		next, _, ok := r.Next(at("2024-03-09 09:00"), at("2024-03-09 09:00"))
+		require.True(t, ok)
+		assert.Equal(t, "2024-03-10T09:00:00-04:00", next.Format(time.RFC3339))
+		assert.Equal(t, 23*time.Hour, next.Sub(at("2024-03-09 09:00")))
+		next, _, ok = r.Next(at("2024-11-02 09:00"), at("2024-11-02 09:00"))
+		require.True(t, ok)
+		assert.Equal(t, "2024-11-03T09:00:00-05:00", next.Format(time.RFC3339))
+
+		// 02:30 does not exist on the day the clocks go forward
+		next, _, ok = r.Next(at("2024-03-09 02:30"), at("2024-03-09 02:30"))
+		require.True(t, ok)
+		assert.Equal(t, "2024-03-10T03:30:00-04:00", next.Format(time.RFC3339))
+	})
+}
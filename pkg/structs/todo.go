@@ -1,16 +1,336 @@
 package structs
 
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
 type TodoItem struct {
-	Id    string `json:"id" validate:"uuid4_or_empty"`
-	Item  string `json:"item" validate:"required"`
-	Order int    `json:"order" validate:"required,min=1"`
+	Id     string `json:"id" validate:"uuid4_or_empty"`
+	ListId string `json:"listId"`
+	// ParentId is the item this one is a sub-task of, in the same list, and
+	// is only changed through the parent endpoints once the item exists.
+	ParentId string `json:"parentId,omitempty"`
+	Item     string `json:"item" validate:"required"`
+	// Notes are Markdown, see NotesHTML.
+	Notes string `json:"notes,omitempty" validate:"max=10000"`
+	// NotesHTML is only set when the notes are asked for rendered, and is
+	// never stored.
+	NotesHTML string `json:"notesHtml,omitempty"`
+	Order     int    `json:"order" validate:"omitempty,min=1"`
+	// Done and CompletedAt are only changed through the complete and
+	// uncomplete endpoints.
+	Done        bool       `json:"done"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// DueAt is stored in UTC, to the second.
+	DueAt    *time.Time `json:"dueAt,omitempty" validate:"required_with=Recurrence"`
+	Priority Priority   `json:"priority,omitempty" validate:"omitempty,oneof=low medium high"`
+	// Recurrence is an RRULE, see ParseRecurrence, which needs a due date:
+	// completing the item adds its next occurrence, due at the next date of
+	// the rule in TimeZone.
+	Recurrence string `json:"recurrence,omitempty" validate:"omitempty,rrule"`
+	// TimeZone is the IANA zone the recurrence is worked out in, so it keeps
+	// its wall clock time across daylight saving changes. UTC when empty.
+	TimeZone string `json:"timeZone,omitempty" validate:"omitempty,iana_timezone"`
+	// NextId is the next occurrence that completing a recurring item added,
+	// only set in the response to the completion and never stored.
+	NextId string `json:"nextId,omitempty"`
+	// Tags are only changed through the tag endpoints, sorted by name.
+	Tags []string `json:"tags,omitempty"`
+	// BlockedBy are the items this one cannot start before, and are only
+	// changed through the blocker endpoints. Blocked is set while any of them
+	// is open. Neither is stored.
+	Blocked   bool     `json:"blocked"`
+	BlockedBy []string `json:"blockedBy,omitempty"`
+	// Version is bumped on every write to the item, along with UpdatedAt.
+	// All three are set by the store, whatever the client sends.
+	Version   int        `json:"version"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// DeletedAt is only set on the items in the trash, whose Order is the
+	// position they had.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// Priority is the level of an item, none when empty.
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityMedium Priority = "medium"
+	PriorityHigh   Priority = "high"
+)
+
+// In renders the times of the item in loc.
+func (i *TodoItem) In(loc *time.Location) {
+	if i.CompletedAt != nil {
+		completedAt := i.CompletedAt.In(loc)
+		i.CompletedAt = &completedAt
+	}
+	if i.DueAt != nil {
+		dueAt := i.DueAt.In(loc)
+		i.DueAt = &dueAt
+	}
+	if i.CreatedAt != nil {
+		createdAt := i.CreatedAt.In(loc)
+		i.CreatedAt = &createdAt
+	}
+	if i.UpdatedAt != nil {
+		updatedAt := i.UpdatedAt.In(loc)
+		i.UpdatedAt = &updatedAt
+	}
+	if i.DeletedAt != nil {
+		deletedAt := i.DeletedAt.In(loc)
+		i.DeletedAt = &deletedAt
+	}
 }
 
+// TodoItemList holds the items of a list, or a page of them. Count is the
+// number of items of every page, and Next and Prev are the cursors of the
+// pages after and before this one, when there are any.
 type TodoItemList struct {
 	Items []TodoItem `json:"items"`
 	Count int        `json:"count"`
+	Next  string     `json:"next,omitempty"`
+	Prev  string     `json:"prev,omitempty"`
+}
+
+// In renders the times of every item in loc.
+func (l *TodoItemList) In(loc *time.Location) {
+	for i := range l.Items {
+		l.Items[i].In(loc)
+	}
+}
+
+// TodoItemNode is an item along with its sub-tasks.
+type TodoItemNode struct {
+	TodoItem
+	Subtasks []TodoItemNode `json:"subtasks,omitempty"`
+}
+
+// TodoItemTree holds the top-level items of a list, Count counts every item
+// in the tree, or of every page of it like in TodoItemList.
+type TodoItemTree struct {
+	Items []TodoItemNode `json:"items"`
+	Count int            `json:"count"`
+	Next  string         `json:"next,omitempty"`
+	Prev  string         `json:"prev,omitempty"`
+}
+
+// Tree nests the sub-tasks of the items under them. Siblings are sorted by
+// order, with the items that have none last, and items whose parent is not in
+// the list become top-level ones.
+func (l *TodoItemList) Tree() TodoItemTree {
+	listed := make(map[string]bool, len(l.Items))
+	for _, item := range l.Items {
+		listed[item.Id] = true
+	}
+	children := map[string][]TodoItem{}
+	for _, item := range l.Items {
+		parentId := item.ParentId
+		if !listed[parentId] {
+			parentId = ""
+		}
+		children[parentId] = append(children[parentId], item)
+	}
+
+	var nodes func(parentId string) []TodoItemNode
+	nodes = func(parentId string) []TodoItemNode {
+		items := children[parentId]
+		sort.SliceStable(items, func(i, j int) bool {
+			if items[i].Order == 0 || items[j].Order == 0 {
+				return items[j].Order == 0 && items[i].Order != 0
+			}
+			return items[i].Order < items[j].Order
+		})
+		result := make([]TodoItemNode, 0, len(items))
+		for _, item := range items {
+			result = append(result, TodoItemNode{TodoItem: item, Subtasks: nodes(item.Id)})
+		}
+		return result
+	}
+	return TodoItemTree{Items: nodes(""), Count: l.Count, Next: l.Next, Prev: l.Prev}
+}
+
+// ItemQuery narrows down the items of a list, the zero value selects them all.
+type ItemQuery struct {
+	// DueBefore selects the items due before then.
+	DueBefore *time.Time
+	// Overdue selects the open items that were due before now.
+	Overdue bool
+	// Tag selects the items tagged with it.
+	Tag string `validate:"omitempty,tag_name"`
+	// Priority selects the items of that level.
+	Priority Priority `validate:"omitempty,oneof=low medium high"`
+	// Limit is the most items a page has, there is a single page when it is
+	// 0. Pages are sorted by parent, by order with the items without one
+	// last, and by id.
+	Limit int `validate:"omitempty,min=1,max=1000"`
+	// Cursor is where the page starts, or ends when it goes backward. The
+	// first page has none.
+	Cursor *Cursor
+}
+
+// Cursor is the position of an item in the pages of a list, which are
+// sorted by parent, by order and by id; an Order of 0 is an item without
+// one. The page it points to starts right after the item, or ends right
+// before it when it is Backward. Clients only get it as an opaque string.
+type Cursor struct {
+	ParentId string `json:"p,omitempty"`
+	Order    int    `json:"o"`
+	Id       string `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+func (c Cursor) String() string {
+	encoded, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// ParseCursor reads a cursor from its String form.
+func ParseCursor(value string) (*Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(decoded, &cursor); err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// Tag is one of the tags of a user, with the number of items tagged with it.
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type Tags struct {
+	Items []Tag `json:"items"`
+	Count int   `json:"count"`
 }
 
 type ReorderRequest struct {
 	Order int `json:"order" validate:"required,min=1"`
 }
+
+// Direction is where a RelativeMove takes an item on its own.
+type Direction string
+
+const (
+	DirectionTop    Direction = "top"
+	DirectionBottom Direction = "bottom"
+	DirectionUp     Direction = "up"
+	DirectionDown   Direction = "down"
+)
+
+// RelativeMove moves an item among its siblings without knowing their
+// orders: in one Direction, right before or after another item, or in its
+// place, which the other item takes in turn. Only one of them is set. It is
+// sent either as a bare direction, like "top", or as an object.
+type RelativeMove struct {
+	Direction Direction `json:"direction,omitempty" validate:"omitempty,oneof=top bottom up down"`
+	Before    string    `json:"before,omitempty"`
+	After     string    `json:"after,omitempty"`
+	SwapWith  string    `json:"swapWith,omitempty"`
+}
+
+func (m *RelativeMove) UnmarshalJSON(data []byte) error {
+	var direction Direction
+	if err := json.Unmarshal(data, &direction); err == nil {
+		*m = RelativeMove{Direction: direction}
+		return nil
+	}
+	// without the method, so as not to come back here
+	type relativeMove RelativeMove
+	return json.Unmarshal(data, (*relativeMove)(m))
+}
+
+// OrderRequest puts the sub-tasks of ParentId, or the top-level items when it
+// is empty, in the order of Ids.
+type OrderRequest struct {
+	ParentId string   `json:"parentId,omitempty"`
+	Ids      []string `json:"ids" validate:"unique"`
+}
+
+// OrderConflict tells how the items of an OrderRequest differ from those that
+// are there.
+type OrderConflict struct {
+	Missing    []string `json:"missing"`
+	Unexpected []string `json:"unexpected"`
+}
+
+// BulkOp is what a BulkOperation does.
+type BulkOp string
+
+const (
+	BulkCreate BulkOp = "create"
+	BulkUpdate BulkOp = "update"
+	BulkDelete BulkOp = "delete"
+	BulkMove   BulkOp = "move"
+)
+
+// BulkOperation is one of the operations of a BulkRequest: it creates Item,
+// updates the item with Id to Item, deletes it, or moves it to Order in
+// ListId, or in its own list when ListId is empty.
+type BulkOperation struct {
+	Op     BulkOp    `json:"op" validate:"oneof=create update delete move"`
+	Id     string    `json:"id,omitempty" validate:"required_unless=Op create"`
+	Item   *TodoItem `json:"item,omitempty" validate:"required_if=Op create,required_if=Op update"`
+	ListId string    `json:"listId,omitempty"`
+	Order  int       `json:"order,omitempty" validate:"omitempty,min=1"`
+}
+
+// BulkRequest applies its operations in order, all of them or none.
+type BulkRequest struct {
+	Operations []BulkOperation `json:"operations" validate:"max=1000"`
+}
+
+// BulkResult is the outcome of one operation of a BulkRequest, with the
+// status it would have had on its own: the item as the operation left it, or
+// the error it failed with.
+type BulkResult struct {
+	Status int       `json:"status"`
+	Item   *TodoItem `json:"item,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// BulkResponse has a result for every operation of a BulkRequest. When one
+// of them failed, Failed is its index and the others are not applied.
+type BulkResponse struct {
+	Results []BulkResult `json:"results"`
+	Failed  *int         `json:"failed,omitempty"`
+}
+
+type MoveRequest struct {
+	ListId string `json:"listId" validate:"required"`
+	Order  int    `json:"order" validate:"omitempty,min=1"`
+}
+
+// ParentRequest makes an item a sub-task of ParentId, or a top-level item
+// when it is empty.
+type ParentRequest struct {
+	ParentId string `json:"parentId"`
+	Order    int    `json:"order" validate:"omitempty,min=1"`
+}
+
+// RestoreRequest puts an item back from the trash at Order, or at the
+// position it had when it is 0.
+type RestoreRequest struct {
+	Order int `json:"order" validate:"omitempty,min=1"`
+}
+
+type List struct {
+	Id    string `json:"id" validate:"uuid4_or_empty"`
+	Name  string `json:"name" validate:"required"`
+	Order int    `json:"order" validate:"omitempty,min=1"`
+}
+
+type Lists struct {
+	Items []List `json:"items"`
+	Count int    `json:"count"`
+}
@@ -1,15 +1,23 @@
 package structs
 
 import (
+	"regexp"
+	"time"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 )
 
 var validate *validator.Validate
 
+var tagName = regexp.MustCompile(`^[\p{Ll}\p{Nd}_-]{1,40}$`)
+
 func init() {
 	validate = validator.New()
 	validate.RegisterValidation("uuid4_or_empty", validateUUID4rEmpty)
+	validate.RegisterValidation("iana_timezone", validateIANATimeZone)
+	validate.RegisterValidation("tag_name", validateTagName)
+	validate.RegisterValidation("rrule", validateRecurrence)
 }
 
 func validateUUID4rEmpty(fl validator.FieldLevel) bool {
@@ -21,6 +29,34 @@ func validateUUID4rEmpty(fl validator.FieldLevel) bool {
 	return err == nil
 }
 
+// validateIANATimeZone accepts the names of the IANA time zone database, like
+// "Europe/Athens" or "UTC". Unlike the timezone tag it rejects "Local", the
+// zone of the server means nothing to its clients.
+func validateIANATimeZone(fl validator.FieldLevel) bool {
+	name := fl.Field().String()
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// validateTagName accepts lower-case tags of up to 40 letters, digits, dashes
+// and underscores, so they read the same in a path and in a query.
+func validateTagName(fl validator.FieldLevel) bool {
+	return tagName.MatchString(fl.Field().String())
+}
+
+// validateRecurrence accepts the recurrence rules ParseRecurrence does.
+func validateRecurrence(fl validator.FieldLevel) bool {
+	_, err := ParseRecurrence(fl.Field().String())
+	return err == nil
+}
+
 func ValidateStruct(s interface{}) error {
 	return validate.Struct(s)
 }
+
+func ValidateVar(field interface{}, tag string) error {
+	return validate.Var(field, tag)
+}
@@ -1,6 +1,7 @@
 package structs
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,3 +34,55 @@ func TestValidateUUID4rEmpty(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateIANATimeZone(t *testing.T) {
+	tests := []struct {
+		name    string
+		zone    string
+		isValid bool
+	}{
+		{"Zone name", "Europe/Athens", true},
+		{"UTC", "UTC", true},
+		{"Server zone", "Local", false},
+		{"Unknown zone", "Mars/Olympus_Mons", false},
+		{"Empty zone", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateVar(tt.zone, "iana_timezone")
+			if tt.isValid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateTagName(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		isValid bool
+	}{
+		{"Word", "home", true},
+		{"Dashes and digits", "q3-report_2", true},
+		{"Non-ASCII letters", "σπίτι", true},
+		{"Upper case", "Home", false},
+		{"Spaces", "at home", false},
+		{"Empty", "", false},
+		{"Too long", strings.Repeat("a", 41), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateVar(tt.tag, "tag_name")
+			if tt.isValid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package todolist
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+// AttachmentField is the form field of the multipart request the file to
+// attach is sent in.
+const AttachmentField = "file"
+
+func (h *ItemsHandlers) configureAttachmentRoutes(r chi.Router) {
+	r.Post("/", h.createAttachment)
+	r.Get("/", h.listAttachments)
+	r.Get("/{attachmentId}", h.getAttachment)
+	r.Delete("/{attachmentId}", h.deleteAttachment)
+}
+
+// attachmentErrorStatus is errorStatus, along with the status of attachments
+// that are too large.
+func attachmentErrorStatus(err error) int {
+	if store.IsTooLarge(err) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return errorStatus(err)
+}
+
+// contentType is the media type of an uploaded file: the one it was sent with,
+// or else the one of its extension, or else the one its first bytes suggest.
+func contentType(part *multipart.Part, content *bufio.Reader) string {
+	if sent := part.Header.Get("Content-Type"); sent != "" && sent != "application/octet-stream" {
+		return sent
+	}
+	if byExtension := mime.TypeByExtension(filepath.Ext(part.FileName())); byExtension != "" {
+		return byExtension
+	}
+	head, _ := content.Peek(512)
+	return http.DetectContentType(head)
+}
+
+func (h *ItemsHandlers) createAttachment(w http.ResponseWriter, r *http.Request) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expected a multipart form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the content is streamed to disk, so the file is the only part read
+	var part *multipart.Part
+	for {
+		part, err = reader.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("no " + AttachmentField + " field")
+			}
+			http.Error(w, "Invalid form: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if part.FormName() == AttachmentField {
+			break
+		}
+	}
+	defer part.Close()
+
+	content := bufio.NewReader(part)
+	attachment := structs.Attachment{Name: part.FileName(), ContentType: contentType(part, content)}
+	err = structs.ValidateStruct(&attachment)
+	if err == nil {
+		_, _, err = mime.ParseMediaType(attachment.ContentType)
+	}
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.AttachmentsService.AddAttachment(r.Context(), listIdParam(r), chi.URLParam(r, "id"), &attachment, content)
+	if err != nil {
+		http.Error(w, "Failed to attach: "+err.Error(), attachmentErrorStatus(err))
+		return
+	}
+
+	attachment.In(location(r))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(attachment)
+}
+
+func (h *ItemsHandlers) listAttachments(w http.ResponseWriter, r *http.Request) {
+	attachments, err := h.AttachmentsService.ListAttachments(r.Context(), listIdParam(r), chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Failed", errorStatus(err))
+		return
+	}
+
+	attachments.In(location(r))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(attachments)
+}
+
+// getAttachment answers with the content of an attachment, in whole or in the
+// ranges asked for.
+func (h *ItemsHandlers) getAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment, content, err := h.AttachmentsService.OpenAttachment(r.Context(), listIdParam(r), chi.URLParam(r, "id"), chi.URLParam(r, "attachmentId"))
+	if err != nil {
+		http.Error(w, "Failed", errorStatus(err))
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// the content of an attachment never changes
+	w.Header().Set("ETag", `"`+attachment.Digest+`"`)
+	http.ServeContent(w, r, attachment.Name, *attachment.CreatedAt, content)
+}
+
+func (h *ItemsHandlers) deleteAttachment(w http.ResponseWriter, r *http.Request) {
+	err := h.AttachmentsService.DeleteAttachment(r.Context(), listIdParam(r), chi.URLParam(r, "id"), chi.URLParam(r, "attachmentId"))
+	if err != nil {
+		http.Error(w, "Failed to delete", errorStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
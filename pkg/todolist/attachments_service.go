@@ -0,0 +1,111 @@
+package todolist
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+type AttachmentsService interface {
+	// AddAttachment stores content as a new attachment of an item. Content
+	// over the size limit, or that would take the user over their quota, is
+	// rejected with a store.TooLargeError.
+	AddAttachment(ctx context.Context, listId string, itemId string, def *structs.Attachment, content io.Reader) error
+	ListAttachments(ctx context.Context, listId string, itemId string) (structs.Attachments, error)
+	// OpenAttachment returns an attachment along with its content, which the
+	// caller closes.
+	OpenAttachment(ctx context.Context, listId string, itemId string, id string) (*structs.Attachment, *os.File, error)
+	// DeleteAttachment removes an attachment. Its content is removed later,
+	// unless another attachment uses it.
+	DeleteAttachment(ctx context.Context, listId string, itemId string, id string) error
+}
+
+// NewAttachmentsService returns an AttachmentsService that keeps the content
+// of the attachments in blobs. Attachments are limited to maxSize bytes, and
+// those of a user to quota bytes in total.
+func NewAttachmentsService(s store.Store, blobs *store.Blobs, maxSize int64, quota int64) AttachmentsService {
+	return &attachmentsServiceImpl{
+		store:   s,
+		blobs:   blobs,
+		maxSize: maxSize,
+		quota:   quota,
+	}
+}
+
+type attachmentsServiceImpl struct {
+	store   store.Store
+	blobs   *store.Blobs
+	maxSize int64
+	quota   int64
+}
+
+func (s *attachmentsServiceImpl) AddAttachment(ctx context.Context, listId string, itemId string, def *structs.Attachment, content io.Reader) error {
+	// no need to store content for an item that does not exist
+	err := s.store.Update(func(tx store.Txn) error {
+		return getInList(ctx, tx, listId, itemId, &structs.TodoItem{})
+	})
+	if err != nil {
+		return err
+	}
+
+	// content that ends up unused is collected, see store.CollectBlobsEvery
+	digest, size, err := s.blobs.Put(content, s.maxSize)
+	if err != nil {
+		return err
+	}
+	def.ItemId, def.Digest, def.Size = itemId, digest, size
+	return s.store.Update(func(tx store.Txn) error {
+		if err := getInList(ctx, tx, listId, itemId, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		used, err := tx.AttachmentsSize(ctx)
+		if err != nil {
+			return err
+		}
+		if used+size > s.quota {
+			return store.TooLargef("attachments are limited to %d bytes per user, %d are used", s.quota, used)
+		}
+		return tx.AddAttachment(ctx, def)
+	})
+}
+
+func (s *attachmentsServiceImpl) ListAttachments(ctx context.Context, listId string, itemId string) (structs.Attachments, error) {
+	var result structs.Attachments
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := getInList(ctx, tx, listId, itemId, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		return tx.ListAttachments(ctx, itemId, &result)
+	})
+	return result, err
+}
+
+func (s *attachmentsServiceImpl) OpenAttachment(ctx context.Context, listId string, itemId string, id string) (*structs.Attachment, *os.File, error) {
+	var result structs.Attachment
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := getInList(ctx, tx, listId, itemId, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		return tx.GetAttachment(ctx, itemId, id, &result)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	content, err := s.blobs.Open(result.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &result, content, nil
+}
+
+func (s *attachmentsServiceImpl) DeleteAttachment(ctx context.Context, listId string, itemId string, id string) error {
+	return s.store.Update(func(tx store.Txn) error {
+		if err := getInList(ctx, tx, listId, itemId, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		return tx.DeleteAttachment(ctx, itemId, id)
+	})
+}
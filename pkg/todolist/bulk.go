@@ -0,0 +1,75 @@
+package todolist
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+// BulkError is returned when an operation of a bulk request fails, in which
+// case none of them is applied.
+type BulkError struct {
+	// Index is the index of the operation that failed.
+	Index int
+	Err   error
+}
+
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("operation %d failed: %v", e.Index, e.Err)
+}
+
+func (e *BulkError) Unwrap() error {
+	return e.Err
+}
+
+// bulkStatus is the status of a successful operation of a bulk request, the
+// one of the endpoint of the same operation.
+var bulkStatus = map[structs.BulkOp]int{
+	structs.BulkCreate: http.StatusAccepted,
+	structs.BulkUpdate: http.StatusAccepted,
+	structs.BulkDelete: http.StatusOK,
+	structs.BulkMove:   http.StatusAccepted,
+}
+
+// applyOperation applies an operation of a bulk request to the items of a
+// list, and returns the item as the operation left it in result, or as it
+// was for a deletion.
+func applyOperation(ctx context.Context, tx store.Txn, listId string, operation structs.BulkOperation, result *structs.TodoItem) error {
+	switch operation.Op {
+	case structs.BulkCreate:
+		*result = *operation.Item
+		result.ListId = listId
+		return tx.Add(ctx, result)
+	case structs.BulkUpdate:
+		if err := getInList(ctx, tx, listId, operation.Id, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		item := *operation.Item
+		item.Id = operation.Id
+		if err := tx.Update(ctx, &item); err != nil {
+			return err
+		}
+	case structs.BulkDelete:
+		if err := getInList(ctx, tx, listId, operation.Id, result); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, operation.Id, &structs.TodoItemList{})
+	case structs.BulkMove:
+		if err := getInList(ctx, tx, listId, operation.Id, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		toListId := operation.ListId
+		if toListId == "" {
+			toListId = listId
+		}
+		if err := tx.MoveItem(ctx, operation.Id, toListId, operation.Order); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", operation.Op)
+	}
+	return tx.Get(ctx, operation.Id, result)
+}
@@ -0,0 +1,71 @@
+package todolist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// PreconditionFailedError is returned for writes made with an If-Match that
+// no longer matches the item, e.g. from a stale tab.
+type PreconditionFailedError struct {
+	id string
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return fmt.Sprintf("item %s has changed in the meantime", e.id)
+}
+
+// itemETag is the entity tag of an item: its version, which every write to it
+// bumps, along with a digest of its id and creation time, as an id is free to
+// be used again once its item is discarded and the version starts over. It is
+// the same however the item is rendered.
+func itemETag(item *structs.TodoItem) string {
+	var createdAt int64
+	if item.CreatedAt != nil {
+		createdAt = item.CreatedAt.UnixNano()
+	}
+	sum := sha256.Sum256([]byte(item.Id + "/" + strconv.FormatInt(createdAt, 10)))
+	return strconv.Quote(strconv.Itoa(item.Version) + "-" + hex.EncodeToString(sum[:8]))
+}
+
+// listETag is the entity tag of a list of items, taken from the encoded body
+// since the order of the items changes without bumping their versions.
+func listETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return strconv.Quote(hex.EncodeToString(sum[:16]))
+}
+
+// ifMatch returns the entity tags of the If-Match header of r, nil when there
+// is none.
+func ifMatch(r *http.Request) []string {
+	var tags []string
+	for _, value := range r.Header.Values("If-Match") {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// checkIfMatch fails unless the item matches one of the tags, or there are
+// none. Weak tags never match, as If-Match compares strongly.
+func checkIfMatch(tags []string, item *structs.TodoItem) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	etag := itemETag(item)
+	for _, tag := range tags {
+		if tag == "*" || tag == etag {
+			return nil
+		}
+	}
+	return &PreconditionFailedError{id: item.Id}
+}
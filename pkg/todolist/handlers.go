@@ -1,33 +1,154 @@
 package todolist
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
 )
 
 const (
 	MediaTypeJSON = "application/json"
+	// MediaTypeMergePatch is the media type of RFC 7386 merge patches.
+	MediaTypeMergePatch = "application/merge-patch+json"
 )
 
 type ItemsHandlers struct {
 	ItemsService ItemsService
+	ListsService ListsService
+	// AttachmentsService serves the attachments of the items, which are not
+	// served without it.
+	AttachmentsService AttachmentsService
 }
 
 func (h *ItemsHandlers) ConfigureRoutes(r chi.Router) {
-	r.Route("/todolist", func(r chi.Router) {
-		r.Post("/", h.createItem)
-		r.Get("/", h.listItems)
-
-		r.Route("/{id}", func(r chi.Router) {
-			r.Get("/", h.getItem)
-			r.Put("/", h.updateItem)
-			r.Delete("/", h.deleteItem)
-			r.Put("/reorder", h.reorderItem)
+	// the items of the default list
+	r.Route("/todolist", h.configureItemRoutes)
+
+	r.Route("/lists", func(r chi.Router) {
+		r.Post("/", h.createList)
+		r.Get("/", h.listLists)
+
+		r.Route("/{listId}", func(r chi.Router) {
+			r.Get("/", h.getList)
+			r.Put("/", h.updateList)
+			r.Delete("/", h.deleteList)
+			r.Put("/reorder", h.reorderList)
+			r.Route("/items", h.configureItemRoutes)
 		})
 	})
+
+	r.Get("/tags", h.listTags)
+
+	r.Route("/trash", func(r chi.Router) {
+		r.Use(timeZone)
+		r.Get("/", h.listTrash)
+		r.Post("/{id}/restore", h.restoreItem)
+	})
+}
+
+func (h *ItemsHandlers) configureItemRoutes(r chi.Router) {
+	r.Use(timeZone)
+	r.Post("/", h.createItem)
+	r.Get("/", h.listItems)
+	r.Put("/order", h.arrangeItems)
+	r.Post("/bulk", h.bulk)
+	r.Post("/topological-sort", h.sortByBlockers)
+
+	r.Route("/{id}", func(r chi.Router) {
+		r.Get("/", h.getItem)
+		r.Put("/", h.updateItem)
+		r.Patch("/", h.patchItem)
+		r.Delete("/", h.deleteItem)
+		r.Put("/reorder", h.reorderItem)
+		r.Put("/move", h.moveItem)
+		r.Post("/move", h.moveItemRelative)
+		r.Put("/parent", h.reparentItem)
+		r.Put("/indent", h.indentItem)
+		r.Put("/outdent", h.outdentItem)
+		r.Post("/complete", h.completeItem)
+		r.Post("/uncomplete", h.uncompleteItem)
+		r.Put("/tags/{tag}", h.tagItem)
+		r.Delete("/tags/{tag}", h.untagItem)
+		r.Put("/blockers/{blockerId}", h.blockItem)
+		r.Delete("/blockers/{blockerId}", h.unblockItem)
+		if h.AttachmentsService != nil {
+			r.Route("/attachments", h.configureAttachmentRoutes)
+		}
+	})
+}
+
+// listIdParam returns the list the items are addressed through, the default
+// one for the /todolist routes.
+func listIdParam(r *http.Request) string {
+	if listId := chi.URLParam(r, "listId"); listId != "" {
+		return listId
+	}
+	return store.DefaultListId
+}
+
+// itemQuery reads the filters of a list of items and the page of them.
+// due_before is either a point in time or a date, which starts at midnight in
+// the request's zone.
+func itemQuery(r *http.Request) (structs.ItemQuery, error) {
+	var query structs.ItemQuery
+	if dueBefore := r.URL.Query().Get("due_before"); dueBefore != "" {
+		t, err := time.Parse(time.RFC3339, dueBefore)
+		if err != nil {
+			t, err = time.ParseInLocation(time.DateOnly, dueBefore, location(r))
+			if err != nil {
+				return query, err
+			}
+		}
+		query.DueBefore = &t
+	}
+	if overdue := r.URL.Query().Get("overdue"); overdue != "" {
+		var err error
+		query.Overdue, err = strconv.ParseBool(overdue)
+		if err != nil {
+			return query, err
+		}
+	}
+	query.Tag = strings.ToLower(r.URL.Query().Get("tag"))
+	query.Priority = structs.Priority(r.URL.Query().Get("priority"))
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		var err error
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return query, err
+		}
+	}
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		var err error
+		query.Cursor, err = structs.ParseCursor(cursor)
+		if err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+// errorStatus is the status of a response to a failed request: 404 for ids
+// that are unknown to the user, whether they exist for someone else or not,
+// and 412 for writes to items that changed since the client read them.
+func errorStatus(err error) int {
+	if store.IsNotFound(err) {
+		return http.StatusNotFound
+	}
+	var preconditionFailed *PreconditionFailedError
+	if errors.As(err, &preconditionFailed) {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusBadRequest
 }
 
 func requestAs(r *http.Request, v interface{}) error {
@@ -56,36 +177,82 @@ func (h *ItemsHandlers) createItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.ItemsService.AddItem(r.Context(), &item)
+	recurIn(r, &item)
+	err = h.ItemsService.AddItem(r.Context(), listIdParam(r), &item)
 	if err != nil {
 		// return the actual err message
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), errorStatus(err))
 		return
 	}
 
+	// respond with the item, its ID and order may have been assigned
+	item.In(location(r))
+	w.Header().Set("ETag", itemETag(&item))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(item)
 }
 
 func (h *ItemsHandlers) listItems(w http.ResponseWriter, r *http.Request) {
-	items, err := h.ItemsService.ListItems(r.Context())
+	query, err := itemQuery(r)
 	if err != nil {
-		http.Error(w, "Failed", http.StatusBadRequest)
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = structs.ValidateStruct(&query)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tree := false
+	if param := r.URL.Query().Get("tree"); param != "" {
+		tree, err = strconv.ParseBool(param)
+		if err != nil {
+			http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	items, err := h.ItemsService.ListItems(r.Context(), listIdParam(r), query)
+	if err != nil {
+		http.Error(w, "Failed", errorStatus(err))
+		return
+	}
+	items.In(location(r))
+
+	var body bytes.Buffer
+	if tree {
+		// the sub-tasks nested under their items
+		err = json.NewEncoder(&body).Encode(items.Tree())
+	} else {
+		err = json.NewEncoder(&body).Encode(items)
+	}
+	if err != nil {
+		http.Error(w, "Failed", http.StatusInternalServerError)
 		return
 	}
 
+	w.Header().Set("ETag", listETag(body.Bytes()))
 	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(items)
+	_, _ = w.Write(body.Bytes())
 }
 
 func (h *ItemsHandlers) deleteItem(w http.ResponseWriter, r *http.Request) {
 	deploymentId := chi.URLParam(r, "id")
-	err := h.ItemsService.DeleteItem(r.Context(), deploymentId)
+	shifted, err := h.ItemsService.DeleteItem(r.Context(), listIdParam(r), deploymentId, ifMatch(r))
 	if err != nil {
-		http.Error(w, "Failed to delete", http.StatusBadRequest)
+		http.Error(w, "Failed to delete", errorStatus(err))
 		return
 	}
-	w.WriteHeader(http.StatusNoContent)
+
+	// respond with the items that moved up to close the gap
+	shifted.In(location(r))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(shifted)
 }
 
 func (h *ItemsHandlers) updateItem(w http.ResponseWriter, r *http.Request) {
@@ -100,24 +267,95 @@ func (h *ItemsHandlers) updateItem(w http.ResponseWriter, r *http.Request) {
 
 	item.Id = deploymentId
 
-	err = h.ItemsService.UpdateItem(r.Context(), &item)
+	err = structs.ValidateStruct(&item)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recurIn(r, &item)
+	err = h.ItemsService.UpdateItem(r.Context(), listIdParam(r), &item, ifMatch(r))
 	if err != nil {
-		http.Error(w, "Failed to update", http.StatusBadRequest)
+		http.Error(w, "Failed to update", errorStatus(err))
 		return
 	}
 
+	// the new version, for the next write
+	w.Header().Set("ETag", itemETag(&item))
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// patchItem changes the fields of an item an RFC 7386 merge patch names, and
+// responds with the item. The item is validated as it is after the patch.
+func (h *ItemsHandlers) patchItem(w http.ResponseWriter, r *http.Request) {
+	// JSON by default, like the other requests
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "" && mediaType != MediaTypeMergePatch && mediaType != MediaTypeJSON {
+		w.Header().Set("Accept-Patch", MediaTypeMergePatch)
+		http.Error(w, "Patches are merge patches", http.StatusUnsupportedMediaType)
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if err := checkMergePatch(patch); err != nil {
+		http.Error(w, "Invalid patch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var invalid error
+	item, err := h.ItemsService.PatchItem(r.Context(), listIdParam(r), chi.URLParam(r, "id"), func(item *structs.TodoItem) error {
+		if err := applyMergePatch(item, patch); err != nil {
+			return err
+		}
+		if invalid = structs.ValidateStruct(item); invalid != nil {
+			return invalid
+		}
+		recurIn(r, item)
+		return nil
+	}, ifMatch(r))
+	if invalid != nil {
+		http.Error(w, "Validation failed: "+invalid.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to patch item: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	item.In(location(r))
+	w.Header().Set("ETag", itemETag(item))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(item)
+}
+
 func (h *ItemsHandlers) getItem(w http.ResponseWriter, r *http.Request) {
 	deploymentId := chi.URLParam(r, "id")
 
-	deployment, err := h.ItemsService.GetItem(r.Context(), deploymentId)
+	// the notes are Markdown unless asked for rendered
+	render := r.URL.Query().Get("render")
+	if render != "" && render != "html" {
+		http.Error(w, "Unknown rendering "+strconv.Quote(render), http.StatusBadRequest)
+		return
+	}
+
+	deployment, err := h.ItemsService.GetItem(r.Context(), listIdParam(r), deploymentId)
 	if err != nil {
-		http.Error(w, "Failed to get an item with this ID", http.StatusBadRequest)
+		http.Error(w, "Failed to get an item with this ID", errorStatus(err))
 		return
 	}
+	if render == "html" {
+		if err := renderNotes(deployment); err != nil {
+			http.Error(w, "Failed to render the notes", http.StatusInternalServerError)
+			return
+		}
+	}
 
+	deployment.In(location(r))
+	w.Header().Set("ETag", itemETag(deployment))
 	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	_ = json.NewEncoder(w).Encode(deployment)
@@ -139,11 +377,364 @@ func (h *ItemsHandlers) reorderItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.ItemsService.ReorderItems(r.Context(), itemId, itemToReorder.Order)
+	item, err := h.ItemsService.ReorderItems(r.Context(), listIdParam(r), itemId, itemToReorder.Order, ifMatch(r))
 	if err != nil {
-		http.Error(w, "Failed to reorder item", http.StatusBadRequest)
+		http.Error(w, "Failed to reorder item", errorStatus(err))
 		return
 	}
 
+	w.Header().Set("ETag", itemETag(item))
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// bulk applies the operations of the request to the items all at once, and
+// responds with the result of each. When an operation fails none is applied,
+// and the response has the status that operation failed with.
+func (h *ItemsHandlers) bulk(w http.ResponseWriter, r *http.Request) {
+	var request structs.BulkRequest
+	err := requestAs(r, &request)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err = structs.ValidateStruct(&request)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// one by one, to tell which operation is invalid
+	for i := range request.Operations {
+		operation := &request.Operations[i]
+		if err := structs.ValidateStruct(operation); err != nil {
+			respondBulk(w, r, request.Operations, nil, &BulkError{Index: i, Err: err}, http.StatusBadRequest)
+			return
+		}
+		if operation.Item != nil {
+			recurIn(r, operation.Item)
+		}
+	}
+
+	items, err := h.ItemsService.Bulk(r.Context(), listIdParam(r), request.Operations)
+	var failed *BulkError
+	if errors.As(err, &failed) {
+		respondBulk(w, r, request.Operations, nil, failed, errorStatus(failed.Err))
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to apply the operations: "+err.Error(), errorStatus(err))
+		return
+	}
+	respondBulk(w, r, request.Operations, items, nil, http.StatusOK)
+}
+
+// respondBulk responds to a bulk request with the result of every operation.
+// When one failed, it has status and the others, which were not applied, a
+// 424.
+func respondBulk(w http.ResponseWriter, r *http.Request, operations []structs.BulkOperation, items []structs.TodoItem, failed *BulkError, status int) {
+	response := structs.BulkResponse{Results: make([]structs.BulkResult, len(operations))}
+	for i, operation := range operations {
+		result := &response.Results[i]
+		switch {
+		case failed != nil && i == failed.Index:
+			result.Status, result.Error = status, failed.Err.Error()
+		case failed != nil:
+			result.Status, result.Error = http.StatusFailedDependency, "not applied"
+		default:
+			result.Status, result.Item = bulkStatus[operation.Op], &items[i]
+			result.Item.In(location(r))
+		}
+	}
+	if failed != nil {
+		response.Failed = &failed.Index
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// moveItemRelative moves an item up, down, to the top or bottom, before or
+// after another item or in its place, and responds with the item.
+func (h *ItemsHandlers) moveItemRelative(w http.ResponseWriter, r *http.Request) {
+	var move structs.RelativeMove
+	err := requestAs(r, &move)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err = structs.ValidateStruct(&move)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := h.ItemsService.MoveItemRelative(r.Context(), listIdParam(r), chi.URLParam(r, "id"), move, ifMatch(r))
+	if err != nil {
+		http.Error(w, "Failed to move item: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	item.In(location(r))
+	w.Header().Set("ETag", itemETag(item))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(item)
+}
+
+// arrangeItems puts the items in a whole new order at once, and responds
+// with the items of the list. A client whose items are out of date is told
+// how they differ with a 409.
+func (h *ItemsHandlers) arrangeItems(w http.ResponseWriter, r *http.Request) {
+	var order structs.OrderRequest
+	err := requestAs(r, &order)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err = structs.ValidateStruct(&order)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, err := h.ItemsService.ArrangeItems(r.Context(), listIdParam(r), order.ParentId, order.Ids)
+	var conflict *store.OrderConflictError
+	if errors.As(err, &conflict) {
+		w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(structs.OrderConflict{Missing: conflict.Missing, Unexpected: conflict.Unexpected})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to order items: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	items.In(location(r))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+func (h *ItemsHandlers) moveItem(w http.ResponseWriter, r *http.Request) {
+	itemId := chi.URLParam(r, "id")
+
+	var itemToMove structs.MoveRequest
+	err := requestAs(r, &itemToMove)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err = structs.ValidateStruct(&itemToMove)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.ItemsService.MoveItem(r.Context(), listIdParam(r), itemId, itemToMove.ListId, itemToMove.Order)
+	if err != nil {
+		http.Error(w, "Failed to move item: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *ItemsHandlers) reparentItem(w http.ResponseWriter, r *http.Request) {
+	itemId := chi.URLParam(r, "id")
+
+	var request structs.ParentRequest
+	err := requestAs(r, &request)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err = structs.ValidateStruct(&request)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := h.ItemsService.ReparentItem(r.Context(), listIdParam(r), itemId, request.ParentId, request.Order)
+	h.writeReparented(w, r, item, err)
+}
+
+func (h *ItemsHandlers) indentItem(w http.ResponseWriter, r *http.Request) {
+	item, err := h.ItemsService.IndentItem(r.Context(), listIdParam(r), chi.URLParam(r, "id"))
+	h.writeReparented(w, r, item, err)
+}
+
+func (h *ItemsHandlers) outdentItem(w http.ResponseWriter, r *http.Request) {
+	item, err := h.ItemsService.OutdentItem(r.Context(), listIdParam(r), chi.URLParam(r, "id"))
+	h.writeReparented(w, r, item, err)
+}
+
+func (h *ItemsHandlers) writeReparented(w http.ResponseWriter, r *http.Request, item *structs.TodoItem, err error) {
+	if err != nil {
+		http.Error(w, "Failed to move item: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	// respond with the item, with its new parent and order
+	item.In(location(r))
+	w.Header().Set("ETag", itemETag(item))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(item)
+}
+
+func (h *ItemsHandlers) completeItem(w http.ResponseWriter, r *http.Request) {
+	h.setDone(w, r, true)
+}
+
+func (h *ItemsHandlers) uncompleteItem(w http.ResponseWriter, r *http.Request) {
+	h.setDone(w, r, false)
+}
+
+func (h *ItemsHandlers) setDone(w http.ResponseWriter, r *http.Request, done bool) {
+	itemId := chi.URLParam(r, "id")
+
+	item, err := h.ItemsService.CompleteItem(r.Context(), listIdParam(r), itemId, done)
+	if err != nil {
+		http.Error(w, "Failed to complete item: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	// respond with the item, its order may have changed
+	item.In(location(r))
+	w.Header().Set("ETag", itemETag(item))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(item)
+}
+
+func (h *ItemsHandlers) tagItem(w http.ResponseWriter, r *http.Request) {
+	h.setTagged(w, r, true)
+}
+
+func (h *ItemsHandlers) untagItem(w http.ResponseWriter, r *http.Request) {
+	h.setTagged(w, r, false)
+}
+
+func (h *ItemsHandlers) setTagged(w http.ResponseWriter, r *http.Request, tagged bool) {
+	itemId := chi.URLParam(r, "id")
+
+	// tags are case insensitive
+	tag := strings.ToLower(chi.URLParam(r, "tag"))
+	err := structs.ValidateVar(tag, "tag_name")
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := h.ItemsService.TagItem(r.Context(), listIdParam(r), itemId, tag, tagged)
+	if err != nil {
+		http.Error(w, "Failed to tag item: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	// respond with the item and all its tags
+	item.In(location(r))
+	w.Header().Set("ETag", itemETag(item))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(item)
+}
+
+func (h *ItemsHandlers) blockItem(w http.ResponseWriter, r *http.Request) {
+	h.setBlocked(w, r, true)
+}
+
+func (h *ItemsHandlers) unblockItem(w http.ResponseWriter, r *http.Request) {
+	h.setBlocked(w, r, false)
+}
+
+func (h *ItemsHandlers) setBlocked(w http.ResponseWriter, r *http.Request, blocked bool) {
+	item, err := h.ItemsService.BlockItem(r.Context(), listIdParam(r), chi.URLParam(r, "id"), chi.URLParam(r, "blockerId"), blocked)
+	if err != nil {
+		http.Error(w, "Failed to block item: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	// respond with the item and all its blockers
+	item.In(location(r))
+	w.Header().Set("ETag", itemETag(item))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(item)
+}
+
+// sortByBlockers reorders the list so that no item comes before an item it
+// waits for, and responds with its items.
+func (h *ItemsHandlers) sortByBlockers(w http.ResponseWriter, r *http.Request) {
+	items, err := h.ItemsService.SortByBlockers(r.Context(), listIdParam(r))
+	if err != nil {
+		http.Error(w, "Failed to sort: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	items.In(location(r))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+func (h *ItemsHandlers) listTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.ItemsService.ListTags(r.Context())
+	if err != nil {
+		http.Error(w, "Failed", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(tags)
+}
+
+func (h *ItemsHandlers) listTrash(w http.ResponseWriter, r *http.Request) {
+	items, err := h.ItemsService.ListTrash(r.Context())
+	if err != nil {
+		http.Error(w, "Failed", errorStatus(err))
+		return
+	}
+	items.In(location(r))
+
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+func (h *ItemsHandlers) restoreItem(w http.ResponseWriter, r *http.Request) {
+	itemId := chi.URLParam(r, "id")
+
+	var restore structs.RestoreRequest
+	err := requestAs(r, &restore)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err = structs.ValidateStruct(&restore)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := h.ItemsService.RestoreItem(r.Context(), itemId, restore.Order)
+	if err != nil {
+		http.Error(w, "Failed to restore item: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	// respond with the item, back where it went
+	item.In(location(r))
+	w.Header().Set("ETag", itemETag(item))
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(item)
+}
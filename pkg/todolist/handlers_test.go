@@ -0,0 +1,247 @@
+package todolist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+// newTestServer serves the items of an in-memory store.
+func newTestServer(t *testing.T) *httptest.Server {
+	todostore := store.NewMemoryStore()
+	handlers := &ItemsHandlers{
+		ItemsService: NewItemsService(todostore),
+		ListsService: NewListsService(todostore),
+	}
+	router := chi.NewRouter()
+	handlers.ConfigureRoutes(router)
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// request makes a request with the headers and a JSON body unless it is
+// nil, decoding the response into out unless it is nil.
+func request(t *testing.T, ts *httptest.Server, method, path string, headers map[string]string, body interface{}, out interface{}) *http.Response {
+	var reader *bytes.Reader
+	switch body := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(body))
+	default:
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	require.NoError(t, err)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if out != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp
+}
+
+func addItem(t *testing.T, ts *httptest.Server, name string) structs.TodoItem {
+	var item structs.TodoItem
+	resp := request(t, ts, "POST", "/todolist", nil, structs.TodoItem{Item: name}, &item)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	return item
+}
+
+func TestErrorStatus(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+	}{
+		{store.NotFoundf("unknown id"), http.StatusNotFound},
+		{fmt.Errorf("moving: %w", store.NotFoundf("unknown id")), http.StatusNotFound},
+		{&PreconditionFailedError{id: "a"}, http.StatusPreconditionFailed},
+		{&BulkError{Index: 1, Err: &PreconditionFailedError{id: "a"}}, http.StatusPreconditionFailed},
+		{errors.New("order should be between 1 and 3 and you provided 4"), http.StatusBadRequest},
+	} {
+		assert.Equal(t, test.status, errorStatus(test.err), test.err.Error())
+	}
+}
+
+func TestItemETag(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	item := structs.TodoItem{Id: "a", Version: 1, CreatedAt: &created}
+	etag := itemETag(&item)
+	assert.Regexp(t, `^"1-[0-9a-f]{16}"$`, etag)
+
+	// the same item however it is rendered
+	local := created.In(time.FixedZone("UTC+2", 2*60*60))
+	assert.Equal(t, etag, itemETag(&structs.TodoItem{Id: "a", Version: 1, CreatedAt: &local}))
+
+	// the id used again for a new item
+	recreated := created.Add(time.Hour)
+	assert.NotEqual(t, etag, itemETag(&structs.TodoItem{Id: "a", Version: 1, CreatedAt: &recreated}))
+	assert.NotEqual(t, etag, itemETag(&structs.TodoItem{Id: "b", Version: 1, CreatedAt: &created}))
+}
+
+func TestStaleIfMatch(t *testing.T) {
+	ts := newTestServer(t)
+	item := addItem(t, ts, "Pay the bills")
+	stale := itemETag(&item)
+
+	resp := request(t, ts, "PUT", "/todolist/"+item.Id, map[string]string{"If-Match": stale}, structs.TodoItem{Item: "Pay the bills today"}, nil)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	fresh := resp.Header.Get("ETag")
+	assert.NotEqual(t, stale, fresh)
+
+	for _, write := range []struct {
+		method, path string
+		body         interface{}
+	}{
+		{"PUT", "", structs.TodoItem{Item: "Pay the bills tomorrow"}},
+		{"PATCH", "", `{"item": "Pay the bills tomorrow"}`},
+		{"PUT", "/reorder", structs.ReorderRequest{Order: 1}},
+		{"DELETE", "", nil},
+	} {
+		resp = request(t, ts, write.method, "/todolist/"+item.Id+write.path, map[string]string{"If-Match": stale}, write.body, nil)
+		assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, write.method+" "+write.path)
+	}
+	resp = request(t, ts, "PUT", "/todolist/"+item.Id, map[string]string{"If-Match": "W/" + fresh}, structs.TodoItem{Item: "Pay the bills tomorrow"}, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode, "weak tags never match")
+
+	var got structs.TodoItem
+	resp = request(t, ts, "GET", "/todolist/"+item.Id, nil, nil, &got)
+	assert.Equal(t, fresh, resp.Header.Get("ETag"))
+	assert.Equal(t, "Pay the bills today", got.Item)
+
+	resp = request(t, ts, "DELETE", "/todolist/"+item.Id, map[string]string{"If-Match": fresh}, nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = request(t, ts, "DELETE", "/todolist/"+item.Id, map[string]string{"If-Match": fresh}, nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPatchItemStatus(t *testing.T) {
+	ts := newTestServer(t)
+	item := addItem(t, ts, "Water plants")
+	addItem(t, ts, "Pay the bills")
+
+	for _, test := range []struct {
+		contentType string
+		patch       string
+		status      int
+	}{
+		{MediaTypeMergePatch, `{"priority": "high"}`, http.StatusOK},
+		{MediaTypeJSON, `{"notes": "the ferns"}`, http.StatusOK},
+		{"text/plain", `{"priority": "low"}`, http.StatusUnsupportedMediaType},
+		{MediaTypeMergePatch, `["item"]`, http.StatusBadRequest},
+		{MediaTypeMergePatch, `{"done": true}`, http.StatusBadRequest},
+		{MediaTypeMergePatch, `{"item": null}`, http.StatusBadRequest},
+		{MediaTypeMergePatch, `{"priority": "urgent"}`, http.StatusBadRequest},
+		{MediaTypeMergePatch, `{"order": 3}`, http.StatusBadRequest},
+	} {
+		resp := request(t, ts, "PATCH", "/todolist/"+item.Id, map[string]string{"Content-Type": test.contentType}, test.patch, nil)
+		assert.Equal(t, test.status, resp.StatusCode, test.patch)
+		if test.status == http.StatusUnsupportedMediaType {
+			assert.Equal(t, MediaTypeMergePatch, resp.Header.Get("Accept-Patch"))
+		}
+	}
+
+	resp := request(t, ts, "PATCH", "/todolist/missing", map[string]string{"Content-Type": MediaTypeMergePatch}, `{"priority": "low"}`, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	var patched structs.TodoItem
+	request(t, ts, "GET", "/todolist/"+item.Id, nil, nil, &patched)
+	assert.Equal(t, structs.PriorityHigh, patched.Priority)
+	assert.Equal(t, "the ferns", patched.Notes)
+	assert.Equal(t, 3, patched.Version, "a write for every patch that was applied")
+}
+
+func TestArrangeConflict(t *testing.T) {
+	ts := newTestServer(t)
+	a, b := addItem(t, ts, "a"), addItem(t, ts, "b")
+
+	var conflict structs.OrderConflict
+	resp := request(t, ts, "PUT", "/todolist/order", nil, structs.OrderRequest{Ids: []string{b.Id, "c"}}, &conflict)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, []string{a.Id}, conflict.Missing)
+	assert.Equal(t, []string{"c"}, conflict.Unexpected)
+
+	resp = request(t, ts, "PUT", "/todolist/order", nil, structs.OrderRequest{Ids: []string{b.Id, b.Id}}, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestBulkStatus(t *testing.T) {
+	ts := newTestServer(t)
+	item := addItem(t, ts, "Milk")
+
+	// the failing operation has its status and the others a 424
+	for _, test := range []struct {
+		name       string
+		operations []structs.BulkOperation
+		failed     int
+		status     int
+	}{
+		{"invalid", []structs.BulkOperation{
+			{Op: structs.BulkCreate, Item: &structs.TodoItem{Item: "Bread"}},
+			{Op: structs.BulkUpdate, Id: item.Id},
+		}, 1, http.StatusBadRequest},
+		{"unknown id", []structs.BulkOperation{
+			{Op: structs.BulkCreate, Item: &structs.TodoItem{Item: "Bread"}},
+			{Op: structs.BulkDelete, Id: item.Id},
+			{Op: structs.BulkDelete, Id: "missing"},
+			{Op: structs.BulkCreate, Item: &structs.TodoItem{Item: "Eggs"}},
+		}, 2, http.StatusNotFound},
+		{"failed", []structs.BulkOperation{
+			{Op: structs.BulkMove, Id: item.Id, Order: 2},
+		}, 0, http.StatusBadRequest},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var response structs.BulkResponse
+			resp := request(t, ts, "POST", "/todolist/bulk", nil, structs.BulkRequest{Operations: test.operations}, &response)
+			assert.Equal(t, test.status, resp.StatusCode)
+			require.NotNil(t, response.Failed)
+			assert.Equal(t, test.failed, *response.Failed)
+			require.Len(t, response.Results, len(test.operations))
+			for i, result := range response.Results {
+				if i == test.failed {
+					assert.Equal(t, test.status, result.Status)
+				} else {
+					assert.Equal(t, http.StatusFailedDependency, result.Status)
+				}
+				assert.NotEmpty(t, result.Error)
+				assert.Nil(t, result.Item)
+			}
+		})
+	}
+
+	// none of them was applied
+	var items structs.TodoItemList
+	request(t, ts, "GET", "/todolist", nil, nil, &items)
+	require.Equal(t, 1, items.Count)
+	assert.Equal(t, item.Id, items.Items[0].Id)
+
+	var response structs.BulkResponse
+	resp := request(t, ts, "POST", "/todolist/bulk", nil, structs.BulkRequest{Operations: []structs.BulkOperation{
+		{Op: structs.BulkCreate, Item: &structs.TodoItem{Item: "Bread"}},
+		{Op: structs.BulkDelete, Id: item.Id},
+	}}, &response)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, response.Failed)
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, http.StatusAccepted, response.Results[0].Status)
+	assert.Equal(t, http.StatusOK, response.Results[1].Status)
+	assert.Equal(t, item.Id, response.Results[1].Item.Id)
+}
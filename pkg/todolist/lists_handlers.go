@@ -0,0 +1,128 @@
+package todolist
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+func (h *ItemsHandlers) createList(w http.ResponseWriter, r *http.Request) {
+	var list structs.List
+	err := requestAs(r, &list)
+	if err != nil {
+		http.Error(w, "Failed", http.StatusBadRequest)
+		return
+	}
+
+	err = structs.ValidateStruct(&list)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.ListsService.AddList(r.Context(), &list)
+	if err != nil {
+		// return the actual err message
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// respond with the list, its ID and order may have been assigned
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func (h *ItemsHandlers) listLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := h.ListsService.ListLists(r.Context())
+	if err != nil {
+		http.Error(w, "Failed", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(lists)
+}
+
+func (h *ItemsHandlers) getList(w http.ResponseWriter, r *http.Request) {
+	listId := chi.URLParam(r, "listId")
+
+	list, err := h.ListsService.GetList(r.Context(), listId)
+	if err != nil {
+		http.Error(w, "Failed to get a list with this ID", errorStatus(err))
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(list)
+}
+
+func (h *ItemsHandlers) updateList(w http.ResponseWriter, r *http.Request) {
+	listId := chi.URLParam(r, "listId")
+
+	var list structs.List
+	err := requestAs(r, &list)
+	if err != nil {
+		http.Error(w, "Failed", http.StatusBadRequest)
+		return
+	}
+
+	list.Id = listId
+
+	err = structs.ValidateStruct(&list)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.ListsService.UpdateList(r.Context(), &list)
+	if err != nil {
+		http.Error(w, "Failed to update list", errorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *ItemsHandlers) deleteList(w http.ResponseWriter, r *http.Request) {
+	listId := chi.URLParam(r, "listId")
+	shifted, err := h.ListsService.DeleteList(r.Context(), listId)
+	if err != nil {
+		http.Error(w, "Failed to delete list: "+err.Error(), errorStatus(err))
+		return
+	}
+
+	// respond with the lists that moved up to close the gap
+	w.Header().Add("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(shifted)
+}
+
+func (h *ItemsHandlers) reorderList(w http.ResponseWriter, r *http.Request) {
+	listId := chi.URLParam(r, "listId")
+
+	var listToReorder structs.ReorderRequest
+	err := requestAs(r, &listToReorder)
+	if err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	err = structs.ValidateStruct(&listToReorder)
+	if err != nil {
+		http.Error(w, "Validation failed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.ListsService.ReorderList(r.Context(), listId, listToReorder.Order)
+	if err != nil {
+		http.Error(w, "Failed to reorder list", errorStatus(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
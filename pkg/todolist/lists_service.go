@@ -0,0 +1,69 @@
+package todolist
+
+import (
+	"context"
+
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+type ListsService interface {
+	AddList(ctx context.Context, def *structs.List) error
+	DeleteList(ctx context.Context, id string) (structs.Lists, error)
+	UpdateList(ctx context.Context, def *structs.List) error
+	GetList(ctx context.Context, id string) (*structs.List, error)
+	ListLists(ctx context.Context) (structs.Lists, error)
+	ReorderList(ctx context.Context, id string, newOrder int) error
+}
+
+func NewListsService(s store.Store) ListsService {
+	return &listsServiceImpl{
+		store: s,
+	}
+}
+
+type listsServiceImpl struct {
+	store store.Store
+}
+
+func (s *listsServiceImpl) GetList(ctx context.Context, id string) (*structs.List, error) {
+	var result structs.List
+	err := s.store.Update(func(tx store.Txn) error {
+		return tx.GetList(ctx, id, &result)
+	})
+	return &result, err
+}
+
+func (s *listsServiceImpl) AddList(ctx context.Context, def *structs.List) error {
+	return s.store.Update(func(tx store.Txn) error {
+		return tx.AddList(ctx, def)
+	})
+}
+
+func (s *listsServiceImpl) ListLists(ctx context.Context) (structs.Lists, error) {
+	var result structs.Lists
+	err := s.store.Update(func(tx store.Txn) error {
+		return tx.ListLists(ctx, &result)
+	})
+	return result, err
+}
+
+func (s *listsServiceImpl) DeleteList(ctx context.Context, id string) (structs.Lists, error) {
+	var shifted structs.Lists
+	err := s.store.Update(func(tx store.Txn) error {
+		return tx.DeleteList(ctx, id, &shifted)
+	})
+	return shifted, err
+}
+
+func (s *listsServiceImpl) UpdateList(ctx context.Context, def *structs.List) error {
+	return s.store.Update(func(tx store.Txn) error {
+		return tx.UpdateList(ctx, def)
+	})
+}
+
+func (s *listsServiceImpl) ReorderList(ctx context.Context, id string, newOrder int) error {
+	return s.store.Update(func(tx store.Txn) error {
+		return tx.ReorderList(ctx, id, newOrder)
+	})
+}
@@ -0,0 +1,31 @@
+package todolist
+
+import (
+	"bytes"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+var (
+	// raw HTML in the notes is dropped by goldmark already, the policy
+	// covers whatever the Markdown itself produces, e.g. javascript: links
+	markdown  = goldmark.New(goldmark.WithExtensions(extension.GFM))
+	sanitizer = bluemonday.UGCPolicy()
+)
+
+// renderNotes turns the Markdown notes of an item into HTML that is safe to
+// embed in a page.
+func renderNotes(item *structs.TodoItem) error {
+	if item.Notes == "" {
+		return nil
+	}
+	var html bytes.Buffer
+	if err := markdown.Convert([]byte(item.Notes), &html); err != nil {
+		return err
+	}
+	item.NotesHTML = string(sanitizer.SanitizeBytes(html.Bytes()))
+	return nil
+}
@@ -0,0 +1,98 @@
+package todolist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// patchableFields are the fields of an item a merge patch may change. The
+// others change through their own endpoints, or not at all.
+var patchableFields = map[string]bool{
+	"item":       true,
+	"notes":      true,
+	"order":      true,
+	"dueAt":      true,
+	"priority":   true,
+	"recurrence": true,
+	"timeZone":   true,
+}
+
+// checkMergePatch fails unless patch is an object that only names fields
+// patches may change.
+func checkMergePatch(patch []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil || fields == nil {
+		return fmt.Errorf("a patch is a JSON object")
+	}
+	var unknown []string
+	for name := range fields {
+		if !patchableFields[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("cannot patch %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// applyMergePatch applies an RFC 7386 merge patch to item.
+func applyMergePatch(item *structs.TodoItem, patch []byte) error {
+	current, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	var target, changes interface{}
+	if err := decodeNumbers(current, &target); err != nil {
+		return err
+	}
+	if err := decodeNumbers(patch, &changes); err != nil {
+		return err
+	}
+	merged, err := json.Marshal(mergePatch(target, changes))
+	if err != nil {
+		return err
+	}
+	// from scratch, so that the removed fields are left at their zero value
+	var patched structs.TodoItem
+	if err := json.Unmarshal(merged, &patched); err != nil {
+		return err
+	}
+	*item = patched
+	return nil
+}
+
+// mergePatch is the MergePatch function of RFC 7386: the members of an
+// object patch are merged into target, where null removes them, and any
+// other patch replaces it.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	merged, ok := target.(map[string]interface{})
+	if !ok {
+		merged = map[string]interface{}{}
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(merged, name)
+		} else {
+			merged[name] = mergePatch(merged[name], value)
+		}
+	}
+	return merged
+}
+
+// decodeNumbers decodes JSON keeping its numbers as they were written.
+func decodeNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
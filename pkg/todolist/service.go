@@ -2,18 +2,62 @@ package todolist
 
 import (
 	"context"
+	"fmt"
 
 	"go.altair.com/todolist/pkg/structs"
 	"go.altair.com/todolist/pkg/todolist/store"
 )
 
 type ItemsService interface {
-	AddItem(ctx context.Context, def *structs.TodoItem) error
-	DeleteItem(ctx context.Context, id string) error
-	UpdateItem(ctx context.Context, def *structs.TodoItem) error
-	GetItem(ctx context.Context, id string) (*structs.TodoItem, error)
-	ListItems(ctx context.Context) (structs.TodoItemList, error)
-	ReorderItems(ctx context.Context, id string, newOrder int) error // New method
+	AddItem(ctx context.Context, listId string, def *structs.TodoItem) error
+	// DeleteItem, UpdateItem, PatchItem, ReorderItems and MoveItemRelative
+	// fail with a PreconditionFailedError unless the item matches one of the ifMatch
+	// entity tags, when there are any.
+	DeleteItem(ctx context.Context, listId string, id string, ifMatch []string) (structs.TodoItemList, error)
+	UpdateItem(ctx context.Context, listId string, def *structs.TodoItem, ifMatch []string) error
+	// PatchItem changes an item as patch does to a copy of it, in the same
+	// transaction as the write. A changed order moves the item as
+	// ReorderItems does, and an item that does not change is not written.
+	PatchItem(ctx context.Context, listId string, id string, patch func(item *structs.TodoItem) error, ifMatch []string) (*structs.TodoItem, error)
+	GetItem(ctx context.Context, listId string, id string) (*structs.TodoItem, error)
+	ListItems(ctx context.Context, listId string, query structs.ItemQuery) (structs.TodoItemList, error)
+	ReorderItems(ctx context.Context, listId string, id string, newOrder int, ifMatch []string) (*structs.TodoItem, error)
+	// Bulk applies operations to the items of a list in one transaction, and
+	// returns the item each of them left behind. When one fails none is
+	// applied, and it fails with a BulkError.
+	Bulk(ctx context.Context, listId string, operations []structs.BulkOperation) ([]structs.TodoItem, error)
+	// MoveItemRelative moves an item among its siblings relative to where it
+	// or another item is.
+	MoveItemRelative(ctx context.Context, listId string, id string, move structs.RelativeMove, ifMatch []string) (*structs.TodoItem, error)
+	// ArrangeItems puts the sub-tasks of parentId, or the top-level items when
+	// it is empty, in the order of ids all at once, and returns the items of
+	// the list. It fails with a store.OrderConflictError unless ids are those
+	// of the items.
+	ArrangeItems(ctx context.Context, listId string, parentId string, ids []string) (structs.TodoItemList, error)
+	MoveItem(ctx context.Context, listId string, id string, toListId string, newOrder int) error
+	// ReparentItem makes an item a sub-task of parentId, or a top-level item
+	// when parentId is empty.
+	ReparentItem(ctx context.Context, listId string, id string, parentId string, newOrder int) (*structs.TodoItem, error)
+	// IndentItem makes an item the last sub-task of the sibling above it.
+	IndentItem(ctx context.Context, listId string, id string) (*structs.TodoItem, error)
+	// OutdentItem makes a sub-task a sibling of its parent, right below it.
+	OutdentItem(ctx context.Context, listId string, id string) (*structs.TodoItem, error)
+	CompleteItem(ctx context.Context, listId string, id string, done bool) (*structs.TodoItem, error)
+	// TagItem adds a tag to an item, or removes it when tagged is false.
+	TagItem(ctx context.Context, listId string, id string, tag string, tagged bool) (*structs.TodoItem, error)
+	ListTags(ctx context.Context) (structs.Tags, error)
+	// BlockItem makes an item wait for blockerId, another item of the user,
+	// or stops it waiting when blocked is false.
+	BlockItem(ctx context.Context, listId string, id string, blockerId string, blocked bool) (*structs.TodoItem, error)
+	// SortByBlockers reorders a list so that no item comes before an item it
+	// waits for, and returns its items.
+	SortByBlockers(ctx context.Context, listId string) (structs.TodoItemList, error)
+	// ListTrash lists the deleted items of the user, most recently deleted
+	// first.
+	ListTrash(ctx context.Context) (structs.TodoItemList, error)
+	// RestoreItem takes an item out of the trash with its sub-tasks, back to
+	// newOrder or to where it was when newOrder is 0.
+	RestoreItem(ctx context.Context, id string, newOrder int) (*structs.TodoItem, error)
 }
 
 func NewItemsService(s store.Store) ItemsService {
@@ -26,44 +70,329 @@ type itemsServiceImpl struct {
 	store store.Store
 }
 
-func (s *itemsServiceImpl) GetItem(ctx context.Context, deploymentId string) (*structs.TodoItem, error) {
+// getInList gets an item, failing as for an unknown item when it belongs to
+// another list than the one it was addressed through.
+func getInList(ctx context.Context, tx store.Txn, listId string, id string, item *structs.TodoItem) error {
+	err := tx.Get(ctx, id, item)
+	if err != nil {
+		return err
+	}
+	if item.ListId != listId {
+		return store.NotFoundf("unknown id")
+	}
+	return nil
+}
+
+func (s *itemsServiceImpl) GetItem(ctx context.Context, listId string, deploymentId string) (*structs.TodoItem, error) {
 	var result structs.TodoItem
 	err := s.store.Update(func(tx store.Txn) error {
-		err := tx.Get(ctx, deploymentId, &result)
+		err := getInList(ctx, tx, listId, deploymentId, &result)
 		return err
 	})
 	return &result, err
 }
 
-func (s *itemsServiceImpl) AddItem(ctx context.Context, def *structs.TodoItem) error {
+func (s *itemsServiceImpl) AddItem(ctx context.Context, listId string, def *structs.TodoItem) error {
+	def.ListId = listId
 	return s.store.Update(func(tx store.Txn) error {
 		return tx.Add(ctx, def)
 	})
 }
 
-func (s *itemsServiceImpl) ListItems(ctx context.Context) (structs.TodoItemList, error) {
+func (s *itemsServiceImpl) ListItems(ctx context.Context, listId string, query structs.ItemQuery) (structs.TodoItemList, error) {
 	var result structs.TodoItemList
 	err := s.store.Update(func(tx store.Txn) error {
-		err := tx.List(ctx, &result)
+		err := tx.List(ctx, listId, query, &result)
 		return err
 	})
 	return result, err
 }
 
-func (s *itemsServiceImpl) DeleteItem(ctx context.Context, deploymentId string) error {
-	return s.store.Update(func(tx store.Txn) error {
-		return tx.Delete(ctx, deploymentId)
+// getMatching gets an item like getInList, failing when it does not match
+// the ifMatch entity tags. It runs in the transaction of the write, so that
+// nothing can change the item in between.
+func getMatching(ctx context.Context, tx store.Txn, listId string, id string, ifMatch []string, item *structs.TodoItem) error {
+	if err := getInList(ctx, tx, listId, id, item); err != nil {
+		return err
+	}
+	return checkIfMatch(ifMatch, item)
+}
+
+func (s *itemsServiceImpl) DeleteItem(ctx context.Context, listId string, deploymentId string, ifMatch []string) (structs.TodoItemList, error) {
+	var shifted structs.TodoItemList
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := getMatching(ctx, tx, listId, deploymentId, ifMatch, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, deploymentId, &shifted)
 	})
+	return shifted, err
 }
 
-func (s *itemsServiceImpl) UpdateItem(ctx context.Context, def *structs.TodoItem) error {
+func (s *itemsServiceImpl) UpdateItem(ctx context.Context, listId string, def *structs.TodoItem, ifMatch []string) error {
 	return s.store.Update(func(tx store.Txn) error {
+		if err := getMatching(ctx, tx, listId, def.Id, ifMatch, &structs.TodoItem{}); err != nil {
+			return err
+		}
 		return tx.Update(ctx, def)
 	})
 }
 
-func (s *itemsServiceImpl) ReorderItems(ctx context.Context, id string, newOrder int) error {
+func (s *itemsServiceImpl) PatchItem(ctx context.Context, listId string, id string, patch func(item *structs.TodoItem) error, ifMatch []string) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		var current structs.TodoItem
+		if err := getMatching(ctx, tx, listId, id, ifMatch, &current); err != nil {
+			return err
+		}
+		patched := current
+		if err := patch(&patched); err != nil {
+			return err
+		}
+		patched.Id = id
+
+		// a single write, so that the version is bumped once
+		moved := patched.Order != 0 && patched.Order != current.Order
+		if !sameContent(&current, &patched) {
+			record := patched
+			if !moved {
+				record.Order = 0
+			}
+			if err := tx.Update(ctx, &record); err != nil {
+				return err
+			}
+		} else if moved {
+			if err := tx.Reorder(ctx, id, patched.Order); err != nil {
+				return err
+			}
+		}
+		return tx.Get(ctx, id, &result)
+	})
+	return &result, err
+}
+
+// sameContent tells whether two versions of an item have the same content,
+// which is all Update changes but the order.
+func sameContent(a *structs.TodoItem, b *structs.TodoItem) bool {
+	sameDue := a.DueAt == b.DueAt || (a.DueAt != nil && b.DueAt != nil && a.DueAt.Equal(*b.DueAt))
+	return sameDue && a.Item == b.Item && a.Notes == b.Notes && a.Priority == b.Priority &&
+		a.Recurrence == b.Recurrence && a.TimeZone == b.TimeZone
+}
+
+func (s *itemsServiceImpl) ReorderItems(ctx context.Context, listId string, id string, newOrder int, ifMatch []string) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := getMatching(ctx, tx, listId, id, ifMatch, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		if err := tx.Reorder(ctx, id, newOrder); err != nil {
+			return err
+		}
+		return tx.Get(ctx, id, &result)
+	})
+	return &result, err
+}
+
+func (s *itemsServiceImpl) Bulk(ctx context.Context, listId string, operations []structs.BulkOperation) ([]structs.TodoItem, error) {
+	results := make([]structs.TodoItem, len(operations))
+	err := s.store.Update(func(tx store.Txn) error {
+		for i, operation := range operations {
+			if err := applyOperation(ctx, tx, listId, operation, &results[i]); err != nil {
+				return &BulkError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (s *itemsServiceImpl) MoveItemRelative(ctx context.Context, listId string, id string, move structs.RelativeMove, ifMatch []string) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := getMatching(ctx, tx, listId, id, ifMatch, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		if err := tx.MoveRelative(ctx, id, move); err != nil {
+			return err
+		}
+		return tx.Get(ctx, id, &result)
+	})
+	return &result, err
+}
+
+func (s *itemsServiceImpl) ArrangeItems(ctx context.Context, listId string, parentId string, ids []string) (structs.TodoItemList, error) {
+	var result structs.TodoItemList
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := tx.Arrange(ctx, listId, parentId, ids); err != nil {
+			return err
+		}
+		return tx.List(ctx, listId, structs.ItemQuery{}, &result)
+	})
+	return result, err
+}
+
+func (s *itemsServiceImpl) MoveItem(ctx context.Context, listId string, id string, toListId string, newOrder int) error {
 	return s.store.Update(func(tx store.Txn) error {
-		return tx.Reorder(ctx, id, newOrder)
+		if err := getInList(ctx, tx, listId, id, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		return tx.MoveItem(ctx, id, toListId, newOrder)
+	})
+}
+
+func (s *itemsServiceImpl) ReparentItem(ctx context.Context, listId string, id string, parentId string, newOrder int) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := getInList(ctx, tx, listId, id, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		if err := tx.Reparent(ctx, id, parentId, newOrder); err != nil {
+			return err
+		}
+		return tx.Get(ctx, id, &result)
+	})
+	return &result, err
+}
+
+func (s *itemsServiceImpl) IndentItem(ctx context.Context, listId string, id string) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		var item structs.TodoItem
+		if err := getInList(ctx, tx, listId, id, &item); err != nil {
+			return err
+		}
+		if item.Order < 2 {
+			return fmt.Errorf("there is no item above to indent under")
+		}
+		var siblings structs.TodoItemList
+		if err := tx.Siblings(ctx, listId, item.ParentId, &siblings); err != nil {
+			return err
+		}
+		for _, sibling := range siblings.Items {
+			if sibling.Order == item.Order-1 {
+				if err := tx.Reparent(ctx, id, sibling.Id, 0); err != nil {
+					return err
+				}
+				return tx.Get(ctx, id, &result)
+			}
+		}
+		return fmt.Errorf("there is no item above to indent under")
+	})
+	return &result, err
+}
+
+func (s *itemsServiceImpl) OutdentItem(ctx context.Context, listId string, id string) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		var item structs.TodoItem
+		if err := getInList(ctx, tx, listId, id, &item); err != nil {
+			return err
+		}
+		if item.ParentId == "" {
+			return fmt.Errorf("top-level items cannot be outdented")
+		}
+		var parent structs.TodoItem
+		if err := tx.Get(ctx, item.ParentId, &parent); err != nil {
+			return err
+		}
+		// right below the parent, or at the end when it has no position
+		order := 0
+		if parent.Order > 0 {
+			order = parent.Order + 1
+		}
+		if err := tx.Reparent(ctx, id, parent.ParentId, order); err != nil {
+			return err
+		}
+		return tx.Get(ctx, id, &result)
+	})
+	return &result, err
+}
+
+func (s *itemsServiceImpl) CompleteItem(ctx context.Context, listId string, id string, done bool) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := getInList(ctx, tx, listId, id, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		return tx.Complete(ctx, id, done, &result)
 	})
+	return &result, err
+}
+
+func (s *itemsServiceImpl) TagItem(ctx context.Context, listId string, id string, tag string, tagged bool) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := getInList(ctx, tx, listId, id, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		var err error
+		if tagged {
+			err = tx.TagItem(ctx, id, tag)
+		} else {
+			err = tx.UntagItem(ctx, id, tag)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Get(ctx, id, &result)
+	})
+	return &result, err
+}
+
+func (s *itemsServiceImpl) BlockItem(ctx context.Context, listId string, id string, blockerId string, blocked bool) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := getInList(ctx, tx, listId, id, &structs.TodoItem{}); err != nil {
+			return err
+		}
+		var err error
+		if blocked {
+			err = tx.AddBlocker(ctx, id, blockerId)
+		} else {
+			err = tx.RemoveBlocker(ctx, id, blockerId)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Get(ctx, id, &result)
+	})
+	return &result, err
+}
+
+func (s *itemsServiceImpl) SortByBlockers(ctx context.Context, listId string) (structs.TodoItemList, error) {
+	var result structs.TodoItemList
+	err := s.store.Update(func(tx store.Txn) error {
+		if err := tx.SortByBlockers(ctx, listId); err != nil {
+			return err
+		}
+		return tx.List(ctx, listId, structs.ItemQuery{}, &result)
+	})
+	return result, err
+}
+
+func (s *itemsServiceImpl) ListTags(ctx context.Context) (structs.Tags, error) {
+	var result structs.Tags
+	err := s.store.Update(func(tx store.Txn) error {
+		return tx.ListTags(ctx, &result)
+	})
+	return result, err
+}
+
+func (s *itemsServiceImpl) ListTrash(ctx context.Context) (structs.TodoItemList, error) {
+	var result structs.TodoItemList
+	err := s.store.Update(func(tx store.Txn) error {
+		return tx.ListTrash(ctx, &result)
+	})
+	return result, err
+}
+
+func (s *itemsServiceImpl) RestoreItem(ctx context.Context, id string, newOrder int) (*structs.TodoItem, error) {
+	var result structs.TodoItem
+	err := s.store.Update(func(tx store.Txn) error {
+		return tx.Restore(ctx, id, newOrder, &result)
+	})
+	return &result, err
 }
@@ -0,0 +1,50 @@
+package todolist
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tododb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/structs"
+	"go.altair.com/todolist/pkg/todolist/store"
+)
+
+func TestIndentLongList(t *testing.T) {
+	for _, strategy := range []store.RankStrategy{store.DenseRanking, store.LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db, err := tododb.CreateDb(tododb.Options{DSN: tododb.MemoryDSN})
+			require.NoError(t, err)
+			t.Cleanup(func() { db.Close() })
+			require.NoError(t, store.PrepareRanks(db, strategy))
+			todostore := store.NewSqlStore(db, store.WithRankStrategy(strategy))
+			ctx := context.Background()
+
+			// more items than a statement can bind ids
+			ids := make([]string, 1200)
+			require.NoError(t, todostore.Update(func(tx store.Txn) error {
+				for i := range ids {
+					item := structs.TodoItem{Item: fmt.Sprintf("item %d", i+1)}
+					if err := tx.Add(ctx, &item); err != nil {
+						return err
+					}
+					ids[i] = item.Id
+				}
+				return nil
+			}))
+			service := NewItemsService(todostore)
+
+			indented, err := service.IndentItem(ctx, store.DefaultListId, ids[1100])
+			require.NoError(t, err)
+			assert.Equal(t, ids[1099], indented.ParentId)
+			assert.Equal(t, 1, indented.Order)
+
+			outdented, err := service.OutdentItem(ctx, store.DefaultListId, ids[1100])
+			require.NoError(t, err)
+			assert.Equal(t, "", outdented.ParentId)
+			assert.Equal(t, 1101, outdented.Order)
+		})
+	}
+}
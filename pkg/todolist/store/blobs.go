@@ -0,0 +1,174 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TooLargeError is returned for attachments over the size limit, or that
+// would take their owner over their quota.
+type TooLargeError struct {
+	msg string
+}
+
+func (e *TooLargeError) Error() string {
+	return e.msg
+}
+
+// TooLargef returns a TooLargeError with the formatted message.
+func TooLargef(format string, args ...interface{}) error {
+	return &TooLargeError{msg: fmt.Sprintf(format, args...)}
+}
+
+func IsTooLarge(err error) bool {
+	var tooLarge *TooLargeError
+	return errors.As(err, &tooLarge)
+}
+
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Blobs keeps the content of attachments in a directory on the local disk,
+// under the hex SHA-256 of the content, so that the same content is only
+// stored once. Content is never removed as such: Collect removes what no
+// attachment uses any more.
+type Blobs struct {
+	dir string
+	// mu keeps a collection from removing content that is being stored again
+	// in the meantime.
+	mu sync.Mutex
+}
+
+// NewBlobs returns Blobs that keep their content in dir, which is created if
+// needed.
+func NewBlobs(dir string) (*Blobs, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &Blobs{dir: dir}, nil
+}
+
+// path is where the content with digest is kept, in a sub-directory named
+// after its first two digits.
+func (b *Blobs) path(digest string) string {
+	return filepath.Join(b.dir, digest[:2], digest)
+}
+
+// Put stores content and returns its digest and size. Content over maxSize
+// bytes is rejected with a TooLargeError.
+func (b *Blobs) Put(content io.Reader, maxSize int64) (string, int64, error) {
+	upload, err := os.CreateTemp(b.dir, ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	// a no-op once the upload is in place
+	defer os.Remove(upload.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(upload, hash), io.LimitReader(content, maxSize+1))
+	if closeErr := upload.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if size > maxSize {
+		return "", 0, TooLargef("attachments are limited to %d bytes", maxSize)
+	}
+
+	digest := hex.EncodeToString(hash.Sum(nil))
+	if err := os.MkdirAll(filepath.Dir(b.path(digest)), 0o750); err != nil {
+		return "", 0, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// replacing content that is already there renews it for Collect
+	if err := os.Rename(upload.Name(), b.path(digest)); err != nil {
+		return "", 0, err
+	}
+	return digest, size, nil
+}
+
+// Open returns the content with digest, which the caller closes.
+func (b *Blobs) Open(digest string) (*os.File, error) {
+	if !digestPattern.MatchString(digest) {
+		return nil, fmt.Errorf("invalid digest %q", digest)
+	}
+	return os.Open(b.path(digest))
+}
+
+// Collect removes the content that is not in used and was stored before
+// then, along with the uploads left behind before then, and returns how many
+// files it removed. Content stored since may be about to be used.
+func (b *Blobs) Collect(used map[string]bool, before time.Time) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(b.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || used[entry.Name()] {
+			return err
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) || (err == nil && !info.ModTime().Before(before)) {
+			return nil
+		}
+		if err == nil {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// CollectBlobsEvery removes the content of blobs that no attachment in s uses
+// and that is older than grace, right away and then every interval until ctx
+// is done. Grace has to cover the time between storing content and adding
+// the attachment that uses it. Failures are logged, the next round tries
+// again.
+func CollectBlobsEvery(ctx context.Context, s Store, blobs *Blobs, grace time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		collectBlobs(ctx, s, blobs, grace)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func collectBlobs(ctx context.Context, s Store, blobs *Blobs, grace time.Duration) {
+	before := time.Now().Add(-grace)
+	var used map[string]bool
+	err := s.Update(func(tx Txn) error {
+		var err error
+		used, err = tx.AttachmentDigests(ctx)
+		return err
+	})
+	if err == nil {
+		var removed int
+		removed, err = blobs.Collect(used, before)
+		if removed > 0 {
+			log.Debug().Msg(fmt.Sprintf("Removed %d unused attachment files", removed))
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("Attachment collection failed")
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobs(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := NewBlobs(filepath.Join(dir, "attachments"))
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("hello"))
+	hello := hex.EncodeToString(sum[:])
+
+	digest, size, err := blobs.Put(strings.NewReader("hello"), 5)
+	require.NoError(t, err)
+	assert.Equal(t, hello, digest)
+	assert.Equal(t, int64(5), size)
+	assert.FileExists(t, filepath.Join(dir, "attachments", hello[:2], hello))
+
+	content, err := blobs.Open(digest)
+	require.NoError(t, err)
+	read, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.NoError(t, content.Close())
+	assert.Equal(t, "hello", string(read))
+
+	// the same content is stored once
+	digest, _, err = blobs.Put(strings.NewReader("hello"), 5)
+	require.NoError(t, err)
+	assert.Equal(t, hello, digest)
+
+	_, _, err = blobs.Put(strings.NewReader("hello!"), 5)
+	assert.True(t, IsTooLarge(err))
+	_, err = blobs.Open("../../etc/passwd")
+	assert.Error(t, err)
+
+	// nothing is left behind but the content
+	entries, err := os.ReadDir(filepath.Join(dir, "attachments"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, hello[:2], entries[0].Name())
+
+	t.Run("Collect", func(t *testing.T) {
+		other, _, err := blobs.Put(strings.NewReader("other"), 5)
+		require.NoError(t, err)
+		leftover, err := os.CreateTemp(filepath.Join(dir, "attachments"), ".upload-*")
+		require.NoError(t, err)
+		require.NoError(t, leftover.Close())
+
+		// content stored since may be about to be used
+		removed, err := blobs.Collect(map[string]bool{hello: true}, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 0, removed)
+
+		removed, err = blobs.Collect(map[string]bool{hello: true}, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		assert.Equal(t, 2, removed)
+		_, err = blobs.Open(other)
+		assert.True(t, os.IsNotExist(err))
+		assert.NoFileExists(t, leftover.Name())
+		content, err := blobs.Open(hello)
+		require.NoError(t, err)
+		require.NoError(t, content.Close())
+	})
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// sortByBlockers reorders each set of siblings of a list so that no item comes
+// before an item it waits for, and otherwise keeps the order they had as far
+// as it can. An item waits for its open blockers, for theirs in turn, and so
+// on, whichever list they are in.
+func sortByBlockers(ctx context.Context, tx arrangingTxn, listId string) error {
+	var items structs.TodoItemList
+	if err := tx.List(ctx, listId, structs.ItemQuery{}, &items); err != nil {
+		return err
+	}
+	known := make(map[string]structs.TodoItem, items.Count)
+	siblings := make(map[string][]structs.TodoItem)
+	for _, item := range items.Items {
+		known[item.Id] = item
+		// items without an order are not in the sequence
+		if item.Order > 0 {
+			siblings[item.ParentId] = append(siblings[item.ParentId], item)
+		}
+	}
+
+	// the blockers in other lists are looked up as the chains lead to them
+	lookup := func(id string) (structs.TodoItem, error) {
+		if item, ok := known[id]; ok {
+			return item, nil
+		}
+		var item structs.TodoItem
+		if err := tx.Get(ctx, id, &item); err != nil {
+			return item, err
+		}
+		known[id] = item
+		return item, nil
+	}
+	waitsFor := func(item structs.TodoItem) (map[string]bool, error) {
+		waited := map[string]bool{}
+		pending := []structs.TodoItem{item}
+		for len(pending) > 0 {
+			next := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			for _, blockerId := range next.BlockedBy {
+				blocker, err := lookup(blockerId)
+				if err != nil {
+					return nil, err
+				}
+				if !blocker.Done && !waited[blockerId] {
+					waited[blockerId] = true
+					pending = append(pending, blocker)
+				}
+			}
+		}
+		return waited, nil
+	}
+
+	for parentId, group := range siblings {
+		sort.Slice(group, func(i, j int) bool { return group[i].Order < group[j].Order })
+		waits := make([]map[string]bool, len(group))
+		for i, item := range group {
+			var err error
+			if waits[i], err = waitsFor(item); err != nil {
+				return err
+			}
+		}
+
+		// the first item that waits for none of the items left goes next
+		current := make([]string, len(group))
+		sorted := make([]string, 0, len(group))
+		placed := make([]bool, len(group))
+		for i, item := range group {
+			current[i] = item.Id
+		}
+		for len(sorted) < len(group) {
+			next := -1
+			for i := range group {
+				if !placed[i] && !waitsForAny(waits[i], group, placed) {
+					next = i
+					break
+				}
+			}
+			if next < 0 {
+				return fmt.Errorf("the blockers of list %s form a cycle", listId)
+			}
+			placed[next] = true
+			sorted = append(sorted, group[next].Id)
+		}
+		if err := tx.arrangeSiblings(ctx, listId, parentId, current, sorted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitsForAny tells whether any item of group that is not placed yet is in
+// waited.
+func waitsForAny(waited map[string]bool, group []structs.TodoItem, placed []bool) bool {
+	for i, item := range group {
+		if !placed[i] && waited[item.Id] {
+			return true
+		}
+	}
+	return false
+}
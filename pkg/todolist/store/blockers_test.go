@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.altair.com/todolist/pkg/auth"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+func TestBlockers(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			testBlockers(t, NewSqlStore(db, WithRankStrategy(strategy)))
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testBlockers(t, NewMemoryStore())
+	})
+}
+
+// testBlockers runs the same blocker scenario against any Store.
+func testBlockers(t *testing.T, store Store) {
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	add := func(item structs.TodoItem) structs.TodoItem {
+		update(func(tx Txn) error { return tx.Add(ctx, &item) })
+		return item
+	}
+	get := func(id string) structs.TodoItem {
+		var item structs.TodoItem
+		update(func(tx Txn) error { return tx.Get(ctx, id, &item) })
+		return item
+	}
+	block := func(id, blockerId string) error {
+		return store.Update(func(tx Txn) error { return tx.AddBlocker(ctx, id, blockerId) })
+	}
+	// ordered returns the names of the sub-tasks of parentId in their order
+	ordered := func(parentId string) []string {
+		var items structs.TodoItemList
+		update(func(tx Txn) error { return tx.List(ctx, DefaultListId, structs.ItemQuery{}, &items) })
+		siblings := make([]structs.TodoItem, 0)
+		for _, item := range items.Items {
+			if item.ParentId == parentId {
+				siblings = append(siblings, item)
+			}
+		}
+		sort.Slice(siblings, func(i, j int) bool { return siblings[i].Order < siblings[j].Order })
+		return itemNames(siblings)
+	}
+
+	a := add(structs.TodoItem{Item: "a"})
+	b := add(structs.TodoItem{Item: "b"})
+	c := add(structs.TodoItem{Item: "c"})
+	d := add(structs.TodoItem{Item: "d"})
+	e := add(structs.TodoItem{Item: "e"})
+	var work structs.List
+	update(func(tx Txn) error {
+		work = structs.List{Name: "Work"}
+		return tx.AddList(ctx, &work)
+	})
+	x := add(structs.TodoItem{ListId: work.Id, Item: "x"})
+
+	require.NoError(t, block(a.Id, c.Id))
+	blocked := get(a.Id)
+	assert.True(t, blocked.Blocked)
+	assert.Equal(t, []string{c.Id}, blocked.BlockedBy)
+	assert.Equal(t, 2, blocked.Version)
+	assert.False(t, get(c.Id).Blocked)
+	require.NoError(t, block(a.Id, c.Id))
+	assert.Equal(t, 2, get(a.Id).Version, "a blocker that is there already is no write")
+
+	// across lists, but never in a cycle
+	require.NoError(t, block(c.Id, x.Id))
+	require.NoError(t, block(x.Id, e.Id))
+	assert.Error(t, block(a.Id, a.Id))
+	assert.Error(t, block(c.Id, a.Id))
+	assert.Error(t, block(e.Id, a.Id), "a waits for e through c and x")
+	assert.True(t, IsNotFound(block(a.Id, "unknown")))
+	bob := auth.WithPrincipal(ctx, "bob")
+	err := store.Update(func(tx Txn) error { return tx.AddBlocker(bob, a.Id, b.Id) })
+	assert.True(t, IsNotFound(err))
+
+	// done blockers block no more
+	update(func(tx Txn) error { return tx.Complete(ctx, c.Id, true, &structs.TodoItem{}) })
+	blocked = get(a.Id)
+	assert.False(t, blocked.Blocked)
+	assert.Equal(t, []string{c.Id}, blocked.BlockedBy)
+	update(func(tx Txn) error { return tx.Complete(ctx, c.Id, false, &structs.TodoItem{}) })
+	assert.True(t, get(a.Id).Blocked)
+
+	// every item comes after those it waits for, the others keep their order
+	s1 := add(structs.TodoItem{ParentId: a.Id, Item: "s1"})
+	s2 := add(structs.TodoItem{ParentId: a.Id, Item: "s2"})
+	require.NoError(t, block(b.Id, d.Id))
+	require.NoError(t, block(s1.Id, s2.Id))
+	update(func(tx Txn) error { return tx.SortByBlockers(ctx, DefaultListId) })
+	assert.Equal(t, []string{"d", "b", "e", "c", "a"}, ordered(""))
+	assert.Equal(t, []string{"s2", "s1"}, ordered(a.Id))
+	version := get(d.Id).Version
+	update(func(tx Txn) error { return tx.SortByBlockers(ctx, DefaultListId) })
+	assert.Equal(t, []string{"d", "b", "e", "c", "a"}, ordered(""))
+	assert.Equal(t, version, get(d.Id).Version, "a sorted list stays as it is")
+
+	update(func(tx Txn) error { return tx.RemoveBlocker(ctx, b.Id, d.Id) })
+	assert.Empty(t, get(b.Id).BlockedBy)
+	update(func(tx Txn) error { return tx.RemoveBlocker(ctx, b.Id, d.Id) })
+
+	// blockers in the trash are left out until they are restored
+	update(func(tx Txn) error { return tx.Delete(ctx, c.Id, &structs.TodoItemList{}) })
+	assert.Empty(t, get(a.Id).BlockedBy)
+	assert.False(t, get(a.Id).Blocked)
+	assert.Error(t, block(e.Id, a.Id), "the trash still counts towards cycles")
+	update(func(tx Txn) error { return tx.Restore(ctx, c.Id, 0, &structs.TodoItem{}) })
+	assert.Equal(t, []string{c.Id}, get(a.Id).BlockedBy)
+
+	// and dropped when they are purged
+	update(func(tx Txn) error { return tx.Delete(ctx, c.Id, &structs.TodoItemList{}) })
+	update(func(tx Txn) error {
+		_, err := tx.PurgeTrash(ctx, time.Now().Add(time.Second))
+		return err
+	})
+	require.NoError(t, block(e.Id, a.Id))
+}
+
+func TestBlockersOfManyItems(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			ids := seedItems(t, db, strategy, "", 1200)
+			store := NewSqlStore(db, WithRankStrategy(strategy))
+			ctx := context.Background()
+			update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+			update(func(tx Txn) error { return tx.AddBlocker(ctx, ids[1199], ids[0]) })
+			update(func(tx Txn) error { return tx.TagItem(ctx, ids[1199], "home") })
+
+			// a whole list of more items than a statement can bind ids
+			var items structs.TodoItemList
+			update(func(tx Txn) error { return tx.List(ctx, DefaultListId, structs.ItemQuery{}, &items) })
+			require.Equal(t, 1200, items.Count)
+			byId := make(map[string]structs.TodoItem, items.Count)
+			for _, item := range items.Items {
+				byId[item.Id] = item
+			}
+			assert.Equal(t, []string{ids[0]}, byId[ids[1199]].BlockedBy)
+			assert.True(t, byId[ids[1199]].Blocked)
+			assert.Equal(t, []string{"home"}, byId[ids[1199]].Tags)
+			assert.Empty(t, byId[ids[0]].BlockedBy)
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+)
+
+// CompletionPolicy decides where completed items go in the order of their list.
+type CompletionPolicy string
+
+const (
+	// KeepPlace leaves completed items where they are.
+	KeepPlace CompletionPolicy = "keep"
+	// SinkToBottom moves completed items below the open ones. Open items are
+	// ordered above the completed ones and completed items below the open
+	// ones; an item that is opened again goes right after the open items.
+	SinkToBottom CompletionPolicy = "sink"
+	// LeaveSequence takes completed items out of the order: their order is 0
+	// and they cannot be reordered. An item that is opened again goes to the
+	// end of its list.
+	LeaveSequence CompletionPolicy = "leave"
+)
+
+func ParseCompletionPolicy(name string) (CompletionPolicy, error) {
+	switch CompletionPolicy(name) {
+	case KeepPlace, SinkToBottom, LeaveSequence:
+		return CompletionPolicy(name), nil
+	default:
+		return "", fmt.Errorf("unknown completion policy %q, expected %q, %q or %q", name, KeepPlace, SinkToBottom, LeaveSequence)
+	}
+}
+
+// completionRange returns the orders an item can take in a list with open
+// open items and ordered items with a position, neither counting the item
+// itself. Completed items cannot be ordered when they leave the sequence.
+func completionRange(policy CompletionPolicy, done bool, open, ordered int) (first, last int, err error) {
+	switch {
+	case policy == LeaveSequence && done:
+		return 0, 0, fmt.Errorf("completed items are not ordered")
+	case policy == SinkToBottom && done:
+		return open + 1, ordered + 1, nil
+	case policy == SinkToBottom:
+		return 1, open + 1, nil
+	default:
+		return 1, ordered + 1, nil
+	}
+}
+
+// checkCompletionOrder validates the order an item is put at against
+// completionRange, where 0 picks the last order of the range.
+func checkCompletionOrder(policy CompletionPolicy, done bool, open, ordered, order int) (int, error) {
+	first, last, err := completionRange(policy, done, open, ordered)
+	if err != nil {
+		return 0, err
+	}
+	if order == 0 {
+		return last, nil
+	}
+	if order < first || order > last {
+		return 0, fmt.Errorf("order should be between %d and %d and you provided %d", first, last, order)
+	}
+	return order, nil
+}
+
+// checkMoveOrder validates the order an item already in the sequence is
+// moved to against completionRange, whatever the policy, as it can only take
+// the place of another item.
+func checkMoveOrder(policy CompletionPolicy, done bool, open, ordered, order int) error {
+	first, last, err := completionRange(policy, done, open, ordered)
+	if err != nil {
+		return err
+	}
+	if order < first || order > last {
+		return fmt.Errorf("order should be between %d and %d and you provided %d", first, last, order)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+func TestParseCompletionPolicy(t *testing.T) {
+	policy, err := ParseCompletionPolicy("sink")
+	assert.NoError(t, err)
+	assert.Equal(t, SinkToBottom, policy)
+
+	_, err = ParseCompletionPolicy("archive")
+	assert.Error(t, err)
+}
+
+func TestCompletionPolicies(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			testCompletion(t, func(policy CompletionPolicy) Store {
+				db := setupSQLiteDB(t)
+				require.NoError(t, PrepareRanks(db, strategy))
+				return NewSqlStore(db, WithRankStrategy(strategy), WithCompletionPolicy(policy))
+			})
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testCompletion(t, func(policy CompletionPolicy) Store {
+			return NewMemoryStore(WithCompletionPolicy(policy))
+		})
+	})
+}
+
+// testCompletion runs the same completion scenario against any Store.
+func testCompletion(t *testing.T, newStore func(policy CompletionPolicy) Store) {
+	ctx := context.Background()
+
+	setup := func(policy CompletionPolicy) (Store, []structs.TodoItem) {
+		store := newStore(policy)
+		items := make([]structs.TodoItem, 0, 4)
+		for _, name := range []string{"a", "b", "c", "d"} {
+			item := structs.TodoItem{Item: name}
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.Add(ctx, &item) }))
+			items = append(items, item)
+		}
+		return store, items
+	}
+	complete := func(store Store, id string, done bool) (structs.TodoItem, error) {
+		var item structs.TodoItem
+		err := store.Update(func(tx Txn) error { return tx.Complete(ctx, id, done, &item) })
+		return item, err
+	}
+	orders := func(items []structs.TodoItem) []int {
+		orders := make([]int, 0, len(items))
+		for _, item := range items {
+			orders = append(orders, item.Order)
+		}
+		return orders
+	}
+
+	t.Run("Keep", func(t *testing.T) {
+		store, items := setup(KeepPlace)
+
+		b, err := complete(store, items[1].Id, true)
+		require.NoError(t, err)
+		assert.True(t, b.Done)
+		assert.NotNil(t, b.CompletedAt)
+		assert.Equal(t, 2, b.Order)
+		assert.Equal(t, []string{"a", "b", "c", "d"}, itemNames(listStoreItems(t, store)))
+
+		// completing twice changes nothing
+		again, err := complete(store, items[1].Id, true)
+		require.NoError(t, err)
+		assert.Equal(t, b.CompletedAt.Unix(), again.CompletedAt.Unix())
+
+		require.NoError(t, store.Update(func(tx Txn) error { return tx.Reorder(ctx, items[1].Id, 4) }))
+		assert.Equal(t, []string{"a", "c", "d", "b"}, itemNames(listStoreItems(t, store)))
+
+		b, err = complete(store, items[1].Id, false)
+		require.NoError(t, err)
+		assert.False(t, b.Done)
+		assert.Nil(t, b.CompletedAt)
+		assert.Equal(t, 4, b.Order)
+	})
+
+	t.Run("Sink", func(t *testing.T) {
+		store, items := setup(SinkToBottom)
+
+		b, err := complete(store, items[1].Id, true)
+		require.NoError(t, err)
+		assert.Equal(t, 4, b.Order)
+		_, err = complete(store, items[0].Id, true)
+		require.NoError(t, err)
+		all := listStoreItems(t, store)
+		assert.Equal(t, []string{"c", "d", "b", "a"}, itemNames(all))
+		assert.Equal(t, []int{1, 2, 3, 4}, orders(all))
+
+		// new items go below the open items and above the completed ones
+		e := structs.TodoItem{Item: "e"}
+		require.NoError(t, store.Update(func(tx Txn) error { return tx.Add(ctx, &e) }))
+		assert.Equal(t, 3, e.Order)
+		err = store.Update(func(tx Txn) error { return tx.Add(ctx, &structs.TodoItem{Item: "f", Order: 5}) })
+		assert.EqualError(t, err, "order should be between 1 and 4 and you provided 5")
+
+		// open and completed items stay on their side
+		err = store.Update(func(tx Txn) error { return tx.Reorder(ctx, items[2].Id, 4) })
+		assert.EqualError(t, err, "order should be between 1 and 3 and you provided 4")
+		err = store.Update(func(tx Txn) error { return tx.Reorder(ctx, items[0].Id, 1) })
+		assert.EqualError(t, err, "order should be between 4 and 5 and you provided 1")
+		require.NoError(t, store.Update(func(tx Txn) error { return tx.Reorder(ctx, items[0].Id, 4) }))
+		assert.Equal(t, []string{"c", "d", "e", "a", "b"}, itemNames(listStoreItems(t, store)))
+
+		// an item opened again goes right after the open items
+		b, err = complete(store, items[1].Id, false)
+		require.NoError(t, err)
+		assert.Equal(t, 4, b.Order)
+		all = listStoreItems(t, store)
+		assert.Equal(t, []string{"c", "d", "e", "b", "a"}, itemNames(all))
+		assert.Equal(t, []int{1, 2, 3, 4, 5}, orders(all))
+	})
+
+	t.Run("Leave", func(t *testing.T) {
+		store, items := setup(LeaveSequence)
+
+		b, err := complete(store, items[1].Id, true)
+		require.NoError(t, err)
+		assert.Equal(t, 0, b.Order)
+		_, err = complete(store, items[2].Id, true)
+		require.NoError(t, err)
+		all := listStoreItems(t, store)
+		assert.ElementsMatch(t, []string{"b", "c"}, itemNames(all[:2]))
+		assert.Equal(t, []string{"a", "d"}, itemNames(all[2:]))
+		assert.Equal(t, []int{0, 0, 1, 2}, orders(all))
+
+		err = store.Update(func(tx Txn) error { return tx.Reorder(ctx, items[1].Id, 1) })
+		assert.EqualError(t, err, "completed items are not ordered")
+		err = store.Update(func(tx Txn) error {
+			return tx.Update(ctx, &structs.TodoItem{Id: items[1].Id, Item: "b2", Order: 1})
+		})
+		assert.EqualError(t, err, "completed items are not ordered")
+		require.NoError(t, store.Update(func(tx Txn) error {
+			return tx.Update(ctx, &structs.TodoItem{Id: items[1].Id, Item: "b2"})
+		}))
+
+		// new items only count the ordered ones
+		e := structs.TodoItem{Item: "e"}
+		require.NoError(t, store.Update(func(tx Txn) error { return tx.Add(ctx, &e) }))
+		assert.Equal(t, 3, e.Order)
+
+		// an item opened again goes to the end of its list
+		c, err := complete(store, items[2].Id, false)
+		require.NoError(t, err)
+		assert.Equal(t, 4, c.Order)
+
+		// deleting an item without an order shifts nothing
+		var shifted structs.TodoItemList
+		require.NoError(t, store.Update(func(tx Txn) error { return tx.Delete(ctx, items[1].Id, &shifted) }))
+		assert.Empty(t, shifted.Items)
+		all = listStoreItems(t, store)
+		assert.Equal(t, []string{"a", "d", "e", "c"}, itemNames(all))
+		assert.Equal(t, []int{1, 2, 3, 4}, orders(all))
+	})
+}
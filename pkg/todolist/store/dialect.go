@@ -0,0 +1,65 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// dialect holds the behaviour that differs between the supported databases.
+// Queries themselves are shared: placeholders go through Rebind and the
+// reserved "order" column is always written as the quoted lower-case
+// identifier, which SQLite and Postgres both resolve to the same column.
+type dialect struct {
+	name string
+	// isolation is the level requested for every Update transaction.
+	isolation sql.IsolationLevel
+	// retryable reports whether a failed transaction may succeed when re-run.
+	retryable func(err error) bool
+}
+
+var sqliteDialect = dialect{
+	name:      "sqlite",
+	isolation: sql.LevelDefault,
+	retryable: isSQLiteBusy,
+}
+
+var postgresDialect = dialect{
+	name:      "postgres",
+	isolation: sql.LevelSerializable,
+	retryable: isPostgresSerializationFailure,
+}
+
+func dialectFor(driverName string) dialect {
+	switch driverName {
+	case "pgx", "postgres":
+		return postgresDialect
+	default:
+		return sqliteDialect
+	}
+}
+
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+func isPostgresSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == pgSerializationFailure || pgErr.Code == pgDeadlockDetected
+}
+
+// isSQLiteBusy reports lock conflicts between concurrent transactions, e.g.
+// two transactions that both read and then both try to write.
+func isSQLiteBusy(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+}
@@ -0,0 +1,1274 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"go.altair.com/todolist/pkg/auth"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// NewMemoryStore returns a Store that keeps everything in memory. Transactions
+// are serialized and work on a copy-on-write snapshot of the data, which is
+// only published when the action succeeds.
+func NewMemoryStore(opts ...Option) Store {
+	o := newOptions(opts)
+	return &memoryStore{
+		completion: o.completion,
+		clock:      o.clock,
+		state: &memoryState{
+			items: map[ownedId]structs.TodoItem{},
+			// other users get their default list when they first need it
+			lists: map[ownedId]structs.List{
+				{auth.Anonymous, DefaultListId}: {Id: DefaultListId, Name: defaultListName, Order: 1},
+			},
+			trash:       map[ownedId]bool{},
+			attachments: map[ownedId]structs.Attachment{},
+			blockers:    map[blocker]bool{},
+		},
+	}
+}
+
+type memoryStore struct {
+	mu         sync.Mutex
+	state      *memoryState
+	completion CompletionPolicy
+	clock      func() time.Time
+}
+
+// ownedId identifies an item or a list, whose ids are unique per owner.
+type ownedId struct {
+	owner string
+	id    string
+}
+
+// memoryState is never modified once published; transactions clone it first.
+type memoryState struct {
+	items map[ownedId]structs.TodoItem
+	lists map[ownedId]structs.List
+	// trash holds the items in the trash that were deleted themselves, rather
+	// than along with their parent; their Order is the one they had.
+	trash map[ownedId]bool
+	// attachments are keyed by their own id.
+	attachments map[ownedId]structs.Attachment
+	blockers    map[blocker]bool
+}
+
+// blocker is an item of owner that another one waits for.
+type blocker struct {
+	owner     string
+	itemId    string
+	blockerId string
+}
+
+func (s *memoryState) clone() *memoryState {
+	items := make(map[ownedId]structs.TodoItem, len(s.items))
+	for id, item := range s.items {
+		items[id] = item
+	}
+	lists := make(map[ownedId]structs.List, len(s.lists))
+	for id, list := range s.lists {
+		lists[id] = list
+	}
+	trash := make(map[ownedId]bool, len(s.trash))
+	for id := range s.trash {
+		trash[id] = true
+	}
+	attachments := make(map[ownedId]structs.Attachment, len(s.attachments))
+	for id, attachment := range s.attachments {
+		attachments[id] = attachment
+	}
+	blockers := make(map[blocker]bool, len(s.blockers))
+	for edge := range s.blockers {
+		blockers[edge] = true
+	}
+	return &memoryState{
+		items:       items,
+		lists:       lists,
+		trash:       trash,
+		attachments: attachments,
+		blockers:    blockers,
+	}
+}
+
+func (s *memoryStore) Update(action func(tx Txn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryStoreTxn{
+		state:      s.state,
+		completion: s.completion,
+		clock:      s.clock,
+	}
+
+	err := action(tx)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Transaction rollback due to error: %v", err))
+		return err
+	}
+
+	s.state = tx.state
+	return nil
+}
+
+type memoryStoreTxn struct {
+	state      *memoryState
+	copied     bool
+	completion CompletionPolicy
+	clock      func() time.Time
+}
+
+// write returns the transaction's private copy of the state, cloning the
+// published snapshot on the first write.
+func (tx *memoryStoreTxn) write() *memoryState {
+	if !tx.copied {
+		tx.state = tx.state.clone()
+		tx.copied = true
+	}
+	return tx.state
+}
+
+// siblings are the items ordered together: the sub-tasks of parentId in one
+// of the lists of owner, or its top-level items when parentId is empty.
+type siblings struct {
+	owner    string
+	listId   string
+	parentId string
+}
+
+// siblingsOf returns the group an item of owner is ordered in.
+func siblingsOf(owner string, item structs.TodoItem) siblings {
+	return siblings{owner, item.ListId, item.ParentId}
+}
+
+// contains leaves out the items in the trash.
+func (g siblings) contains(key ownedId, item structs.TodoItem) bool {
+	return key.owner == g.owner && item.ListId == g.listId && item.ParentId == g.parentId && item.DeletedAt == nil
+}
+
+// live returns an item of owner, unless it is missing or in the trash.
+func (tx *memoryStoreTxn) live(owner, id string) (structs.TodoItem, bool) {
+	item, ok := tx.state.items[ownedId{owner, id}]
+	return item, ok && item.DeletedAt == nil
+}
+
+// maxOrder returns the order of the last item in the group.
+func (tx *memoryStoreTxn) maxOrder(g siblings) int {
+	maxOrder := 0
+	for key, item := range tx.state.items {
+		if g.contains(key, item) && item.Order > maxOrder {
+			maxOrder = item.Order
+		}
+	}
+	return maxOrder
+}
+
+// shiftItems adds delta to the order of the items of the group from one
+// order up to another.
+func (tx *memoryStoreTxn) shiftItems(g siblings, from, to, delta int) {
+	state := tx.write()
+	for key, item := range state.items {
+		if g.contains(key, item) && item.Order >= from && item.Order <= to {
+			item.Order += delta
+			state.items[key] = item
+		}
+	}
+}
+
+// touch bumps the version of an item after a write to it and sets the time
+// it was last updated, see the SQL store.
+func (tx *memoryStoreTxn) touch(key ownedId) structs.TodoItem {
+	state := tx.write()
+	item := state.items[key]
+	now := writeTime()
+	item.Version++
+	item.UpdatedAt = &now
+	state.items[key] = item
+	return item
+}
+
+// checkOrder validates the order of a new entry in a sequence whose last
+// order is maxOrder, where 0 means the end. It returns the order to insert at.
+func checkOrder(order, maxOrder int) (int, error) {
+	if order == 0 {
+		order = maxOrder + 1
+	}
+	if maxOrder == 0 {
+		if order != 1 {
+			return 0, fmt.Errorf("order should be 1 for the first item, but got %d", order)
+		}
+	} else if order < 1 || order > maxOrder+1 {
+		return 0, fmt.Errorf("order should be between 1 and %d and you provided %d", maxOrder+1, order)
+	}
+	return order, nil
+}
+
+// completionOrder checks the order an item is put at in the group against
+// the completion policy, see checkCompletionOrder.
+func (tx *memoryStoreTxn) completionOrder(g siblings, id string, done bool, order int) (int, error) {
+	if tx.completion == KeepPlace || (tx.completion == LeaveSequence && !done) {
+		return order, nil
+	}
+	open, ordered := tx.countOrdered(g, id)
+	return checkCompletionOrder(tx.completion, done, open, ordered, order)
+}
+
+// moveOrder checks the order an item of the group is moved to, see
+// checkMoveOrder.
+func (tx *memoryStoreTxn) moveOrder(g siblings, id string, done bool, order int) error {
+	open, ordered := tx.countOrdered(g, id)
+	return checkMoveOrder(tx.completion, done, open, ordered, order)
+}
+
+// countOrdered counts the open items and all items of the group with an
+// order, leaving out the item with id.
+func (tx *memoryStoreTxn) countOrdered(g siblings, id string) (open, ordered int) {
+	for key, item := range tx.state.items {
+		if g.contains(key, item) && item.Id != id && item.Order > 0 {
+			ordered++
+			if !item.Done {
+				open++
+			}
+		}
+	}
+	return open, ordered
+}
+
+// descendants returns the ids of the sub-tasks of an item of owner, at any
+// depth.
+func (tx *memoryStoreTxn) descendants(owner, id string) []string {
+	children := map[string][]string{}
+	for key, item := range tx.state.items {
+		if key.owner == owner && item.ParentId != "" {
+			children[item.ParentId] = append(children[item.ParentId], item.Id)
+		}
+	}
+	ids := make([]string, 0)
+	for pending := children[id]; len(pending) > 0; pending = pending[1:] {
+		ids = append(ids, pending[0])
+		pending = append(pending, children[pending[0]]...)
+	}
+	return ids
+}
+
+// checkParent fails unless parentId is empty or an item in the list.
+func (tx *memoryStoreTxn) checkParent(owner, listId, parentId string) error {
+	if parentId == "" {
+		return nil
+	}
+	parent, ok := tx.live(owner, parentId)
+	if !ok {
+		return fmt.Errorf("unknown parent item %s", parentId)
+	}
+	if parent.ListId != listId {
+		return fmt.Errorf("the parent item is in another list")
+	}
+	return nil
+}
+
+func (tx *memoryStoreTxn) DbTx() interface{} {
+	return nil
+}
+
+func (tx *memoryStoreTxn) CheckId(ctx context.Context, id string) error {
+	if _, ok := tx.live(auth.Principal(ctx), id); !ok {
+		log.Debug().Msg(fmt.Sprintf("ID %s does not exist", id))
+		return NotFoundf("ID %s does not exist", id)
+	}
+	return nil
+}
+
+// checkListId fails unless the principal in ctx has a list with the id. The
+// default list is created when it is missing.
+func (tx *memoryStoreTxn) checkListId(ctx context.Context, id string) error {
+	if _, ok := tx.state.lists[ownedId{auth.Principal(ctx), id}]; !ok {
+		if id == DefaultListId {
+			return tx.AddList(ctx, &structs.List{Id: DefaultListId, Name: defaultListName})
+		}
+		log.Debug().Msg(fmt.Sprintf("List %s does not exist", id))
+		return NotFoundf("list %s does not exist", id)
+	}
+	return nil
+}
+
+func (tx *memoryStoreTxn) Add(ctx context.Context, record *structs.TodoItem) error {
+	// Generate a UUID if the ID is empty
+	if record.Id == "" {
+		record.Id = uuid.New().String()
+	}
+	if record.ListId == "" {
+		record.ListId = DefaultListId
+	}
+	// items are created open, see Complete
+	record.Done = false
+	record.CompletedAt = nil
+	record.DueAt = utcSeconds(record.DueAt)
+	record.Tags = nil
+	record.Blocked, record.BlockedBy = false, nil
+	record.NotesHTML = ""
+	record.NextId = ""
+	now := writeTime()
+	record.Version, record.CreatedAt, record.UpdatedAt = 1, &now, &now
+
+	owner := auth.Principal(ctx)
+	if _, ok := tx.live(owner, record.Id); ok {
+		return fmt.Errorf("ID %s already exists", record.Id)
+	}
+	// the id of a deleted item is free again, for clients that pick their own
+	tx.discardTrashed(owner, record.Id)
+	if err := tx.checkListId(ctx, record.ListId); err != nil {
+		return err
+	}
+	if err := tx.checkParent(owner, record.ListId, record.ParentId); err != nil {
+		return err
+	}
+
+	group := siblingsOf(owner, *record)
+	order, err := tx.completionOrder(group, record.Id, false, record.Order)
+	if err != nil {
+		return err
+	}
+	maxOrder := tx.maxOrder(group)
+	order, err = checkOrder(order, maxOrder)
+	if err != nil {
+		return err
+	}
+	record.Order = order
+
+	// the items from the new order onwards move down by one
+	tx.shiftItems(group, record.Order, maxOrder, 1)
+	tx.write().items[ownedId{owner, record.Id}] = *record
+	return nil
+}
+
+func (tx *memoryStoreTxn) Delete(ctx context.Context, id string, shifted *structs.TodoItemList) error {
+	owner := auth.Principal(ctx)
+	deleted, ok := tx.live(owner, id)
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
+		return NotFoundf("unknown id")
+	}
+
+	// the sub-tasks go to the trash with their item and keep their places
+	// under it, the ones that are already there stay with what they went with
+	state := tx.write()
+	now := writeTime()
+	for _, descendant := range tx.descendants(owner, id) {
+		sub := state.items[ownedId{owner, descendant}]
+		if sub.DeletedAt == nil {
+			sub.DeletedAt = &now
+			state.items[ownedId{owner, descendant}] = sub
+		}
+	}
+	// the item keeps its order, to be restored there
+	deleted.DeletedAt = &now
+	state.items[ownedId{owner, id}] = deleted
+	state.trash[ownedId{owner, id}] = true
+	tx.touch(ownedId{owner, id})
+
+	// every sibling after the deleted item moves up by one to close the gap,
+	// unless it had left the sequence
+	group := siblingsOf(owner, deleted)
+	shifted.Items = make([]structs.TodoItem, 0)
+	for key, item := range state.items {
+		if deleted.Order > 0 && group.contains(key, item) && item.Order > deleted.Order {
+			item.Order--
+			state.items[key] = item
+			tx.withBlockers(owner, &item)
+			shifted.Items = append(shifted.Items, item)
+		}
+	}
+	sort.Slice(shifted.Items, func(i, j int) bool {
+		return shifted.Items[i].Order < shifted.Items[j].Order
+	})
+	shifted.Count = len(shifted.Items)
+	return nil
+}
+
+// trashedWith returns the ids of the sub-tasks of an item of owner that went
+// to the trash along with it, see the SQL store.
+func (tx *memoryStoreTxn) trashedWith(owner, id string) []string {
+	children := map[string][]string{}
+	for key, item := range tx.state.items {
+		if key.owner == owner && item.DeletedAt != nil && !tx.state.trash[key] {
+			children[item.ParentId] = append(children[item.ParentId], item.Id)
+		}
+	}
+	ids := make([]string, 0)
+	for pending := children[id]; len(pending) > 0; pending = pending[1:] {
+		ids = append(ids, pending[0])
+		pending = append(pending, children[pending[0]]...)
+	}
+	return ids
+}
+
+// discardTrashed deletes an item of owner for good if it is in the trash,
+// along with the sub-tasks that went there with it.
+func (tx *memoryStoreTxn) discardTrashed(owner, id string) {
+	if item, ok := tx.state.items[ownedId{owner, id}]; !ok || item.DeletedAt == nil {
+		return
+	}
+	for _, sub := range append(tx.trashedWith(owner, id), id) {
+		tx.remove(ownedId{owner, sub})
+	}
+}
+
+// remove deletes an item for good, along with its attachments.
+func (tx *memoryStoreTxn) remove(key ownedId) {
+	state := tx.write()
+	delete(state.items, key)
+	delete(state.trash, key)
+	for attachmentKey, attachment := range state.attachments {
+		if attachmentKey.owner == key.owner && attachment.ItemId == key.id {
+			delete(state.attachments, attachmentKey)
+		}
+	}
+	for edge := range state.blockers {
+		if edge.owner == key.owner && (edge.itemId == key.id || edge.blockerId == key.id) {
+			delete(state.blockers, edge)
+		}
+	}
+}
+
+func (tx *memoryStoreTxn) ListTrash(ctx context.Context, items *structs.TodoItemList) error {
+	owner := auth.Principal(ctx)
+	items.Items = make([]structs.TodoItem, 0)
+	for key := range tx.state.trash {
+		if key.owner == owner {
+			item := tx.state.items[key]
+			tx.withBlockers(owner, &item)
+			items.Items = append(items.Items, item)
+		}
+	}
+	sort.Slice(items.Items, func(i, j int) bool {
+		if !items.Items[i].DeletedAt.Equal(*items.Items[j].DeletedAt) {
+			return items.Items[i].DeletedAt.After(*items.Items[j].DeletedAt)
+		}
+		return items.Items[i].Id < items.Items[j].Id
+	})
+	items.Count = len(items.Items)
+	return nil
+}
+
+func (tx *memoryStoreTxn) Restore(ctx context.Context, id string, newOrder int, item *structs.TodoItem) error {
+	owner := auth.Principal(ctx)
+	key := ownedId{owner, id}
+	restored, ok := tx.state.items[key]
+	if !ok || !tx.state.trash[key] {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s in the trash", id))
+		return NotFoundf("unknown id")
+	}
+
+	// back under its parent, unless that has gone in the meantime, in which
+	// case its old position means nothing
+	regrouped := false
+	if _, ok := tx.live(owner, restored.ParentId); restored.ParentId != "" && !ok {
+		restored.ParentId, regrouped = "", true
+	}
+	group := siblingsOf(owner, restored)
+	order := 0
+	if restored.Done && tx.completion == LeaveSequence {
+		// completed items stay out of the sequence
+		if newOrder != 0 {
+			return fmt.Errorf("completed items are not ordered")
+		}
+	} else {
+		maxOrder := tx.maxOrder(group)
+		order = newOrder
+		if order == 0 && !regrouped && restored.Order > 0 && restored.Order <= maxOrder+1 {
+			// where it was, unless the completion policy no longer allows it
+			if _, err := tx.completionOrder(group, id, restored.Done, restored.Order); err == nil {
+				order = restored.Order
+			}
+		}
+		var err error
+		order, err = tx.completionOrder(group, id, restored.Done, order)
+		if err != nil {
+			return err
+		}
+		order, err = checkOrder(order, maxOrder)
+		if err != nil {
+			return err
+		}
+		tx.shiftItems(group, order, maxOrder, 1)
+	}
+
+	state := tx.write()
+	for _, sub := range tx.trashedWith(owner, id) {
+		subItem := state.items[ownedId{owner, sub}]
+		subItem.DeletedAt = nil
+		state.items[ownedId{owner, sub}] = subItem
+	}
+	delete(state.trash, key)
+	restored.DeletedAt = nil
+	restored.Order = order
+	state.items[key] = restored
+	*item = tx.touch(key)
+	tx.withBlockers(owner, item)
+	return nil
+}
+
+func (tx *memoryStoreTxn) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	for key, item := range tx.state.items {
+		if item.DeletedAt != nil && item.DeletedAt.Before(before) {
+			tx.remove(key)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (tx *memoryStoreTxn) Update(ctx context.Context, record *structs.TodoItem) error {
+	owner := auth.Principal(ctx)
+	existing, ok := tx.live(owner, record.Id)
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", record.Id))
+		return NotFoundf("unknown id")
+	}
+	// items change lists through MoveItem only, parents through Reparent,
+	// are completed through Complete and tagged through TagItem
+	record.ListId = existing.ListId
+	record.ParentId = existing.ParentId
+	record.Done = existing.Done
+	record.CompletedAt = existing.CompletedAt
+	record.DueAt = utcSeconds(record.DueAt)
+	record.Tags = existing.Tags
+
+	if existing.Order == 0 {
+		// the item has left the sequence, all but its order can change
+		if record.Order != 0 {
+			return fmt.Errorf("completed items are not ordered")
+		}
+		existing.Item = record.Item
+		existing.Notes = record.Notes
+		existing.DueAt = record.DueAt
+		existing.Priority = record.Priority
+		existing.Recurrence = record.Recurrence
+		existing.TimeZone = record.TimeZone
+		tx.write().items[ownedId{owner, record.Id}] = existing
+		*record = tx.touch(ownedId{owner, record.Id})
+		tx.withBlockers(owner, record)
+		return nil
+	}
+	if record.Order == 0 {
+		// without an order the item stays where it is
+		record.Order = existing.Order
+	}
+	if record.Order != existing.Order {
+		if err := tx.moveOrder(siblingsOf(owner, existing), record.Id, existing.Done, record.Order); err != nil {
+			return err
+		}
+	}
+
+	// same as the SQL store: a taken order shifts the items in between
+	group := siblingsOf(owner, existing)
+	for key, item := range tx.state.items {
+		if group.contains(key, item) && item.Id != record.Id && item.Order == record.Order {
+			if err := tx.reorder(ctx, record.Id, record.Order); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	existing.Item = record.Item
+	existing.Notes = record.Notes
+	existing.DueAt = record.DueAt
+	existing.Priority = record.Priority
+	existing.Recurrence = record.Recurrence
+	existing.TimeZone = record.TimeZone
+	existing.Order = record.Order
+	tx.write().items[ownedId{owner, record.Id}] = existing
+	*record = tx.touch(ownedId{owner, record.Id})
+	tx.withBlockers(owner, record)
+	return nil
+}
+
+func (tx *memoryStoreTxn) Reorder(ctx context.Context, id string, newOrder int) error {
+	if err := tx.reorder(ctx, id, newOrder); err != nil {
+		return err
+	}
+	tx.touch(ownedId{auth.Principal(ctx), id})
+	return nil
+}
+
+// reorder moves an item among its siblings, without bumping its version.
+func (tx *memoryStoreTxn) reorder(ctx context.Context, id string, newOrder int) error {
+	if err := tx.CheckId(ctx, id); err != nil {
+		return err
+	}
+
+	owner := auth.Principal(ctx)
+	current := tx.state.items[ownedId{owner, id}]
+	// an item only moves among its siblings, open and completed ones may be
+	// kept apart by the completion policy
+	group := siblingsOf(owner, current)
+	if err := tx.moveOrder(group, id, current.Done, newOrder); err != nil {
+		return err
+	}
+	state := tx.write()
+
+	if newOrder > current.Order {
+		tx.shiftItems(group, current.Order+1, newOrder, -1)
+	} else if newOrder < current.Order {
+		tx.shiftItems(group, newOrder, current.Order-1, 1)
+	}
+
+	current.Order = newOrder
+	state.items[ownedId{owner, id}] = current
+	return nil
+}
+
+func (tx *memoryStoreTxn) MoveItem(ctx context.Context, id string, listId string, newOrder int) error {
+	owner := auth.Principal(ctx)
+	item, ok := tx.live(owner, id)
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
+		return NotFoundf("unknown id")
+	}
+	if item.ListId == listId {
+		// within its own list the item stays among its siblings
+		if err := tx.relocate(ctx, item, siblingsOf(owner, item), newOrder); err != nil {
+			return err
+		}
+		tx.touch(ownedId{owner, id})
+		return nil
+	}
+	if err := tx.checkListId(ctx, listId); err != nil {
+		return err
+	}
+
+	// the item becomes a top-level item of the other list, its sub-tasks follow it
+	if err := tx.relocate(ctx, item, siblings{owner, listId, ""}, newOrder); err != nil {
+		return err
+	}
+	tx.touch(ownedId{owner, id})
+	state := tx.write()
+	for _, descendant := range tx.descendants(owner, id) {
+		sub := state.items[ownedId{owner, descendant}]
+		sub.ListId = listId
+		state.items[ownedId{owner, descendant}] = sub
+		tx.touch(ownedId{owner, descendant})
+	}
+	return nil
+}
+
+func (tx *memoryStoreTxn) Reparent(ctx context.Context, id string, parentId string, newOrder int) error {
+	owner := auth.Principal(ctx)
+	item, ok := tx.live(owner, id)
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
+		return NotFoundf("unknown id")
+	}
+	if err := tx.checkParent(owner, item.ListId, parentId); err != nil {
+		return err
+	}
+	if parentId == id {
+		return fmt.Errorf("an item cannot be moved under itself or its sub-tasks")
+	}
+	for _, descendant := range tx.descendants(owner, id) {
+		if descendant == parentId {
+			return fmt.Errorf("an item cannot be moved under itself or its sub-tasks")
+		}
+	}
+	if err := tx.relocate(ctx, item, siblings{owner, item.ListId, parentId}, newOrder); err != nil {
+		return err
+	}
+	tx.touch(ownedId{owner, id})
+	return nil
+}
+
+// relocate moves an item to newOrder in another group of siblings, or to its
+// end when newOrder is 0. Both groups are renumbered.
+func (tx *memoryStoreTxn) relocate(ctx context.Context, item structs.TodoItem, to siblings, newOrder int) error {
+	from := siblingsOf(to.owner, item)
+	if item.Order == 0 {
+		// the item has left the sequence, so it has no position in either group
+		if newOrder != 0 {
+			return fmt.Errorf("completed items are not ordered")
+		}
+		item.ListId, item.ParentId = to.listId, to.parentId
+		tx.write().items[ownedId{to.owner, item.Id}] = item
+		return nil
+	}
+	newOrder, err := tx.completionOrder(to, item.Id, item.Done, newOrder)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		if newOrder == 0 {
+			newOrder = tx.maxOrder(to)
+		}
+		return tx.reorder(ctx, item.Id, newOrder)
+	}
+
+	maxOrder := tx.maxOrder(to)
+	order, err := checkOrder(newOrder, maxOrder)
+	if err != nil {
+		return err
+	}
+
+	// close the gap among the old siblings and make room among the new ones
+	tx.shiftItems(from, item.Order+1, tx.maxOrder(from), -1)
+	tx.shiftItems(to, order, maxOrder, 1)
+
+	item.ListId, item.ParentId = to.listId, to.parentId
+	item.Order = order
+	tx.write().items[ownedId{to.owner, item.Id}] = item
+	return nil
+}
+
+func (tx *memoryStoreTxn) Get(ctx context.Context, id string, item *structs.TodoItem) error {
+	owner := auth.Principal(ctx)
+	record, ok := tx.live(owner, id)
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
+		return NotFoundf("unknown id")
+	}
+	*item = record
+	tx.withBlockers(owner, item)
+	return nil
+}
+
+func (tx *memoryStoreTxn) Complete(ctx context.Context, id string, done bool, item *structs.TodoItem) error {
+	owner := auth.Principal(ctx)
+	existing, ok := tx.live(owner, id)
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
+		return NotFoundf("unknown id")
+	}
+	if existing.Done == done {
+		*item = existing
+		tx.withBlockers(owner, item)
+		return nil
+	}
+	original := existing
+
+	// the item is placed among its siblings while it is still counted as it was
+	group := siblingsOf(owner, existing)
+	switch {
+	case !done && existing.Order == 0:
+		// back into the sequence, at the end of the open items
+		order, err := tx.completionOrder(group, id, false, 0)
+		if err != nil {
+			return err
+		}
+		maxOrder := tx.maxOrder(group)
+		order, err = checkOrder(order, maxOrder)
+		if err != nil {
+			return err
+		}
+		tx.shiftItems(group, order, maxOrder, 1)
+		existing.Order = order
+	case tx.completion == SinkToBottom:
+		order, err := tx.completionOrder(group, id, done, 0)
+		if err != nil {
+			return err
+		}
+		if order > existing.Order {
+			tx.shiftItems(group, existing.Order+1, order, -1)
+		} else if order < existing.Order {
+			tx.shiftItems(group, order, existing.Order-1, 1)
+		}
+		existing.Order = order
+	case tx.completion == LeaveSequence && done:
+		tx.shiftItems(group, existing.Order+1, tx.maxOrder(group), -1)
+		existing.Order = 0
+	}
+
+	now := tx.clock().UTC()
+	existing.Done = done
+	existing.CompletedAt = nil
+	if done {
+		existing.CompletedAt = &now
+	}
+	tx.write().items[ownedId{owner, id}] = existing
+	*item = tx.touch(ownedId{owner, id})
+	tx.withBlockers(owner, item)
+
+	if done {
+		next, err := nextOccurrence(original, now)
+		if err != nil {
+			return err
+		}
+		if next != nil {
+			// the tags go along, without counting as writes to it
+			tags := next.Tags
+			next.Order = recurrenceOrder(tx.completion, original.Order)
+			if err := tx.Add(ctx, next); err != nil {
+				return err
+			}
+			next.Tags = tags
+			tx.write().items[ownedId{owner, next.Id}] = *next
+			item.NextId = next.Id
+		}
+	}
+	return nil
+}
+
+func hasTag(item structs.TodoItem, tag string) bool {
+	for _, t := range item.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (tx *memoryStoreTxn) TagItem(ctx context.Context, id string, tag string) error {
+	key := ownedId{auth.Principal(ctx), id}
+	item, ok := tx.live(key.owner, id)
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
+		return NotFoundf("unknown id")
+	}
+	if hasTag(item, tag) {
+		return nil
+	}
+
+	// the published snapshot shares the slice, so it is copied
+	tags := append(append(make([]string, 0, len(item.Tags)+1), item.Tags...), tag)
+	sort.Strings(tags)
+	item.Tags = tags
+	tx.write().items[key] = item
+	tx.touch(key)
+	return nil
+}
+
+func (tx *memoryStoreTxn) UntagItem(ctx context.Context, id string, tag string) error {
+	key := ownedId{auth.Principal(ctx), id}
+	item, ok := tx.live(key.owner, id)
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
+		return NotFoundf("unknown id")
+	}
+	if !hasTag(item, tag) {
+		return nil
+	}
+
+	var tags []string
+	for _, t := range item.Tags {
+		if t != tag {
+			tags = append(tags, t)
+		}
+	}
+	item.Tags = tags
+	tx.write().items[key] = item
+	tx.touch(key)
+	return nil
+}
+
+func (tx *memoryStoreTxn) ListTags(ctx context.Context, tags *structs.Tags) error {
+	owner := auth.Principal(ctx)
+	counts := map[string]int{}
+	for key, item := range tx.state.items {
+		if key.owner == owner && item.DeletedAt == nil {
+			for _, tag := range item.Tags {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags.Items = make([]structs.Tag, 0, len(counts))
+	for name, count := range counts {
+		tags.Items = append(tags.Items, structs.Tag{Name: name, Count: count})
+	}
+	sort.Slice(tags.Items, func(i, j int) bool { return tags.Items[i].Name < tags.Items[j].Name })
+	tags.Count = len(tags.Items)
+	return nil
+}
+
+// withBlockers sets the blockers of an item, leaving out those in the trash.
+// They are not stored with the item, since completing a blocker changes them.
+func (tx *memoryStoreTxn) withBlockers(owner string, item *structs.TodoItem) {
+	item.Blocked, item.BlockedBy = false, nil
+	for edge := range tx.state.blockers {
+		if edge.owner != owner || edge.itemId != item.Id {
+			continue
+		}
+		if blocker, ok := tx.live(owner, edge.blockerId); ok {
+			item.BlockedBy = append(item.BlockedBy, blocker.Id)
+			item.Blocked = item.Blocked || !blocker.Done
+		}
+	}
+	sort.Strings(item.BlockedBy)
+}
+
+// waitsFor tells whether the item id of owner waits for blockerId, however
+// indirectly, the items in the trash included.
+func (tx *memoryStoreTxn) waitsFor(owner, id, blockerId string) bool {
+	waited := map[string]bool{}
+	pending := []string{id}
+	for len(pending) > 0 {
+		next := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for edge := range tx.state.blockers {
+			if edge.owner == owner && edge.itemId == next && !waited[edge.blockerId] {
+				waited[edge.blockerId] = true
+				pending = append(pending, edge.blockerId)
+			}
+		}
+	}
+	return waited[blockerId]
+}
+
+func (tx *memoryStoreTxn) AddBlocker(ctx context.Context, id string, blockerId string) error {
+	if id == blockerId {
+		return fmt.Errorf("an item cannot block itself")
+	}
+	if err := tx.CheckId(ctx, id); err != nil {
+		return err
+	}
+	if err := tx.CheckId(ctx, blockerId); err != nil {
+		return err
+	}
+	owner := auth.Principal(ctx)
+	if tx.waitsFor(owner, blockerId, id) {
+		return fmt.Errorf("item %s waits for item %s already", blockerId, id)
+	}
+	edge := blocker{owner, id, blockerId}
+	if tx.state.blockers[edge] {
+		return nil
+	}
+	tx.write().blockers[edge] = true
+	tx.touch(ownedId{owner, id})
+	return nil
+}
+
+func (tx *memoryStoreTxn) RemoveBlocker(ctx context.Context, id string, blockerId string) error {
+	if err := tx.CheckId(ctx, id); err != nil {
+		return err
+	}
+	owner := auth.Principal(ctx)
+	edge := blocker{owner, id, blockerId}
+	if !tx.state.blockers[edge] {
+		return nil
+	}
+	delete(tx.write().blockers, edge)
+	tx.touch(ownedId{owner, id})
+	return nil
+}
+
+func (tx *memoryStoreTxn) MoveRelative(ctx context.Context, id string, move structs.RelativeMove) error {
+	return moveRelative(ctx, tx, tx.completion, id, move)
+}
+
+func (tx *memoryStoreTxn) Arrange(ctx context.Context, listId string, parentId string, ids []string) error {
+	return arrange(ctx, tx, listId, parentId, ids)
+}
+
+func (tx *memoryStoreTxn) arrangeSiblings(ctx context.Context, listId string, parentId string, current []string, wanted []string) error {
+	owner := auth.Principal(ctx)
+	state := tx.write()
+	for i, id := range wanted {
+		if current[i] == id {
+			continue
+		}
+		item := state.items[ownedId{owner, id}]
+		item.Order = i + 1
+		state.items[ownedId{owner, id}] = item
+	}
+	return nil
+}
+
+func (tx *memoryStoreTxn) SortByBlockers(ctx context.Context, listId string) error {
+	return sortByBlockers(ctx, tx, listId)
+}
+
+func (tx *memoryStoreTxn) AddAttachment(ctx context.Context, attachment *structs.Attachment) error {
+	if err := tx.CheckId(ctx, attachment.ItemId); err != nil {
+		return err
+	}
+	createdAt := writeTime()
+	attachment.Id = uuid.New().String()
+	attachment.CreatedAt = &createdAt
+	tx.write().attachments[ownedId{auth.Principal(ctx), attachment.Id}] = *attachment
+	return nil
+}
+
+func (tx *memoryStoreTxn) ListAttachments(ctx context.Context, itemId string, attachments *structs.Attachments) error {
+	if err := tx.CheckId(ctx, itemId); err != nil {
+		return err
+	}
+	owner := auth.Principal(ctx)
+	attachments.Items = make([]structs.Attachment, 0)
+	for key, attachment := range tx.state.attachments {
+		if key.owner == owner && attachment.ItemId == itemId {
+			attachments.Items = append(attachments.Items, attachment)
+		}
+	}
+	sort.Slice(attachments.Items, func(i, j int) bool {
+		if !attachments.Items[i].CreatedAt.Equal(*attachments.Items[j].CreatedAt) {
+			return attachments.Items[i].CreatedAt.Before(*attachments.Items[j].CreatedAt)
+		}
+		return attachments.Items[i].Id < attachments.Items[j].Id
+	})
+	attachments.Count = len(attachments.Items)
+	return nil
+}
+
+func (tx *memoryStoreTxn) GetAttachment(ctx context.Context, itemId string, id string, attachment *structs.Attachment) error {
+	if err := tx.CheckId(ctx, itemId); err != nil {
+		return err
+	}
+	existing, ok := tx.state.attachments[ownedId{auth.Principal(ctx), id}]
+	if !ok || existing.ItemId != itemId {
+		log.Debug().Msg(fmt.Sprintf("Unknown attachment ID %s", id))
+		return NotFoundf("unknown attachment id")
+	}
+	*attachment = existing
+	return nil
+}
+
+func (tx *memoryStoreTxn) DeleteAttachment(ctx context.Context, itemId string, id string) error {
+	var existing structs.Attachment
+	if err := tx.GetAttachment(ctx, itemId, id, &existing); err != nil {
+		return err
+	}
+	delete(tx.write().attachments, ownedId{auth.Principal(ctx), id})
+	return nil
+}
+
+func (tx *memoryStoreTxn) AttachmentsSize(ctx context.Context) (int64, error) {
+	owner := auth.Principal(ctx)
+	var size int64
+	for key, attachment := range tx.state.attachments {
+		if key.owner == owner {
+			size += attachment.Size
+		}
+	}
+	return size, nil
+}
+
+func (tx *memoryStoreTxn) AttachmentDigests(ctx context.Context) (map[string]bool, error) {
+	used := make(map[string]bool)
+	for _, attachment := range tx.state.attachments {
+		used[attachment.Digest] = true
+	}
+	return used, nil
+}
+
+func (tx *memoryStoreTxn) List(ctx context.Context, listId string, query structs.ItemQuery, items *structs.TodoItemList) error {
+	if err := tx.checkListId(ctx, listId); err != nil {
+		return err
+	}
+
+	owner := auth.Principal(ctx)
+	now := tx.clock()
+	total := 0
+	rows := make([]structs.TodoItem, 0)
+	for key, record := range tx.state.items {
+		if key.owner != owner || record.ListId != listId || record.DeletedAt != nil {
+			continue
+		}
+		if query.DueBefore != nil && (record.DueAt == nil || !record.DueAt.Before(*query.DueBefore)) {
+			continue
+		}
+		if query.Overdue && (record.DueAt == nil || !record.DueAt.Before(now) || record.Done) {
+			continue
+		}
+		if query.Priority != "" && record.Priority != query.Priority {
+			continue
+		}
+		if query.Tag != "" && !hasTag(record, query.Tag) {
+			continue
+		}
+		total++
+		if !pastCursor(record, query.Cursor) {
+			continue
+		}
+		tx.withBlockers(owner, &record)
+		rows = append(rows, record)
+	}
+	// the same as the SQL store, closest to the cursor first
+	backward := query.Cursor != nil && query.Cursor.Backward
+	sort.Slice(rows, func(i, j int) bool {
+		if backward {
+			return precedes(rows[j], rows[i])
+		}
+		return precedes(rows[i], rows[j])
+	})
+	if query.Limit > 0 && len(rows) > query.Limit+1 {
+		rows = rows[:query.Limit+1]
+	}
+	paginate(rows, query, total, items)
+	return nil
+}
+
+func (tx *memoryStoreTxn) Siblings(ctx context.Context, listId string, parentId string, items *structs.TodoItemList) error {
+	if err := tx.checkListId(ctx, listId); err != nil {
+		return err
+	}
+	g := siblings{auth.Principal(ctx), listId, parentId}
+	rows := make([]structs.TodoItem, 0)
+	for key, record := range tx.state.items {
+		if g.contains(key, record) && record.Order > 0 {
+			record.Tags = nil
+			rows = append(rows, record)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Order < rows[j].Order })
+	items.Items, items.Count = rows, len(rows)
+	return nil
+}
+
+// shiftLists adds delta to the order of the owner's lists from one order up
+// to another.
+func (tx *memoryStoreTxn) shiftLists(owner string, from, to, delta int) {
+	state := tx.write()
+	for key, list := range state.lists {
+		if key.owner == owner && list.Order >= from && list.Order <= to {
+			list.Order += delta
+			state.lists[key] = list
+		}
+	}
+}
+
+// countLists returns the number of lists of the owner.
+func (tx *memoryStoreTxn) countLists(owner string) int {
+	count := 0
+	for key := range tx.state.lists {
+		if key.owner == owner {
+			count++
+		}
+	}
+	return count
+}
+
+func (tx *memoryStoreTxn) AddList(ctx context.Context, list *structs.List) error {
+	// Generate a UUID if the ID is empty
+	if list.Id == "" {
+		list.Id = uuid.New().String()
+	}
+	owner := auth.Principal(ctx)
+	if _, ok := tx.state.lists[ownedId{owner, list.Id}]; ok {
+		return fmt.Errorf("list %s already exists", list.Id)
+	}
+
+	maxOrder := tx.countLists(owner)
+	order, err := checkOrder(list.Order, maxOrder)
+	if err != nil {
+		return err
+	}
+	list.Order = order
+
+	tx.shiftLists(owner, list.Order, maxOrder, 1)
+	tx.write().lists[ownedId{owner, list.Id}] = *list
+	return nil
+}
+
+func (tx *memoryStoreTxn) DeleteList(ctx context.Context, id string, shifted *structs.Lists) error {
+	if id == DefaultListId {
+		return fmt.Errorf("the default list cannot be deleted")
+	}
+	owner := auth.Principal(ctx)
+	deleted, ok := tx.state.lists[ownedId{owner, id}]
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown list ID %s", id))
+		return NotFoundf("unknown list id")
+	}
+
+	state := tx.write()
+	delete(state.lists, ownedId{owner, id})
+	// the items go with their list
+	for key, item := range state.items {
+		if key.owner == owner && item.ListId == id {
+			tx.remove(key)
+		}
+	}
+
+	// every list after the deleted one moves up by one to close the gap
+	shifted.Items = make([]structs.List, 0)
+	for key, list := range state.lists {
+		if key.owner == owner && list.Order > deleted.Order {
+			list.Order--
+			state.lists[key] = list
+			shifted.Items = append(shifted.Items, list)
+		}
+	}
+	sort.Slice(shifted.Items, func(i, j int) bool {
+		return shifted.Items[i].Order < shifted.Items[j].Order
+	})
+	shifted.Count = len(shifted.Items)
+	return nil
+}
+
+func (tx *memoryStoreTxn) UpdateList(ctx context.Context, list *structs.List) error {
+	key := ownedId{auth.Principal(ctx), list.Id}
+	existing, ok := tx.state.lists[key]
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown list ID %s", list.Id))
+		return NotFoundf("unknown list id")
+	}
+
+	existing.Name = list.Name
+	tx.write().lists[key] = existing
+
+	// without an order the list stays where it is
+	if list.Order == 0 {
+		return nil
+	}
+	return tx.ReorderList(ctx, list.Id, list.Order)
+}
+
+func (tx *memoryStoreTxn) ReorderList(ctx context.Context, id string, newOrder int) error {
+	if err := tx.checkListId(ctx, id); err != nil {
+		return err
+	}
+	owner := auth.Principal(ctx)
+	if count := tx.countLists(owner); newOrder < 1 || newOrder > count {
+		return fmt.Errorf("order should be between 1 and %d and you provided %d", count, newOrder)
+	}
+
+	current := tx.state.lists[ownedId{owner, id}]
+	if newOrder > current.Order {
+		tx.shiftLists(owner, current.Order+1, newOrder, -1)
+	} else if newOrder < current.Order {
+		tx.shiftLists(owner, newOrder, current.Order-1, 1)
+	}
+
+	current.Order = newOrder
+	tx.write().lists[ownedId{owner, id}] = current
+	return nil
+}
+
+func (tx *memoryStoreTxn) GetList(ctx context.Context, id string, list *structs.List) error {
+	if id == DefaultListId {
+		if err := tx.checkListId(ctx, id); err != nil {
+			return err
+		}
+	}
+	record, ok := tx.state.lists[ownedId{auth.Principal(ctx), id}]
+	if !ok {
+		log.Debug().Msg(fmt.Sprintf("Unknown list ID %s", id))
+		return NotFoundf("unknown list id")
+	}
+	*list = record
+	return nil
+}
+
+func (tx *memoryStoreTxn) ListLists(ctx context.Context, lists *structs.Lists) error {
+	// every user has the default list, even before they have used it
+	if err := tx.checkListId(ctx, DefaultListId); err != nil {
+		return err
+	}
+
+	owner := auth.Principal(ctx)
+	lists.Items = make([]structs.List, 0)
+	for key, record := range tx.state.lists {
+		if key.owner == owner {
+			lists.Items = append(lists.Items, record)
+		}
+	}
+	sort.Slice(lists.Items, func(i, j int) bool {
+		return lists.Items[i].Order < lists.Items[j].Order
+	})
+	lists.Count = len(lists.Items)
+	return nil
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+func addMemoryItems(t *testing.T, store Store, names ...string) []structs.TodoItem {
+	ctx := context.Background()
+	items := make([]structs.TodoItem, 0, len(names))
+	for i, name := range names {
+		item := structs.TodoItem{Item: name, Order: i + 1}
+		err := store.Update(func(tx Txn) error {
+			return tx.Add(ctx, &item)
+		})
+		require.NoError(t, err)
+		items = append(items, item)
+	}
+	return items
+}
+
+func listMemoryItems(t *testing.T, store Store) []string {
+	var list structs.TodoItemList
+	err := store.Update(func(tx Txn) error {
+		return tx.List(context.Background(), DefaultListId, structs.ItemQuery{}, &list)
+	})
+	require.NoError(t, err)
+
+	names := make([]string, 0, list.Count)
+	for _, item := range list.Items {
+		names = append(names, item.Item)
+	}
+	return names
+}
+
+func TestMemoryStoreAdd(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	items := addMemoryItems(t, store, "panos", "geo")
+	assert.NotEmpty(t, items[0].Id)
+
+	err := store.Update(func(tx Txn) error {
+		return tx.Add(ctx, &structs.TodoItem{Item: "stavroula", Order: 4})
+	})
+	assert.EqualError(t, err, "order should be between 1 and 3 and you provided 4")
+
+	err = store.Update(func(tx Txn) error {
+		return tx.Add(ctx, &structs.TodoItem{Id: items[0].Id, Item: "panos", Order: 3})
+	})
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"panos", "geo"}, listMemoryItems(t, store))
+}
+
+func TestMemoryStoreInsertAtPosition(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	addMemoryItems(t, store, "a", "c")
+
+	err := store.Update(func(tx Txn) error {
+		return tx.Add(ctx, &structs.TodoItem{Item: "b", Order: 2})
+	})
+	assert.NoError(t, err)
+
+	item := structs.TodoItem{Item: "d"}
+	err = store.Update(func(tx Txn) error {
+		return tx.Add(ctx, &item)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, item.Order)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, listMemoryItems(t, store))
+}
+
+func TestMemoryStoreReorder(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	items := addMemoryItems(t, store, "a", "b", "c", "d")
+
+	err := store.Update(func(tx Txn) error {
+		return tx.Reorder(ctx, items[3].Id, 1)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d", "a", "b", "c"}, listMemoryItems(t, store))
+
+	err = store.Update(func(tx Txn) error {
+		return tx.Reorder(ctx, items[3].Id, 3)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "d", "c"}, listMemoryItems(t, store))
+
+	err = store.Update(func(tx Txn) error {
+		return tx.Reorder(ctx, items[3].Id, 99)
+	})
+	assert.EqualError(t, err, "order should be between 1 and 4 and you provided 99")
+	assert.Equal(t, []string{"a", "b", "d", "c"}, listMemoryItems(t, store))
+
+	err = store.Update(func(tx Txn) error {
+		return tx.Reorder(ctx, "missing", 1)
+	})
+	assert.EqualError(t, err, "ID missing does not exist")
+}
+
+func TestMemoryStoreUpdateGetDelete(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	items := addMemoryItems(t, store, "a", "b", "c")
+
+	err := store.Update(func(tx Txn) error {
+		return tx.Update(ctx, &structs.TodoItem{Id: items[2].Id, Item: "c2", Order: 1})
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c2", "a", "b"}, listMemoryItems(t, store))
+
+	var item structs.TodoItem
+	err = store.Update(func(tx Txn) error {
+		return tx.Get(ctx, items[2].Id, &item)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "c2", item.Item)
+	assert.Equal(t, 1, item.Order)
+
+	err = store.Update(func(tx Txn) error {
+		return tx.Update(ctx, &structs.TodoItem{Id: items[2].Id, Item: "c3", Order: 50})
+	})
+	assert.EqualError(t, err, "order should be between 1 and 3 and you provided 50")
+	assert.Equal(t, []string{"c2", "a", "b"}, listMemoryItems(t, store))
+
+	var shifted structs.TodoItemList
+	err = store.Update(func(tx Txn) error {
+		return tx.Delete(ctx, items[0].Id, &shifted)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c2", "b"}, listMemoryItems(t, store))
+	assert.Equal(t, 1, shifted.Count)
+	// shifting an item along is no write to it
+	assert.Equal(t, structs.TodoItem{Id: items[1].Id, ListId: DefaultListId, Item: "b", Order: 2,
+		Version: 1, CreatedAt: items[1].CreatedAt, UpdatedAt: items[1].UpdatedAt}, shifted.Items[0])
+
+	// the gap is closed, so the next item goes right after the last one
+	err = store.Update(func(tx Txn) error {
+		return tx.Add(ctx, &structs.TodoItem{Item: "d", Order: 3})
+	})
+	assert.NoError(t, err)
+
+	err = store.Update(func(tx Txn) error {
+		return tx.Delete(ctx, items[0].Id, &shifted)
+	})
+	assert.EqualError(t, err, "unknown id")
+}
+
+func TestMemoryStoreLists(t *testing.T) {
+	testLists(t, NewMemoryStore())
+}
+
+func TestMemoryStoreRollback(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	items := addMemoryItems(t, store, "a", "b")
+
+	err := store.Update(func(tx Txn) error {
+		if err := tx.Reorder(ctx, items[1].Id, 1); err != nil {
+			return err
+		}
+		if err := tx.Delete(ctx, items[0].Id, &structs.TodoItemList{}); err != nil {
+			return err
+		}
+		return assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, []string{"a", "b"}, listMemoryItems(t, store))
+
+	assert.Panics(t, func() {
+		_ = store.Update(func(tx Txn) error {
+			_ = tx.Delete(ctx, items[0].Id, &structs.TodoItemList{})
+			panic("boom")
+		})
+	})
+	assert.Equal(t, []string{"a", "b"}, listMemoryItems(t, store))
+}
+
+func TestMemoryStoreConcurrentUpdates(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.Update(func(tx Txn) error {
+				var list structs.TodoItemList
+				if err := tx.List(ctx, DefaultListId, structs.ItemQuery{}, &list); err != nil {
+					return err
+				}
+				return tx.Add(ctx, &structs.TodoItem{Item: "item", Order: list.Count + 1})
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	var list structs.TodoItemList
+	err := store.Update(func(tx Txn) error {
+		return tx.List(ctx, DefaultListId, structs.ItemQuery{}, &list)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 50, list.Count)
+	for i, item := range list.Items {
+		assert.Equal(t, i+1, item.Order)
+	}
+}
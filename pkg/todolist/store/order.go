@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// OrderConflictError is returned for a new order of items that is not made of
+// the very items that are there, e.g. from a stale tab.
+type OrderConflictError struct {
+	// Missing are the ids of the items that were left out of the order.
+	Missing []string
+	// Unexpected are the ids in the order that are not among the items.
+	Unexpected []string
+}
+
+func (e *OrderConflictError) Error() string {
+	return fmt.Sprintf("the items have changed in the meantime, %d missing and %d unexpected", len(e.Missing), len(e.Unexpected))
+}
+
+// arrangingTxn is a Txn that puts siblings in a new order at once.
+type arrangingTxn interface {
+	Txn
+	// arrangeSiblings gives the ordered sub-tasks of parentId in a list, or
+	// its top-level items, the orders of wanted, another arrangement of them
+	// than current, in a single pass. The items only shift along, so their
+	// versions stay the same.
+	arrangeSiblings(ctx context.Context, listId string, parentId string, current []string, wanted []string) error
+}
+
+// arrange puts the ordered sub-tasks of parentId in a list, or its ordered
+// top-level items when parentId is empty, in the order of ids.
+func arrange(ctx context.Context, tx arrangingTxn, listId string, parentId string, ids []string) error {
+	if parentId != "" {
+		var parent structs.TodoItem
+		if err := tx.Get(ctx, parentId, &parent); err != nil {
+			return err
+		}
+		if parent.ListId != listId {
+			return NotFoundf("unknown id")
+		}
+	}
+	group, err := orderedSiblings(ctx, tx, listId, parentId)
+	if err != nil {
+		return err
+	}
+	current := make([]string, len(group))
+	for i, item := range group {
+		current[i] = item.Id
+	}
+
+	if conflict := compareIds(current, ids); conflict != nil {
+		return conflict
+	}
+	return tx.arrangeSiblings(ctx, listId, parentId, current, ids)
+}
+
+// orderedSiblings returns the sub-tasks of parentId in a list, or its
+// top-level items when parentId is empty, that have an order, in their order.
+func orderedSiblings(ctx context.Context, tx Txn, listId string, parentId string) ([]structs.TodoItem, error) {
+	var items structs.TodoItemList
+	if err := tx.Siblings(ctx, listId, parentId, &items); err != nil {
+		return nil, err
+	}
+	return items.Items, nil
+}
+
+// moveRelative resolves a relative move of an item into the orders it and,
+// for a swap, the other item go to. The directions stop at the first and last
+// orders the completion policy allows for the item rather than fail.
+func moveRelative(ctx context.Context, tx Txn, policy CompletionPolicy, id string, move structs.RelativeMove) error {
+	set := 0
+	for _, field := range []string{string(move.Direction), move.Before, move.After, move.SwapWith} {
+		if field != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("a move takes one of a direction, before, after or swapWith")
+	}
+
+	var item structs.TodoItem
+	if err := tx.Get(ctx, id, &item); err != nil {
+		return err
+	}
+	if item.Order == 0 {
+		return fmt.Errorf("item %s is not ordered", id)
+	}
+	group, err := orderedSiblings(ctx, tx, item.ListId, item.ParentId)
+	if err != nil {
+		return err
+	}
+	// the other item, for the moves that name one
+	var other structs.TodoItem
+	if move.Direction == "" {
+		otherId := move.Before + move.After + move.SwapWith
+		if otherId == id {
+			return fmt.Errorf("an item cannot be moved relative to itself")
+		}
+		if err := tx.Get(ctx, otherId, &other); err != nil {
+			return err
+		}
+		if other.ListId != item.ListId || other.ParentId != item.ParentId || other.Order == 0 {
+			return fmt.Errorf("item %s is not ordered along with %s", otherId, id)
+		}
+	}
+
+	var open int
+	for _, sibling := range group {
+		if sibling.Id != id && !sibling.Done {
+			open++
+		}
+	}
+	first, last, err := completionRange(policy, item.Done, open, len(group)-1)
+	if err != nil {
+		return err
+	}
+	newOrder := item.Order
+	switch {
+	case move.Direction == structs.DirectionTop:
+		newOrder = first
+	case move.Direction == structs.DirectionBottom:
+		newOrder = last
+	case move.Direction == structs.DirectionUp:
+		newOrder = max(item.Order-1, first)
+	case move.Direction == structs.DirectionDown:
+		newOrder = min(item.Order+1, last)
+	case move.Direction != "":
+		return fmt.Errorf("unknown direction %q", move.Direction)
+	case move.Before != "" && other.Order > item.Order:
+		newOrder = other.Order - 1
+	case move.Before != "":
+		newOrder = other.Order
+	case move.After != "" && other.Order > item.Order:
+		newOrder = other.Order
+	case move.After != "":
+		newOrder = other.Order + 1
+	default:
+		// each takes the place of the other, the items in between stay
+		if err := tx.Reorder(ctx, id, other.Order); err != nil {
+			return err
+		}
+		return tx.Reorder(ctx, other.Id, item.Order)
+	}
+	if newOrder == item.Order {
+		return nil
+	}
+	return tx.Reorder(ctx, id, newOrder)
+}
+
+// compareIds returns an OrderConflictError unless wanted holds the ids of
+// current, each of them once.
+func compareIds(current []string, wanted []string) *OrderConflictError {
+	known := make(map[string]bool, len(current))
+	for _, id := range current {
+		known[id] = true
+	}
+	conflict := &OrderConflictError{Missing: []string{}, Unexpected: []string{}}
+	seen := make(map[string]bool, len(wanted))
+	for _, id := range wanted {
+		if !known[id] || seen[id] {
+			conflict.Unexpected = append(conflict.Unexpected, id)
+		}
+		seen[id] = true
+	}
+	for _, id := range current {
+		if !seen[id] {
+			conflict.Missing = append(conflict.Missing, id)
+		}
+	}
+	if len(conflict.Missing) == 0 && len(conflict.Unexpected) == 0 {
+		return nil
+	}
+	return conflict
+}
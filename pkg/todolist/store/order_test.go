@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+func TestArrange(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			testArrange(t, NewSqlStore(db, WithRankStrategy(strategy)))
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testArrange(t, NewMemoryStore())
+	})
+}
+
+// testArrange runs the same scenario of putting items in a new order against
+// any Store.
+func testArrange(t *testing.T, store Store) {
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	add := func(item structs.TodoItem) structs.TodoItem {
+		update(func(tx Txn) error { return tx.Add(ctx, &item) })
+		return item
+	}
+	get := func(id string) structs.TodoItem {
+		var item structs.TodoItem
+		update(func(tx Txn) error { return tx.Get(ctx, id, &item) })
+		return item
+	}
+	arrange := func(parentId string, ids ...string) error {
+		return store.Update(func(tx Txn) error { return tx.Arrange(ctx, DefaultListId, parentId, ids) })
+	}
+	ordered := func(parentId string) []string {
+		var items structs.TodoItemList
+		update(func(tx Txn) error { return tx.List(ctx, DefaultListId, structs.ItemQuery{}, &items) })
+		siblings := make([]structs.TodoItem, 0)
+		for _, item := range items.Items {
+			if item.ParentId == parentId {
+				siblings = append(siblings, item)
+			}
+		}
+		sort.Slice(siblings, func(i, j int) bool { return siblings[i].Order < siblings[j].Order })
+		return itemNames(siblings)
+	}
+
+	a := add(structs.TodoItem{Item: "a"})
+	b := add(structs.TodoItem{Item: "b"})
+	c := add(structs.TodoItem{Item: "c"})
+	d := add(structs.TodoItem{Item: "d"})
+	s1 := add(structs.TodoItem{ParentId: a.Id, Item: "s1"})
+	s2 := add(structs.TodoItem{ParentId: a.Id, Item: "s2"})
+
+	require.NoError(t, arrange("", d.Id, b.Id, a.Id, c.Id))
+	assert.Equal(t, []string{"d", "b", "a", "c"}, ordered(""))
+	require.NoError(t, arrange(a.Id, s2.Id, s1.Id))
+	assert.Equal(t, []string{"s2", "s1"}, ordered(a.Id))
+	require.NoError(t, arrange("", d.Id, b.Id, a.Id, c.Id))
+	for _, item := range []structs.TodoItem{a, b, c, d, s1, s2} {
+		assert.Equal(t, 1, get(item.Id).Version, "the items only shift along")
+	}
+
+	// nothing moves unless the ids are those of the items
+	err := arrange("", d.Id, b.Id, a.Id, s1.Id)
+	var conflict *OrderConflictError
+	require.True(t, errors.As(err, &conflict))
+	assert.Equal(t, []string{c.Id}, conflict.Missing)
+	assert.Equal(t, []string{s1.Id}, conflict.Unexpected)
+	require.True(t, errors.As(arrange("", d.Id, b.Id, a.Id, c.Id, c.Id), &conflict))
+	assert.Empty(t, conflict.Missing)
+	assert.Equal(t, []string{c.Id}, conflict.Unexpected)
+	require.True(t, errors.As(arrange("", d.Id, b.Id), &conflict))
+	assert.Equal(t, []string{a.Id, c.Id}, conflict.Missing)
+	assert.Equal(t, []string{"d", "b", "a", "c"}, ordered(""))
+
+	assert.True(t, IsNotFound(arrange("unknown")))
+	update(func(tx Txn) error { return tx.Delete(ctx, b.Id, &structs.TodoItemList{}) })
+	require.NoError(t, arrange("", c.Id, a.Id, d.Id))
+	assert.Equal(t, []string{"c", "a", "d"}, ordered(""))
+
+	// many items turned around at once
+	var ids, names []string
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("t%03d", i)
+		ids = append([]string{add(structs.TodoItem{ParentId: d.Id, Item: name}).Id}, ids...)
+		names = append([]string{name}, names...)
+	}
+	require.NoError(t, arrange(d.Id, ids...))
+	assert.Equal(t, names, ordered(d.Id))
+}
+
+func TestMoveRelative(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			testMoveRelative(t, func(policy CompletionPolicy) Store {
+				db := setupSQLiteDB(t)
+				require.NoError(t, PrepareRanks(db, strategy))
+				return NewSqlStore(db, WithRankStrategy(strategy), WithCompletionPolicy(policy))
+			})
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testMoveRelative(t, func(policy CompletionPolicy) Store {
+			return NewMemoryStore(WithCompletionPolicy(policy))
+		})
+	})
+}
+
+// testMoveRelative runs the same scenario of relative moves against any
+// Store.
+func testMoveRelative(t *testing.T, newStore func(policy CompletionPolicy) Store) {
+	ctx := context.Background()
+	store := newStore(KeepPlace)
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	add := func(item structs.TodoItem) structs.TodoItem {
+		update(func(tx Txn) error { return tx.Add(ctx, &item) })
+		return item
+	}
+	move := func(id string, move structs.RelativeMove) error {
+		return store.Update(func(tx Txn) error { return tx.MoveRelative(ctx, id, move) })
+	}
+	ordered := func(parentId string) []string {
+		var group []structs.TodoItem
+		update(func(tx Txn) error {
+			var err error
+			group, err = orderedSiblings(ctx, tx, DefaultListId, parentId)
+			return err
+		})
+		return itemNames(group)
+	}
+
+	a := add(structs.TodoItem{Item: "a"})
+	b := add(structs.TodoItem{Item: "b"})
+	c := add(structs.TodoItem{Item: "c"})
+	d := add(structs.TodoItem{Item: "d"})
+	s1 := add(structs.TodoItem{ParentId: a.Id, Item: "s1"})
+
+	for _, tt := range []struct {
+		id    string
+		move  structs.RelativeMove
+		names []string
+	}{
+		{c.Id, structs.RelativeMove{Direction: structs.DirectionTop}, []string{"c", "a", "b", "d"}},
+		{c.Id, structs.RelativeMove{Direction: structs.DirectionTop}, []string{"c", "a", "b", "d"}},
+		{c.Id, structs.RelativeMove{Direction: structs.DirectionUp}, []string{"c", "a", "b", "d"}},
+		{c.Id, structs.RelativeMove{Direction: structs.DirectionDown}, []string{"a", "c", "b", "d"}},
+		{a.Id, structs.RelativeMove{Direction: structs.DirectionBottom}, []string{"c", "b", "d", "a"}},
+		{a.Id, structs.RelativeMove{Direction: structs.DirectionDown}, []string{"c", "b", "d", "a"}},
+		{b.Id, structs.RelativeMove{Direction: structs.DirectionUp}, []string{"b", "c", "d", "a"}},
+		{b.Id, structs.RelativeMove{Before: a.Id}, []string{"c", "d", "b", "a"}},
+		{a.Id, structs.RelativeMove{Before: c.Id}, []string{"a", "c", "d", "b"}},
+		{a.Id, structs.RelativeMove{After: d.Id}, []string{"c", "d", "a", "b"}},
+		{b.Id, structs.RelativeMove{After: c.Id}, []string{"c", "b", "d", "a"}},
+		{c.Id, structs.RelativeMove{SwapWith: a.Id}, []string{"a", "b", "d", "c"}},
+		{c.Id, structs.RelativeMove{SwapWith: b.Id}, []string{"a", "c", "d", "b"}},
+	} {
+		require.NoError(t, move(tt.id, tt.move))
+		assert.Equal(t, tt.names, ordered(""))
+	}
+
+	// only among the siblings of the item, and one way at a time
+	assert.Error(t, move(s1.Id, structs.RelativeMove{Before: b.Id}))
+	assert.Error(t, move(b.Id, structs.RelativeMove{After: b.Id}))
+	assert.Error(t, move(b.Id, structs.RelativeMove{}))
+	assert.Error(t, move(b.Id, structs.RelativeMove{Direction: structs.DirectionUp, Before: a.Id}))
+	assert.Error(t, move(b.Id, structs.RelativeMove{Direction: "sideways"}))
+	assert.True(t, IsNotFound(move(b.Id, structs.RelativeMove{SwapWith: "unknown"})))
+	assert.Equal(t, []string{"a", "c", "d", "b"}, ordered(""))
+
+	t.Run("sink", func(t *testing.T) {
+		store = newStore(SinkToBottom)
+		a := add(structs.TodoItem{Item: "a"})
+		b := add(structs.TodoItem{Item: "b"})
+		c := add(structs.TodoItem{Item: "c"})
+		update(func(tx Txn) error { return tx.Complete(ctx, c.Id, true, &structs.TodoItem{}) })
+
+		// the open items stay above the completed ones
+		require.NoError(t, move(a.Id, structs.RelativeMove{Direction: structs.DirectionBottom}))
+		assert.Equal(t, []string{"b", "a", "c"}, ordered(""))
+		require.NoError(t, move(a.Id, structs.RelativeMove{Direction: structs.DirectionDown}))
+		assert.Equal(t, []string{"b", "a", "c"}, ordered(""))
+		require.NoError(t, move(c.Id, structs.RelativeMove{Direction: structs.DirectionTop}))
+		assert.Equal(t, []string{"b", "a", "c"}, ordered(""))
+		assert.Error(t, move(c.Id, structs.RelativeMove{Before: b.Id}))
+		assert.Equal(t, []string{"b", "a", "c"}, ordered(""))
+	})
+}
+
+func TestArrangeLongList(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			// more items than a statement can bind ids, only some of which
+			// are siblings
+			ids := seedItems(t, db, strategy, "", 1200)
+			subtasks := seedItems(t, db, strategy, ids[0], 300)
+			store := NewSqlStore(db, WithRankStrategy(strategy))
+			ctx := context.Background()
+			update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+			siblings := func(parentId string) []string {
+				var items structs.TodoItemList
+				update(func(tx Txn) error { return tx.Siblings(ctx, DefaultListId, parentId, &items) })
+				siblings := make([]string, items.Count)
+				for i, item := range items.Items {
+					assert.Equal(t, i+1, item.Order)
+					siblings[i] = item.Id
+				}
+				return siblings
+			}
+
+			reversed := make([]string, len(ids))
+			for i, id := range ids {
+				reversed[len(ids)-1-i] = id
+			}
+			update(func(tx Txn) error { return tx.Arrange(ctx, DefaultListId, "", reversed) })
+			assert.Equal(t, reversed, siblings(""))
+			assert.Equal(t, subtasks, siblings(ids[0]))
+
+			update(func(tx Txn) error {
+				return tx.MoveRelative(ctx, ids[0], structs.RelativeMove{Direction: structs.DirectionTop})
+			})
+			assert.Equal(t, append([]string{ids[0]}, reversed[:len(ids)-1]...), siblings(""))
+			update(func(tx Txn) error {
+				return tx.MoveRelative(ctx, subtasks[0], structs.RelativeMove{After: subtasks[299]})
+			})
+			assert.Equal(t, append(subtasks[1:], subtasks[0]), siblings(ids[0]))
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// precedes tells whether item a goes before item b in the pages of a list.
+// They are sorted by parent, so that the sub-tasks of an item stay together,
+// then the items with an order by it, then those without one, and by id.
+func precedes(a, b structs.TodoItem) bool {
+	if a.ParentId != b.ParentId {
+		return a.ParentId < b.ParentId
+	}
+	if (a.Order == 0) != (b.Order == 0) {
+		return b.Order == 0
+	}
+	if a.Order != b.Order {
+		return a.Order < b.Order
+	}
+	return a.Id < b.Id
+}
+
+// pastCursor tells whether an item is on the side of cursor its page is.
+func pastCursor(item structs.TodoItem, cursor *structs.Cursor) bool {
+	if cursor == nil {
+		return true
+	}
+	at := structs.TodoItem{ParentId: cursor.ParentId, Order: cursor.Order, Id: cursor.Id}
+	if cursor.Backward {
+		return precedes(item, at)
+	}
+	return precedes(at, item)
+}
+
+// pastCursorCondition is the SQL condition of pastCursor, which compares
+// the columns one at a time rather than an expression of them, so that the
+// order index can be used.
+func pastCursorCondition(cursor structs.Cursor) (string, []interface{}) {
+	past := ">"
+	if cursor.Backward {
+		past = "<"
+	}
+	var sameParent string
+	var args []interface{}
+	switch {
+	case cursor.Order == 0 && !cursor.Backward:
+		sameParent = `"order" IS NULL AND ID > ?`
+		args = append(args, cursor.Id)
+	case cursor.Order == 0:
+		sameParent = `("order" IS NOT NULL OR ID < ?)`
+		args = append(args, cursor.Id)
+	case !cursor.Backward:
+		sameParent = `("order" IS NULL OR "order" > ? OR ("order" = ? AND ID > ?))`
+		args = append(args, cursor.Order, cursor.Order, cursor.Id)
+	default:
+		sameParent = `("order" < ? OR ("order" = ? AND ID < ?))`
+		args = append(args, cursor.Order, cursor.Order, cursor.Id)
+	}
+	return "(PARENT_ID " + past + " ? OR (PARENT_ID = ? AND " + sameParent + "))",
+		append([]interface{}{cursor.ParentId, cursor.ParentId}, args...)
+}
+
+// paginate sets the page of a list in result out of rows, the items past the
+// cursor of query, closest to it first, with one more than the limit when
+// the page is not the last one that way. The items of the page are put in
+// their order, and total is the number of items of every page.
+func paginate(rows []structs.TodoItem, query structs.ItemQuery, total int, result *structs.TodoItemList) {
+	more := query.Limit > 0 && len(rows) > query.Limit
+	if more {
+		rows = rows[:query.Limit]
+	}
+	backward := query.Cursor != nil && query.Cursor.Backward
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	result.Items, result.Count = rows, total
+	result.Next, result.Prev = "", ""
+	if len(rows) == 0 {
+		return
+	}
+	// the way the page was reached leads back, the other way only when there
+	// is more
+	first, last := rows[0], rows[len(rows)-1]
+	if (more && !backward) || backward {
+		result.Next = structs.Cursor{ParentId: last.ParentId, Order: last.Order, Id: last.Id}.String()
+	}
+	if (more && backward) || (query.Cursor != nil && !backward) {
+		result.Prev = structs.Cursor{ParentId: first.ParentId, Order: first.Order, Id: first.Id, Backward: true}.String()
+	}
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+func TestPages(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			testPages(t, NewSqlStore(db, WithRankStrategy(strategy), WithCompletionPolicy(LeaveSequence)))
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testPages(t, NewMemoryStore(WithCompletionPolicy(LeaveSequence)))
+	})
+}
+
+// testPages runs the same paging scenario against any Store.
+func testPages(t *testing.T, store Store) {
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	add := func(item structs.TodoItem) structs.TodoItem {
+		update(func(tx Txn) error { return tx.Add(ctx, &item) })
+		return item
+	}
+	list := func(query structs.ItemQuery) structs.TodoItemList {
+		var items structs.TodoItemList
+		update(func(tx Txn) error { return tx.List(ctx, DefaultListId, query, &items) })
+		return items
+	}
+	cursor := func(value string) *structs.Cursor {
+		parsed, err := structs.ParseCursor(value)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	a := add(structs.TodoItem{Item: "a"})
+	for _, name := range []string{"b", "c", "d", "e"} {
+		add(structs.TodoItem{Item: name})
+	}
+	add(structs.TodoItem{ParentId: a.Id, Item: "s1"})
+	done := add(structs.TodoItem{Item: "done"})
+	update(func(tx Txn) error { return tx.Complete(ctx, done.Id, true, &structs.TodoItem{}) })
+	update(func(tx Txn) error { return tx.TagItem(ctx, a.Id, "home") })
+
+	// every item once, by parent, by order and then by id
+	all := list(structs.ItemQuery{})
+	assert.Equal(t, 7, all.Count)
+	assert.Empty(t, all.Next)
+	assert.Empty(t, all.Prev)
+	require.Len(t, all.Items, 7)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "done", "s1"}, itemNames(all.Items),
+		"the items without an order go last, and the sub-tasks after the top-level items")
+
+	var pages [][]string
+	query := structs.ItemQuery{Limit: 3}
+	for {
+		page := list(query)
+		assert.Equal(t, 7, page.Count, "the count is that of every page")
+		pages = append(pages, itemNames(page.Items))
+		if page.Next == "" {
+			assert.NotEmpty(t, page.Prev)
+			query.Cursor = cursor(page.Prev)
+			break
+		}
+		if query.Cursor == nil {
+			assert.Empty(t, page.Prev)
+		}
+		query.Cursor = cursor(page.Next)
+	}
+	require.Len(t, pages, 3)
+	assert.Equal(t, itemNames(all.Items), append(append(pages[0], pages[1]...), pages[2]...))
+
+	// and back again
+	back := list(query)
+	assert.Equal(t, pages[1], itemNames(back.Items))
+	assert.NotEmpty(t, back.Next)
+	back = list(structs.ItemQuery{Limit: 3, Cursor: cursor(back.Prev)})
+	assert.Equal(t, pages[0], itemNames(back.Items))
+	assert.Empty(t, back.Prev)
+	assert.NotEmpty(t, back.Next)
+
+	tagged := list(structs.ItemQuery{Limit: 3, Tag: "home"})
+	assert.Equal(t, 1, tagged.Count)
+	assert.Equal(t, []string{"a"}, itemNames(tagged.Items))
+	assert.Empty(t, tagged.Next)
+	assert.Empty(t, tagged.Prev)
+}
+
+func TestPagesOfSubtasks(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			testPagesOfSubtasks(t, NewSqlStore(db, WithRankStrategy(strategy), WithCompletionPolicy(LeaveSequence)))
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testPagesOfSubtasks(t, NewMemoryStore(WithCompletionPolicy(LeaveSequence)))
+	})
+}
+
+// testPagesOfSubtasks walks the pages of a list whose sub-tasks have the same
+// orders as the top-level items and as each other, some of them completed,
+// with every page size, forward and then backward.
+func testPagesOfSubtasks(t *testing.T, store Store) {
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	add := func(item structs.TodoItem) structs.TodoItem {
+		update(func(tx Txn) error { return tx.Add(ctx, &item) })
+		return item
+	}
+	complete := func(item structs.TodoItem) {
+		update(func(tx Txn) error { return tx.Complete(ctx, item.Id, true, &structs.TodoItem{}) })
+	}
+	list := func(query structs.ItemQuery) structs.TodoItemList {
+		var items structs.TodoItemList
+		update(func(tx Txn) error { return tx.List(ctx, DefaultListId, query, &items) })
+		return items
+	}
+	cursor := func(value string) *structs.Cursor {
+		parsed, err := structs.ParseCursor(value)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	a, b := add(structs.TodoItem{Item: "a"}), add(structs.TodoItem{Item: "b"})
+	complete(add(structs.TodoItem{Item: "c"}))
+	complete(add(structs.TodoItem{Item: "d"}))
+	for _, parent := range []structs.TodoItem{a, b} {
+		add(structs.TodoItem{ParentId: parent.Id, Item: parent.Item + "1"})
+		complete(add(structs.TodoItem{ParentId: parent.Id, Item: parent.Item + "2"}))
+		add(structs.TodoItem{ParentId: parent.Id, Item: parent.Item + "3"})
+	}
+	complete(add(structs.TodoItem{ParentId: a.Id, Item: "a4"}))
+
+	all := list(structs.ItemQuery{})
+	require.Len(t, all.Items, 11)
+	for i := 1; i < len(all.Items); i++ {
+		assert.True(t, precedes(all.Items[i-1], all.Items[i]), "%s before %s", all.Items[i-1].Item, all.Items[i].Item)
+	}
+	// the sub-tasks of an item are next to each other, the completed ones
+	// last by id
+	names := itemNames(all.Items)
+	assert.Equal(t, []string{"a", "b"}, names[:2])
+	assert.ElementsMatch(t, []string{"c", "d"}, names[2:4])
+	ofA, ofB := names[4:8], names[8:]
+	if b.Id < a.Id {
+		ofB, ofA = names[4:7], names[7:]
+	}
+	assert.Equal(t, []string{"a1", "a3"}, ofA[:2])
+	assert.ElementsMatch(t, []string{"a2", "a4"}, ofA[2:])
+	assert.Equal(t, []string{"b1", "b3", "b2"}, ofB)
+
+	for limit := 1; limit <= len(all.Items); limit++ {
+		var forward []string
+		query := structs.ItemQuery{Limit: limit}
+		var last structs.TodoItemList
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, len(all.Items), "limit %d", limit)
+			last = list(query)
+			forward = append(forward, itemNames(last.Items)...)
+			if last.Next == "" {
+				break
+			}
+			query.Cursor = cursor(last.Next)
+		}
+		assert.Equal(t, names, forward, "limit %d", limit)
+
+		// back from the last page to the first
+		backward := itemNames(last.Items)
+		for pages := 0; last.Prev != ""; pages++ {
+			require.Less(t, pages, len(all.Items), "limit %d", limit)
+			last = list(structs.ItemQuery{Limit: limit, Cursor: cursor(last.Prev)})
+			assert.Len(t, last.Items, limit, "limit %d", limit)
+			backward = append(itemNames(last.Items), backward...)
+		}
+		assert.Equal(t, names, backward, "limit %d", limit)
+	}
+}
+
+func TestLongPages(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			ids := seedItems(t, db, strategy, "", 2000)
+			ids = append(ids, seedItems(t, db, strategy, ids[0], 500)...)
+			store := NewSqlStore(db, WithRankStrategy(strategy))
+			ctx := context.Background()
+			update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+			update(func(tx Txn) error { return tx.TagItem(ctx, ids[1500], "home") })
+
+			// the most items a page can have, one more of which is read to
+			// tell whether there is a next page
+			var walked []string
+			query := structs.ItemQuery{Limit: 1000}
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, 3)
+				var page structs.TodoItemList
+				update(func(tx Txn) error { return tx.List(ctx, DefaultListId, query, &page) })
+				assert.Equal(t, 2500, page.Count)
+				for _, item := range page.Items {
+					walked = append(walked, item.Id)
+					if item.Id == ids[1500] {
+						assert.Equal(t, []string{"home"}, item.Tags)
+					}
+				}
+				if page.Next == "" {
+					assert.Len(t, page.Items, 500)
+					break
+				}
+				require.Len(t, page.Items, 1000)
+				cursor, err := structs.ParseCursor(page.Next)
+				require.NoError(t, err)
+				query.Cursor = cursor
+			}
+			assert.Equal(t, ids, walked, "the top-level items and then the sub-tasks")
+		})
+	}
+}
@@ -0,0 +1,690 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// RankStrategy selects how the SQL store persists the position of items.
+type RankStrategy string
+
+const (
+	// DenseRanking stores the 1..N position itself in the "order" column.
+	// Moving an item rewrites the order of every item it passes.
+	DenseRanking RankStrategy = "dense"
+	// LexoRanking stores a lexicographic key in rank_key and derives the
+	// position from the key order, so moving an item writes a single row.
+	LexoRanking RankStrategy = "lexorank"
+)
+
+func ParseRankStrategy(name string) (RankStrategy, error) {
+	switch RankStrategy(name) {
+	case DenseRanking, LexoRanking:
+		return RankStrategy(name), nil
+	default:
+		return "", fmt.Errorf("unknown rank strategy %q, expected %q or %q", name, DenseRanking, LexoRanking)
+	}
+}
+
+// sequence is a set of rows ordered independently of all others: the lists
+// of one owner, or the items under the same parent in one of their lists.
+type sequence struct {
+	table string
+	// columns are read from the ranker's source next to "order"
+	columns string
+	// partition splits the rows of table into separate sequences
+	partition []string
+	// key holds the partition values of this sequence, or only the first of
+	// them for all the sequences that share those
+	key []interface{}
+}
+
+func listsSequence(owner string) sequence {
+	return sequence{table: "LISTS", columns: "ID, NAME",
+		partition: []string{"OWNER"}, key: []interface{}{owner}}
+}
+
+func itemsSequence(owner, listId, parentId string) sequence {
+	return sequence{table: "TODOLIST", columns: "ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT",
+		partition: []string{"OWNER", "LIST_ID", "PARENT_ID"}, key: []interface{}{owner, listId, parentId}}
+}
+
+// itemsSequences stands for the sequences of items that share the first
+// values of their partition, such as those of a list.
+func itemsSequences(key ...interface{}) sequence {
+	seq := itemsSequence("", "", "")
+	seq.key = key
+	return seq
+}
+
+// where builds a WHERE clause out of the conditions and the ones selecting the
+// rows of the sequence, whose arguments go last.
+func (s sequence) where(conditions ...string) string {
+	for _, column := range s.partition[:len(s.key)] {
+		conditions = append(conditions, column+" = ?")
+	}
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// args appends the arguments of the conditions added by where.
+func (s sequence) args(args ...interface{}) []interface{} {
+	return append(args, s.key...)
+}
+
+// ranker implements a RankStrategy on top of a SQL transaction.
+type ranker interface {
+	// source is the table expression to read the rows of seq.table from, with
+	// the arguments it binds ahead of those of the rest of the query. It exposes
+	// OWNER and seq.columns with "order" holding the dense 1..N position of
+	// every row within its sequence, and may leave out the rows of other
+	// sequences than seq.
+	source(seq sequence) (string, []interface{})
+	// insert adds a new row at order, with the columns set to the values.
+	insert(ctx context.Context, tx *sqlStoreTxn, seq sequence, order int, columns string, values ...interface{}) error
+	// update changes the item text and, when needed, its position.
+	update(ctx context.Context, tx *sqlStoreTxn, seq sequence, record *structs.TodoItem) (int64, error)
+	// move places an existing row at newOrder, shifting the rows in between.
+	move(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string, newOrder int) error
+	// detach takes a row out of the sequence, leaving a gap at its order.
+	detach(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string) error
+	// attach puts a detached row at order, once a gap has been opened there.
+	attach(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string, order int) error
+	// openGap moves the rows from one order up to another down by one, to
+	// make room for a row at the first of them.
+	openGap(ctx context.Context, tx *sqlStoreTxn, seq sequence, from, to int) error
+	// closeGap moves the rows from one order up to another up by one, after
+	// the row before them has left the sequence.
+	closeGap(ctx context.Context, tx *sqlStoreTxn, seq sequence, from, to int) error
+	// arrange gives the rows of seq with an order, ordered in current, the
+	// orders of wanted, another arrangement of them, in a single pass.
+	arrange(ctx context.Context, tx *sqlStoreTxn, seq sequence, current []string, wanted []string) error
+	// rebalance rewrites the persisted positions of every row, converting
+	// any that were written by the other strategy.
+	rebalance(ctx context.Context, tx *sqlStoreTxn, seq sequence) error
+	// needsRebalance reports whether positions written by the other strategy are present.
+	needsRebalance(ctx context.Context, tx *sqlStoreTxn, seq sequence) (bool, error)
+}
+
+func newRanker(strategy RankStrategy) ranker {
+	if strategy == LexoRanking {
+		return lexoRanker{}
+	}
+	return denseRanker{}
+}
+
+// PrepareRanks converts positions persisted with another strategy, so a
+// database can be switched between strategies. It is a no-op when nothing
+// needs converting.
+func PrepareRanks(db *sqlx.DB, strategy RankStrategy) error {
+	s := &sqlStore{
+		db:      db,
+		dialect: dialectFor(db.DriverName()),
+		ranker:  newRanker(strategy),
+		clock:   time.Now,
+	}
+	return s.Update(func(tx Txn) error {
+		ctx := context.Background()
+		sqlTx := tx.(*sqlStoreTxn)
+
+		var owners []string
+		err := sqlTx.txn.SelectContext(ctx, &owners, `SELECT DISTINCT OWNER FROM LISTS ORDER BY OWNER`)
+		if err != nil {
+			return err
+		}
+		var seqs []sequence
+		for _, owner := range owners {
+			seqs = append(seqs, listsSequence(owner))
+		}
+
+		// the items of every group of siblings
+		rows, err := sqlTx.txn.QueryContext(ctx, `SELECT DISTINCT OWNER, LIST_ID, PARENT_ID FROM TODOLIST`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var owner, listId, parentId string
+			if err := rows.Scan(&owner, &listId, &parentId); err != nil {
+				return err
+			}
+			seqs = append(seqs, itemsSequence(owner, listId, parentId))
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, seq := range seqs {
+			needed, err := s.ranker.needsRebalance(ctx, sqlTx, seq)
+			if err != nil {
+				return err
+			}
+			if !needed {
+				continue
+			}
+			log.Info().Str("strategy", string(strategy)).Str("table", seq.table).Interface("key", seq.key).
+				Msg("Converting positions to the rank strategy")
+			if err := s.ranker.rebalance(ctx, sqlTx, seq); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sequenceOrder sorts every positioned row whichever strategy wrote it.
+const sequenceOrder = `CASE WHEN "order" IS NULL THEN 1 ELSE 0 END, "order", CASE WHEN rank_key IS NULL THEN 1 ELSE 0 END, rank_key`
+
+func selectSequence(ctx context.Context, tx *sqlStoreTxn, seq sequence) ([]string, error) {
+	var ids []string
+	err := tx.txn.SelectContext(ctx, &ids,
+		tx.txn.Rebind(`SELECT ID FROM `+seq.table+
+			seq.where(`("order" IS NOT NULL OR rank_key IS NOT NULL)`)+` ORDER BY `+sequenceOrder),
+		seq.args()...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get the current order list of %s: %v", seq.table, err))
+	}
+	return ids, err
+}
+
+// placeholders returns the bind parameters for n values.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+type denseRanker struct{}
+
+func (denseRanker) source(seq sequence) (string, []interface{}) {
+	return seq.table, nil
+}
+
+func (denseRanker) insert(ctx context.Context, tx *sqlStoreTxn, seq sequence, order int, columns string, values ...interface{}) error {
+	_, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`INSERT INTO `+seq.table+`(`+columns+`, "order") VALUES(`+placeholders(len(values)+1)+`)`),
+		append(values, order)...,
+	)
+	return err
+}
+
+func (denseRanker) update(ctx context.Context, tx *sqlStoreTxn, seq sequence, record *structs.TodoItem) (int64, error) {
+	result, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`UPDATE TODOLIST SET
+            ITEM = ?,
+            NOTES = ?,
+            DUE_AT = ?,
+            PRIORITY = ?,
+            RECURRENCE = ?,
+            TIME_ZONE = ?,
+            "order" = ?`+seq.where(`ID = ?`)),
+		seq.args(
+			record.Item,
+			record.Notes,
+			record.DueAt,
+			record.Priority,
+			record.Recurrence,
+			record.TimeZone,
+			record.Order,
+			record.Id,
+		)...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r denseRanker) move(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string, newOrder int) error {
+	var currentOrder int
+	err := tx.txn.GetContext(ctx, &currentOrder, tx.txn.Rebind(`SELECT "order" FROM `+seq.table+seq.where(`ID = ?`)), seq.args(id)...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get the current order of the item: %v", err))
+		return err
+	}
+	if newOrder == currentOrder {
+		return nil
+	}
+
+	// Take the item out of the sequence while the others shift. Then:
+	// newOrder > currentOrder: the items after the current order up to the new order move up by one.
+	// newOrder < currentOrder: the items from the new order up to before the current order move down by one.
+	err = r.detach(ctx, tx, seq, id)
+	if err != nil {
+		return err
+	}
+
+	if newOrder > currentOrder {
+		err = shiftOrders(ctx, tx, seq, currentOrder+1, newOrder, -1)
+	} else {
+		err = shiftOrders(ctx, tx, seq, newOrder, currentOrder-1, 1)
+	}
+	if err != nil {
+		return err
+	}
+
+	return r.attach(ctx, tx, seq, id, newOrder)
+}
+
+func (denseRanker) detach(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string) error {
+	_, err := tx.txn.ExecContext(ctx, tx.txn.Rebind(`UPDATE `+seq.table+` SET "order" = NULL`+seq.where(`ID = ?`)), seq.args(id)...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to reorder item: %v", err))
+	}
+	return err
+}
+
+func (denseRanker) attach(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string, order int) error {
+	// Update the order value for the specified item
+	_, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`UPDATE `+seq.table+` SET "order" = ?`+seq.where(`ID = ?`)),
+		seq.args(order, id)...,
+	)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to reorder item: %v", err))
+	}
+	return err
+}
+
+func (denseRanker) openGap(ctx context.Context, tx *sqlStoreTxn, seq sequence, from, to int) error {
+	return shiftOrders(ctx, tx, seq, from, to, 1)
+}
+
+func (denseRanker) closeGap(ctx context.Context, tx *sqlStoreTxn, seq sequence, from, to int) error {
+	return shiftOrders(ctx, tx, seq, from, to, -1)
+}
+
+// shiftOrders adds delta to the order of every row between from and to with
+// two set-based statements. The shifted orders are negated first, so the
+// unique index on "order" never sees two rows at the same position, neither
+// halfway through a statement nor between the two.
+func shiftOrders(ctx context.Context, tx *sqlStoreTxn, seq sequence, from, to, delta int) error {
+	_, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`UPDATE `+seq.table+` SET "order" = -("order" + ?)`+seq.where(`"order" BETWEEN ? AND ?`)),
+		seq.args(delta, from, to)...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to update items with new order: %v", err))
+		return err
+	}
+	return settleOrders(ctx, tx, seq)
+}
+
+// settleOrders turns the negated orders of seq back into positive ones, once
+// every row that moves has its new order negated.
+func settleOrders(ctx context.Context, tx *sqlStoreTxn, seq sequence) error {
+	_, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`UPDATE `+seq.table+` SET "order" = -"order"`+seq.where(`"order" < 0`)),
+		seq.args()...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to update items with new order: %v", err))
+	}
+	return err
+}
+
+// arrange writes the negated new order of each row that is out of place, as
+// shiftOrders does, so that the rows take the places of one another.
+func (denseRanker) arrange(ctx context.Context, tx *sqlStoreTxn, seq sequence, current []string, wanted []string) error {
+	for i, id := range wanted {
+		if current[i] == id {
+			continue
+		}
+		_, err := tx.txn.ExecContext(ctx,
+			tx.txn.Rebind(`UPDATE `+seq.table+` SET "order" = ?`+seq.where(`ID = ?`)), seq.args(-(i+1), id)...)
+		if err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to update items with new order: %v", err))
+			return err
+		}
+	}
+	return settleOrders(ctx, tx, seq)
+}
+
+func (denseRanker) needsRebalance(ctx context.Context, tx *sqlStoreTxn, seq sequence) (bool, error) {
+	var count int
+	err := tx.txn.GetContext(ctx, &count,
+		tx.txn.Rebind(`SELECT COUNT(*) FROM `+seq.table+seq.where(`rank_key IS NOT NULL`)), seq.args()...)
+	return count > 0, err
+}
+
+func (denseRanker) rebalance(ctx context.Context, tx *sqlStoreTxn, seq sequence) error {
+	ids, err := selectSequence(ctx, tx, seq)
+	if err == nil {
+		// clear every order first, so the new ones never clash with the old ones
+		_, err = tx.txn.ExecContext(ctx, tx.txn.Rebind(`UPDATE `+seq.table+` SET "order" = NULL`+seq.where()), seq.args()...)
+	}
+	for i := 0; err == nil && i < len(ids); i++ {
+		_, err = tx.txn.ExecContext(ctx,
+			tx.txn.Rebind(`UPDATE `+seq.table+` SET "order" = ?, rank_key = NULL`+seq.where(`ID = ?`)), seq.args(i+1, ids[i])...)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("table", seq.table).Interface("key", seq.key).Msg("Failed to rebalance")
+	}
+	return err
+}
+
+const (
+	// keys longer than this schedule a background rebalance
+	rankKeyRebalanceLength = 16
+	// keys longer than this cannot be stored, the list is rebalanced in place
+	rankKeyMaxLength = 64
+	// keys at the ends of a list step by one at this digit, so that a list
+	// takes over a million appends before its keys have to grow
+	rankStepDigits = 4
+)
+
+type lexoRanker struct{}
+
+// source numbers the rows of seq in the order of their keys with a window,
+// in a single pass over the rank key index. The rows of other sequences are
+// left out before they are numbered, as not every database pushes the
+// conditions of the outer query down into the window. A running count of the
+// keys rather than a row number leaves out the rows without one, wherever the
+// database sorts them.
+func (lexoRanker) source(seq sequence) (string, []interface{}) {
+	partition := strings.Join(seq.partition, ", ")
+	return `(SELECT OWNER, ` + seq.columns + `,
+            CASE WHEN rank_key IS NULL THEN NULL
+            ELSE COUNT(rank_key) OVER (PARTITION BY ` + partition + ` ORDER BY rank_key)
+            END AS "order"
+            FROM ` + seq.table + seq.where() + `) ` + seq.table, seq.args()
+}
+
+// keyFor returns a rank key that puts a row at position pos once the row
+// with excludeId is taken out of the sequence.
+func (lexoRanker) keyFor(ctx context.Context, tx *sqlStoreTxn, seq sequence, excludeId string, pos int) (string, error) {
+	var count int
+	err := tx.txn.GetContext(ctx, &count,
+		tx.txn.Rebind(`SELECT COUNT(*) FROM `+seq.table+seq.where(`rank_key IS NOT NULL`, `ID != ?`)),
+		seq.args(excludeId)...)
+	if err != nil {
+		return "", err
+	}
+	if pos > count+1 {
+		pos = count + 1
+	}
+
+	// fetch the keys currently at pos-1 and pos, either may be missing at the ends
+	offset, limit := pos-2, 2
+	if pos <= 1 {
+		offset, limit = 0, 1
+	}
+	var keys []string
+	err = tx.txn.SelectContext(ctx, &keys,
+		tx.txn.Rebind(`SELECT rank_key FROM `+seq.table+seq.where(`rank_key IS NOT NULL`, `ID != ?`)+
+			` ORDER BY rank_key LIMIT ? OFFSET ?`),
+		append(seq.args(excludeId), limit, offset)...)
+	if err != nil {
+		return "", err
+	}
+
+	var before, after string
+	if pos <= 1 {
+		if len(keys) > 0 {
+			after = keys[0]
+		}
+	} else {
+		if len(keys) > 0 {
+			before = keys[0]
+		}
+		if len(keys) > 1 {
+			after = keys[1]
+		}
+	}
+	// at either end the key is a step away from the last or the first one,
+	// rather than halfway to the end, so that it does not grow
+	if after == "" && before != "" {
+		if key, ok := rankStep(before, 1); ok {
+			return key, nil
+		}
+	}
+	if before == "" && after != "" {
+		if key, ok := rankStep(after, -1); ok {
+			return key, nil
+		}
+	}
+	return rankBetween(before, after)
+}
+
+// place returns the rank key that puts the row at pos, rebalancing first if
+// the keys around pos have become too long to store.
+func (r lexoRanker) place(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string, pos int) (string, error) {
+	key, err := r.keyFor(ctx, tx, seq, id, pos)
+	if err != nil {
+		return "", err
+	}
+	if len(key) > rankKeyMaxLength {
+		if err := r.rebalance(ctx, tx, seq); err != nil {
+			return "", err
+		}
+		if key, err = r.keyFor(ctx, tx, seq, id, pos); err != nil {
+			return "", err
+		}
+	}
+	if len(key) > rankKeyRebalanceLength {
+		tx.rebalanceNeeded = append(tx.rebalanceNeeded, seq)
+	}
+	return key, nil
+}
+
+func (r lexoRanker) insert(ctx context.Context, tx *sqlStoreTxn, seq sequence, order int, columns string, values ...interface{}) error {
+	key, err := r.place(ctx, tx, seq, "", order)
+	if err != nil {
+		return err
+	}
+	_, err = tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`INSERT INTO `+seq.table+`(`+columns+`, rank_key) VALUES(`+placeholders(len(values)+1)+`)`),
+		append(values, key)...,
+	)
+	return err
+}
+
+func (r lexoRanker) update(ctx context.Context, tx *sqlStoreTxn, seq sequence, record *structs.TodoItem) (int64, error) {
+	result, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`UPDATE TODOLIST SET ITEM = ?, NOTES = ?, DUE_AT = ?, PRIORITY = ?, RECURRENCE = ?, TIME_ZONE = ?`+seq.where(`ID = ?`)),
+		seq.args(record.Item, record.Notes, record.DueAt, record.Priority, record.Recurrence, record.TimeZone, record.Id)...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 || record.Order < 1 {
+		return rowsAffected, err
+	}
+	return rowsAffected, r.move(ctx, tx, seq, record.Id, record.Order)
+}
+
+func (r lexoRanker) move(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string, newOrder int) error {
+	// the new key sorts between the new neighbours, nothing else has to move
+	return r.attach(ctx, tx, seq, id, newOrder)
+}
+
+func (lexoRanker) detach(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string) error {
+	_, err := tx.txn.ExecContext(ctx, tx.txn.Rebind(`UPDATE `+seq.table+` SET rank_key = NULL`+seq.where(`ID = ?`)), seq.args(id)...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to reorder item: %v", err))
+	}
+	return err
+}
+
+func (r lexoRanker) attach(ctx context.Context, tx *sqlStoreTxn, seq sequence, id string, order int) error {
+	key, err := r.place(ctx, tx, seq, id, order)
+	if err != nil {
+		return err
+	}
+	_, err = tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`UPDATE `+seq.table+` SET rank_key = ?`+seq.where(`ID = ?`)), seq.args(key, id)...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to reorder item: %v", err))
+	}
+	return err
+}
+
+func (lexoRanker) openGap(ctx context.Context, tx *sqlStoreTxn, seq sequence, from, to int) error {
+	// the new key sorts between its neighbours, nothing else has to move
+	return nil
+}
+
+func (lexoRanker) closeGap(ctx context.Context, tx *sqlStoreTxn, seq sequence, from, to int) error {
+	// positions are derived from the key order, so there is no gap to close
+	return nil
+}
+
+func (lexoRanker) needsRebalance(ctx context.Context, tx *sqlStoreTxn, seq sequence) (bool, error) {
+	var count int
+	err := tx.txn.GetContext(ctx, &count,
+		tx.txn.Rebind(`SELECT COUNT(*) FROM `+seq.table+seq.where(`"order" IS NOT NULL`)), seq.args()...)
+	return count > 0, err
+}
+
+func (r lexoRanker) rebalance(ctx context.Context, tx *sqlStoreTxn, seq sequence) error {
+	ids, err := selectSequence(ctx, tx, seq)
+	if err == nil {
+		err = r.arrange(ctx, tx, seq, ids, ids)
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("table", seq.table).Interface("key", seq.key).Msg("Failed to rebalance")
+	}
+	return err
+}
+
+// arrange spreads new keys over the rows in the order of wanted, as many
+// single-row writes as a rebalance, however far the rows move.
+func (lexoRanker) arrange(ctx context.Context, tx *sqlStoreTxn, seq sequence, current []string, wanted []string) error {
+	// clear every key first, so the new ones never clash with the old ones
+	_, err := tx.txn.ExecContext(ctx, tx.txn.Rebind(`UPDATE `+seq.table+` SET rank_key = NULL`+seq.where()), seq.args()...)
+	if err != nil {
+		return err
+	}
+	keys := spreadRankKeys(len(wanted))
+	for i, id := range wanted {
+		_, err := tx.txn.ExecContext(ctx,
+			tx.txn.Rebind(`UPDATE `+seq.table+` SET rank_key = ?, "order" = NULL`+seq.where(`ID = ?`)), seq.args(keys[i], id)...)
+		if err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to update items with new order: %v", err))
+			return err
+		}
+	}
+	return nil
+}
+
+// Rank keys are base-36 fractions: "i" is 18/36, "i8" is 18/36 + 8/36². Keys
+// never end in the zero digit, so there is always room for another key
+// between any two of them.
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// rankBetween returns a key that sorts strictly between before and after.
+// An empty before means the start of the list, an empty after its end.
+func rankBetween(before, after string) (string, error) {
+	if after != "" && before >= after {
+		return "", fmt.Errorf("invalid rank keys %q and %q: not in order", before, after)
+	}
+	if strings.HasSuffix(before, "0") || strings.HasSuffix(after, "0") {
+		return "", fmt.Errorf("invalid rank keys %q and %q: trailing zero", before, after)
+	}
+	return rankMidpoint(before, after), nil
+}
+
+func rankMidpoint(before, after string) string {
+	if after != "" {
+		// keep the common prefix, treating missing digits of before as zeros
+		n := 0
+		for n < len(after) && rankDigitAt(before, n) == strings.IndexByte(rankDigits, after[n]) {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(before) {
+				rest = before[n:]
+			}
+			return after[:n] + rankMidpoint(rest, after[n:])
+		}
+	}
+
+	digitBefore := rankDigitAt(before, 0)
+	digitAfter := len(rankDigits)
+	if after != "" {
+		digitAfter = strings.IndexByte(rankDigits, after[0])
+	}
+
+	if digitAfter-digitBefore > 1 {
+		return string(rankDigits[(digitBefore+digitAfter+1)/2])
+	}
+	// the first digits are consecutive
+	if len(after) > 1 {
+		return after[:1]
+	}
+	rest := ""
+	if len(before) > 1 {
+		rest = before[1:]
+	}
+	return string(rankDigits[digitBefore]) + rankMidpoint(rest, "")
+}
+
+// rankStep returns the key delta steps of rankStepDigits away from key, and
+// false when that is past either end of the keys. The digits of key past
+// rankStepDigits are dropped first, which only takes the key further from key
+// when stepping up and is made up for by the step itself when stepping down.
+func rankStep(key string, delta int) (string, bool) {
+	base := len(rankDigits)
+	digits := make([]int, rankStepDigits)
+	for i := range digits {
+		digits[i] = rankDigitAt(key, i)
+	}
+	digits[rankStepDigits-1] += delta
+	for i := rankStepDigits - 1; i > 0; i-- {
+		switch {
+		case digits[i] >= base:
+			digits[i] -= base
+			digits[i-1]++
+		case digits[i] < 0:
+			digits[i] += base
+			digits[i-1]--
+		}
+	}
+	if digits[0] < 0 || digits[0] >= base {
+		return "", false
+	}
+	stepped := make([]byte, rankStepDigits)
+	for i, digit := range digits {
+		stepped[i] = rankDigits[digit]
+	}
+	// a key of zeros is the start of the list itself
+	trimmed := strings.TrimRight(string(stepped), "0")
+	return trimmed, trimmed != ""
+}
+
+func rankDigitAt(key string, i int) int {
+	if i >= len(key) {
+		return 0
+	}
+	return strings.IndexByte(rankDigits, key[i])
+}
+
+// spreadRankKeys returns n increasing keys of equal length, evenly spaced so
+// that plenty of room is left between neighbours.
+func spreadRankKeys(n int) []string {
+	base := int64(len(rankDigits))
+	width, space := 1, base
+	for space < int64(n+1)*base {
+		width++
+		space *= base
+	}
+	step := space / int64(n+1)
+
+	keys := make([]string, n)
+	for i := range keys {
+		value := step * int64(i+1)
+		digits := make([]byte, width)
+		for d := width - 1; d >= 0; d-- {
+			digits[d] = rankDigits[value%base]
+			value /= base
+		}
+		keys[i] = strings.TrimRight(string(digits), "0")
+	}
+	return keys
+}
@@ -0,0 +1,680 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.altair.com/todolist/pkg/auth"
+	tododb "go.altair.com/todolist/pkg/db"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+func TestRankBetween(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{"Empty list", "", "", "i"},
+		{"Before the first key", "", "i", "9"},
+		{"After the last key", "i", "", "r"},
+		{"Consecutive digits", "a", "b", "ai"},
+		{"Common prefix", "a5", "a6", "a5i"},
+		{"Before a key starting with 1", "", "1", "0i"},
+		{"After the last digit", "z", "", "zi"},
+		{"After is longer", "a", "bz", "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := rankBetween(tt.before, tt.after)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, key)
+		})
+	}
+
+	t.Run("Keys out of order", func(t *testing.T) {
+		_, err := rankBetween("b", "a")
+		assert.Error(t, err)
+	})
+
+	t.Run("Trailing zero", func(t *testing.T) {
+		_, err := rankBetween("a0", "")
+		assert.Error(t, err)
+	})
+}
+
+func TestRankBetweenRepeatedInserts(t *testing.T) {
+	// inserting at the same spot over and over must keep producing ordered keys
+	before, after := "a", "b"
+	for i := 0; i < 200; i++ {
+		key, err := rankBetween(before, after)
+		require.NoError(t, err)
+		require.Less(t, before, key)
+		require.Less(t, key, after)
+		after = key
+	}
+
+	key := ""
+	for i := 0; i < 200; i++ {
+		next, err := rankBetween(key, "")
+		require.NoError(t, err)
+		require.Less(t, key, next)
+		key = next
+	}
+}
+
+func TestRankStep(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		delta int
+		want  string
+		ok    bool
+	}{
+		{"After a short key", "i", 1, "i001", true},
+		{"Before a short key", "i", -1, "hzzz", true},
+		{"Carrying", "i0zz", 1, "i1", true},
+		{"After a long key", "i8abcd", 1, "i8ac", true},
+		{"Before a long key", "i8abcd", -1, "i8aa", true},
+		{"Past the end", "zzzz", 1, "", false},
+		{"Past the start", "0001", -1, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ok := rankStep(tt.key, tt.delta)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, key)
+			if ok && tt.delta > 0 {
+				assert.Less(t, tt.key, key)
+			} else if ok {
+				assert.Less(t, key, tt.key)
+			}
+		})
+	}
+}
+
+func TestSpreadRankKeys(t *testing.T) {
+	for _, n := range []int{0, 1, 35, 36, 1000} {
+		keys := spreadRankKeys(n)
+		assert.Len(t, keys, n)
+		assert.True(t, sort.StringsAreSorted(keys))
+		for i, key := range keys {
+			assert.NotEmpty(t, key)
+			assert.NotEqual(t, byte('0'), key[len(key)-1])
+			if i > 0 {
+				// there is room for a key between any two neighbours
+				mid, err := rankBetween(keys[i-1], key)
+				assert.NoError(t, err)
+				assert.LessOrEqual(t, len(mid), len(key)+1)
+			}
+		}
+	}
+}
+
+func setupSQLiteDB(t *testing.T) *sqlx.DB {
+	db, err := tododb.CreateDb(tododb.Options{DSN: tododb.MemoryDSN})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func listStoreItems(t *testing.T, store Store) []structs.TodoItem {
+	var list structs.TodoItemList
+	err := store.Update(func(tx Txn) error {
+		return tx.List(context.Background(), DefaultListId, structs.ItemQuery{}, &list)
+	})
+	require.NoError(t, err)
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Order < list.Items[j].Order })
+	return list.Items
+}
+
+// seedItems adds n sub-tasks of parentId, or top-level items when it is
+// empty, to the default list straight through the database, which is the
+// quickest way to make a long list. It returns their ids in their order.
+func seedItems(t *testing.T, db *sqlx.DB, strategy RankStrategy, parentId string, n int) []string {
+	ctx := context.Background()
+	store := NewSqlStore(db, WithRankStrategy(strategy))
+	require.NoError(t, store.Update(func(tx Txn) error { return tx.(*sqlStoreTxn).checkListId(ctx, DefaultListId) }))
+
+	column, positions := `"order"`, make([]interface{}, n)
+	for i := range positions {
+		positions[i] = i + 1
+	}
+	if strategy == LexoRanking {
+		column = "rank_key"
+		for i, key := range spreadRankKeys(n) {
+			positions[i] = key
+		}
+	}
+	ids := make([]string, n)
+	tx := db.MustBegin()
+	insert, err := tx.Preparex(tx.Rebind(`INSERT INTO TODOLIST (OWNER, ID, LIST_ID, PARENT_ID, ITEM, NOTES, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, ` +
+		column + `) VALUES (?, ?, ?, ?, ?, '', '', '', '', 1, ?, ?, ?)`))
+	require.NoError(t, err)
+	now := writeTime()
+	for i := range ids {
+		ids[i] = uuid.New().String()
+		_, err := insert.Exec(auth.Principal(ctx), ids[i], DefaultListId, parentId, fmt.Sprintf("item %d", i+1), now, now, positions[i])
+		require.NoError(t, err)
+	}
+	require.NoError(t, insert.Close())
+	require.NoError(t, tx.Commit())
+	return ids
+}
+
+func TestLongList(t *testing.T) {
+	const n = 10000
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			ids := seedItems(t, db, strategy, "", n)
+			store := NewSqlStore(db, WithRankStrategy(strategy))
+			ctx := context.Background()
+
+			// every write and read goes through the positions of the whole
+			// list, which takes seconds when it costs more than a pass
+			timed := func(name string, action func(tx Txn) error) {
+				start := time.Now()
+				require.NoError(t, store.Update(action), name)
+				assert.Less(t, time.Since(start), time.Second, name)
+			}
+			// and not through those of the other lists, which would take
+			// as long as a pass over the long one
+			short := structs.List{Name: "short"}
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.AddList(ctx, &short) }))
+			start := time.Now()
+			var shortItem structs.TodoItem
+			for i := 1; i <= 5; i++ {
+				shortItem = structs.TodoItem{ListId: short.Id, Item: fmt.Sprintf("short %d", i)}
+				require.NoError(t, store.Update(func(tx Txn) error { return tx.Add(ctx, &shortItem) }))
+				require.NoError(t, store.Update(func(tx Txn) error { return tx.Get(ctx, shortItem.Id, &shortItem) }))
+			}
+			assert.Equal(t, 5, shortItem.Order)
+			assert.Less(t, time.Since(start), 100*time.Millisecond, "short list")
+
+			var page structs.TodoItemList
+			timed("page", func(tx Txn) error {
+				return tx.List(ctx, DefaultListId, structs.ItemQuery{Limit: 50, Cursor: &structs.Cursor{Order: n / 4, Id: ids[n/4-1]}}, &page)
+			})
+			require.Len(t, page.Items, 50)
+			for i, item := range page.Items {
+				assert.Equal(t, ids[n/4+i], item.Id)
+				assert.Equal(t, n/4+i+1, item.Order)
+			}
+
+			added := structs.TodoItem{Item: "added"}
+			timed("add", func(tx Txn) error { return tx.Add(ctx, &added) })
+			assert.Equal(t, n+1, added.Order)
+			timed("reorder", func(tx Txn) error { return tx.Reorder(ctx, ids[n/2], 2) })
+			var moved structs.TodoItem
+			timed("get", func(tx Txn) error { return tx.Get(ctx, ids[n/2], &moved) })
+			assert.Equal(t, 2, moved.Order)
+		})
+	}
+}
+
+func itemNames(items []structs.TodoItem) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Item)
+	}
+	return names
+}
+
+func TestRankStrategies(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			store := NewSqlStore(db, WithRankStrategy(strategy))
+			ctx := context.Background()
+
+			for i, name := range []string{"a", "b", "c", "d"} {
+				err := store.Update(func(tx Txn) error {
+					return tx.Add(ctx, &structs.TodoItem{Item: name, Order: i + 1})
+				})
+				require.NoError(t, err)
+			}
+			err := store.Update(func(tx Txn) error {
+				return tx.Add(ctx, &structs.TodoItem{Item: "e", Order: 7})
+			})
+			assert.EqualError(t, err, "order should be between 1 and 5 and you provided 7")
+
+			items := listStoreItems(t, store)
+			assert.Equal(t, []string{"a", "b", "c", "d"}, itemNames(items))
+
+			err = store.Update(func(tx Txn) error {
+				return tx.Reorder(ctx, items[3].Id, 1)
+			})
+			assert.NoError(t, err)
+			items = listStoreItems(t, store)
+			assert.Equal(t, []string{"d", "a", "b", "c"}, itemNames(items))
+			for i, item := range items {
+				assert.Equal(t, i+1, item.Order)
+			}
+
+			// an item only takes the place of another one
+			for _, order := range []int{0, 5, 99} {
+				err = store.Update(func(tx Txn) error {
+					return tx.Reorder(ctx, items[0].Id, order)
+				})
+				assert.EqualError(t, err, fmt.Sprintf("order should be between 1 and 4 and you provided %d", order))
+			}
+			assert.Equal(t, items, listStoreItems(t, store))
+
+			err = store.Update(func(tx Txn) error {
+				return tx.Update(ctx, &structs.TodoItem{Id: items[0].Id, Item: "d2", Order: 3})
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"a", "b", "d2", "c"}, itemNames(listStoreItems(t, store)))
+
+			var item structs.TodoItem
+			err = store.Update(func(tx Txn) error {
+				return tx.Get(ctx, items[0].Id, &item)
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 3, item.Order)
+
+			// without an order the item stays where it is
+			err = store.Update(func(tx Txn) error {
+				return tx.Update(ctx, &structs.TodoItem{Id: items[0].Id, Item: "d2"})
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"a", "b", "d2", "c"}, itemNames(listStoreItems(t, store)))
+
+			// nor past the last one
+			err = store.Update(func(tx Txn) error {
+				return tx.Update(ctx, &structs.TodoItem{Id: items[0].Id, Item: "d2", Order: 50})
+			})
+			assert.EqualError(t, err, "order should be between 1 and 4 and you provided 50")
+			assert.Equal(t, 3, listStoreItems(t, store)[2].Order)
+
+			var shifted structs.TodoItemList
+			err = store.Update(func(tx Txn) error {
+				return tx.Delete(ctx, items[1].Id, &shifted)
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"b", "d2", "c"}, itemNames(shifted.Items))
+			items = listStoreItems(t, store)
+			assert.Equal(t, []string{"b", "d2", "c"}, itemNames(items))
+			for i, item := range items {
+				assert.Equal(t, i+1, item.Order)
+				assert.Equal(t, item, shifted.Items[i])
+			}
+
+			err = store.Update(func(tx Txn) error {
+				return tx.Add(ctx, &structs.TodoItem{Item: "e", Order: 4})
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestInsertAtPosition(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			store := NewSqlStore(db, WithRankStrategy(strategy))
+			ctx := context.Background()
+
+			add := func(item *structs.TodoItem) error {
+				return store.Update(func(tx Txn) error {
+					return tx.Add(ctx, item)
+				})
+			}
+
+			// without an order the item is appended
+			first := structs.TodoItem{Item: "a"}
+			require.NoError(t, add(&first))
+			assert.Equal(t, 1, first.Order)
+			last := structs.TodoItem{Item: "c"}
+			require.NoError(t, add(&last))
+			assert.Equal(t, 2, last.Order)
+
+			require.NoError(t, add(&structs.TodoItem{Item: "b", Order: 2}))
+			require.NoError(t, add(&structs.TodoItem{Item: "top", Order: 1}))
+
+			items := listStoreItems(t, store)
+			assert.Equal(t, []string{"top", "a", "b", "c"}, itemNames(items))
+			for i, item := range items {
+				assert.Equal(t, i+1, item.Order)
+			}
+
+			err := add(&structs.TodoItem{Item: "far", Order: 6})
+			assert.EqualError(t, err, "order should be between 1 and 5 and you provided 6")
+			assert.Equal(t, []string{"top", "a", "b", "c"}, itemNames(listStoreItems(t, store)))
+		})
+	}
+}
+
+func TestLists(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			// the default list was created with a dense order
+			require.NoError(t, PrepareRanks(db, strategy))
+			testLists(t, NewSqlStore(db, WithRankStrategy(strategy)))
+		})
+	}
+}
+
+// testLists runs the same list scenario against any Store.
+func testLists(t *testing.T, store Store) {
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) error {
+		return store.Update(action)
+	}
+
+	work := structs.List{Name: "Work"}
+	home := structs.List{Name: "Home"}
+	require.NoError(t, update(func(tx Txn) error { return tx.AddList(ctx, &work) }))
+	require.NoError(t, update(func(tx Txn) error { return tx.AddList(ctx, &home) }))
+	assert.Equal(t, 2, work.Order)
+	assert.Equal(t, 3, home.Order)
+
+	// every list is ordered on its own
+	items := map[string]*structs.TodoItem{}
+	for _, item := range []structs.TodoItem{
+		{ListId: work.Id, Item: "report"},
+		{ListId: work.Id, Item: "meeting"},
+		{ListId: home.Id, Item: "dishes"},
+		{ListId: home.Id, Item: "laundry"},
+	} {
+		item := item
+		require.NoError(t, update(func(tx Txn) error { return tx.Add(ctx, &item) }))
+		items[item.Item] = &item
+	}
+	assert.Equal(t, 2, items["meeting"].Order)
+	assert.Equal(t, 2, items["laundry"].Order)
+
+	listItems := func(listId string) []structs.TodoItem {
+		var list structs.TodoItemList
+		require.NoError(t, update(func(tx Txn) error { return tx.List(ctx, listId, structs.ItemQuery{}, &list) }))
+		sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Order < list.Items[j].Order })
+		for i, item := range list.Items {
+			assert.Equal(t, i+1, item.Order)
+			assert.Equal(t, listId, item.ListId)
+		}
+		return list.Items
+	}
+
+	// moving renumbers both lists
+	err := update(func(tx Txn) error { return tx.MoveItem(ctx, items["report"].Id, home.Id, 2) })
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"meeting"}, itemNames(listItems(work.Id)))
+	assert.Equal(t, []string{"dishes", "report", "laundry"}, itemNames(listItems(home.Id)))
+
+	// without an order the item goes to the end
+	err = update(func(tx Txn) error { return tx.MoveItem(ctx, items["dishes"].Id, work.Id, 0) })
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"meeting", "dishes"}, itemNames(listItems(work.Id)))
+	assert.Equal(t, []string{"report", "laundry"}, itemNames(listItems(home.Id)))
+
+	err = update(func(tx Txn) error { return tx.MoveItem(ctx, items["laundry"].Id, work.Id, 4) })
+	assert.EqualError(t, err, "order should be between 1 and 3 and you provided 4")
+	err = update(func(tx Txn) error { return tx.MoveItem(ctx, items["laundry"].Id, "missing", 0) })
+	assert.EqualError(t, err, "list missing does not exist")
+
+	// the lists themselves can be reordered
+	err = update(func(tx Txn) error { return tx.ReorderList(ctx, home.Id, 1) })
+	assert.NoError(t, err)
+	err = update(func(tx Txn) error { return tx.UpdateList(ctx, &structs.List{Id: work.Id, Name: "Office"}) })
+	assert.NoError(t, err)
+
+	var lists structs.Lists
+	require.NoError(t, update(func(tx Txn) error { return tx.ListLists(ctx, &lists) }))
+	assert.Equal(t, []structs.List{
+		{Id: home.Id, Name: "Home", Order: 1},
+		{Id: DefaultListId, Name: "Todo", Order: 2},
+		{Id: work.Id, Name: "Office", Order: 3},
+	}, lists.Items)
+
+	// deleting a list takes its items along and closes the gap
+	var shifted structs.Lists
+	err = update(func(tx Txn) error { return tx.DeleteList(ctx, home.Id, &shifted) })
+	assert.NoError(t, err)
+	assert.Equal(t, []structs.List{
+		{Id: DefaultListId, Name: "Todo", Order: 1},
+		{Id: work.Id, Name: "Office", Order: 2},
+	}, shifted.Items)
+	err = update(func(tx Txn) error { return tx.Get(ctx, items["report"].Id, &structs.TodoItem{}) })
+	assert.EqualError(t, err, "unknown id")
+
+	err = update(func(tx Txn) error { return tx.DeleteList(ctx, DefaultListId, &shifted) })
+	assert.EqualError(t, err, "the default list cannot be deleted")
+}
+
+func rankKeys(t *testing.T, db *sqlx.DB) map[string]string {
+	rows, err := db.Queryx(`SELECT id, rank_key FROM todolist`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	keys := map[string]string{}
+	for rows.Next() {
+		var id, key string
+		require.NoError(t, rows.Scan(&id, &key))
+		keys[id] = key
+	}
+	return keys
+}
+
+func TestLexoRankingWritesOneRow(t *testing.T) {
+	db := setupSQLiteDB(t)
+	store := NewSqlStore(db, WithRankStrategy(LexoRanking))
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		err := store.Update(func(tx Txn) error {
+			return tx.Add(ctx, &structs.TodoItem{Item: "item", Order: i + 1})
+		})
+		require.NoError(t, err)
+	}
+	items := listStoreItems(t, store)
+
+	keysBefore := rankKeys(t, db)
+
+	last := items[len(items)-1]
+	err := store.Update(func(tx Txn) error {
+		return tx.Reorder(ctx, last.Id, 1)
+	})
+	require.NoError(t, err)
+
+	var changed int
+	for id, key := range rankKeys(t, db) {
+		if keysBefore[id] != key {
+			changed++
+		}
+	}
+	assert.Equal(t, 1, changed)
+	assert.Equal(t, last.Id, listStoreItems(t, store)[0].Id)
+}
+
+func TestLexoRankingRebalance(t *testing.T) {
+	db := setupSQLiteDB(t)
+	store := NewSqlStore(db, WithRankStrategy(LexoRanking))
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		err := store.Update(func(tx Txn) error {
+			return tx.Add(ctx, &structs.TodoItem{Item: "item", Order: i + 1})
+		})
+		require.NoError(t, err)
+	}
+	items := listStoreItems(t, store)
+
+	// keep squeezing the last item between the first two until keys get long
+	moving := items[2].Id
+	for i := 0; i < 200; i++ {
+		err := store.Update(func(tx Txn) error {
+			return tx.Reorder(ctx, moving, 2)
+		})
+		require.NoError(t, err)
+		moving = listStoreItems(t, store)[2].Id
+	}
+
+	maxKeyLength := func() int {
+		var length int
+		require.NoError(t, db.Get(&length, `SELECT MAX(LENGTH(rank_key)) FROM todolist`))
+		return length
+	}
+	assert.Eventually(t, func() bool {
+		return maxKeyLength() <= rankKeyRebalanceLength
+	}, 5*time.Second, 10*time.Millisecond)
+
+	items = listStoreItems(t, store)
+	assert.Len(t, items, 3)
+	for i, item := range items {
+		assert.Equal(t, i+1, item.Order)
+	}
+}
+
+func TestLexoRankingAppends(t *testing.T) {
+	// a file without a busy timeout fails the writes that overlap at once
+	db, err := tododb.CreateDb(tododb.Options{DSN: "file:" + filepath.Join(t.TempDir(), "todolist.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	store := NewSqlStore(db, WithRankStrategy(LexoRanking))
+	ctx := context.Background()
+
+	// items added at either end step away from the ends, the keys stay short
+	err = store.Update(func(tx Txn) error {
+		for i := 0; i < 600; i++ {
+			item := structs.TodoItem{Item: fmt.Sprintf("item %d", i)}
+			if i%2 == 1 {
+				item.Order = 1
+			}
+			if err := tx.Add(ctx, &item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	var length int
+	require.NoError(t, db.Get(&length, `SELECT MAX(LENGTH(rank_key)) FROM todolist`))
+	assert.LessOrEqual(t, length, rankStepDigits)
+
+	items := listStoreItems(t, store)
+	require.Len(t, items, 600)
+	assert.Equal(t, "item 599", items[0].Item)
+	assert.Equal(t, "item 598", items[599].Item)
+	require.NoError(t, store.Update(func(tx Txn) error { return tx.Reorder(ctx, items[599].Id, 1) }))
+	assert.Equal(t, "item 598", listStoreItems(t, store)[0].Item)
+}
+
+func TestLexoRankingRebalanceWaitsForWrites(t *testing.T) {
+	db, err := tododb.CreateDb(tododb.Options{DSN: "file:" + filepath.Join(t.TempDir(), "todolist.db")})
+	require.NoError(t, err)
+	defer db.Close()
+	ids := seedItems(t, db, LexoRanking, "", 2000)
+	store := NewSqlStore(db, WithRankStrategy(LexoRanking))
+	ctx := context.Background()
+
+	// squeezing items in at the same place makes the keys long enough for a
+	// rebalance of the whole list
+	err = store.Update(func(tx Txn) error {
+		for i := 0; i < 100; i++ {
+			if err := tx.Add(ctx, &structs.TodoItem{Item: "squeezed", Order: 2}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the writes made in the meantime wait for it, none of them fails
+	for i := 0; i < 50; i++ {
+		require.NoError(t, store.Update(func(tx Txn) error { return tx.Reorder(ctx, ids[i], 3) }))
+	}
+	assert.Eventually(t, func() bool {
+		var length int
+		require.NoError(t, db.Get(&length, `SELECT MAX(LENGTH(rank_key)) FROM todolist`))
+		return length <= rankKeyRebalanceLength
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, ids[49], listStoreItems(t, store)[2].Id)
+}
+
+func TestPrepareRanks(t *testing.T) {
+	db := setupSQLiteDB(t)
+	ctx := context.Background()
+	dense := NewSqlStore(db)
+
+	for i, name := range []string{"a", "b", "c"} {
+		err := dense.Update(func(tx Txn) error {
+			return tx.Add(ctx, &structs.TodoItem{Item: name, Order: i + 1})
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, PrepareRanks(db, LexoRanking))
+	var withOrder int
+	require.NoError(t, db.Get(&withOrder, `SELECT COUNT(*) FROM todolist WHERE "order" IS NOT NULL`))
+	assert.Equal(t, 0, withOrder)
+	assert.Equal(t, []string{"a", "b", "c"}, itemNames(listStoreItems(t, NewSqlStore(db, WithRankStrategy(LexoRanking)))))
+
+	require.NoError(t, PrepareRanks(db, DenseRanking))
+	var withKey int
+	require.NoError(t, db.Get(&withKey, `SELECT COUNT(*) FROM todolist WHERE rank_key IS NOT NULL`))
+	assert.Equal(t, 0, withKey)
+	assert.Equal(t, []string{"a", "b", "c"}, itemNames(listStoreItems(t, dense)))
+}
+
+func TestParseRankStrategy(t *testing.T) {
+	strategy, err := ParseRankStrategy("lexorank")
+	assert.NoError(t, err)
+	assert.Equal(t, LexoRanking, strategy)
+
+	_, err = ParseRankStrategy("random")
+	assert.Error(t, err)
+}
+
+func TestUniqueOrder(t *testing.T) {
+	t.Run("Duplicate order is rejected by the database", func(t *testing.T) {
+		db := setupSQLiteDB(t)
+		_, err := db.Exec(`INSERT INTO todolist (id, item, "order") VALUES ('1', 'a', 1)`)
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO todolist (id, item, "order") VALUES ('2', 'b', 1)`)
+		assert.Error(t, err)
+	})
+
+	t.Run("Concurrent adds never share an order", func(t *testing.T) {
+		dsn := "file:" + filepath.Join(t.TempDir(), "todolist.db") + "?_busy_timeout=5000"
+		db, err := tododb.CreateDb(tododb.Options{DSN: dsn})
+		require.NoError(t, err)
+		defer db.Close()
+		store := NewSqlStore(db)
+		ctx := context.Background()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// errors are fine, duplicates are not
+				_ = store.Update(func(tx Txn) error {
+					var list structs.TodoItemList
+					if err := tx.List(ctx, DefaultListId, structs.ItemQuery{}, &list); err != nil {
+						return err
+					}
+					return tx.Add(ctx, &structs.TodoItem{Item: "item", Order: list.Count + 1})
+				})
+			}()
+		}
+		wg.Wait()
+
+		var duplicates int
+		err = db.Get(&duplicates, `SELECT COUNT(*) FROM (SELECT "order" FROM todolist GROUP BY "order" HAVING COUNT(*) > 1) d`)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, duplicates)
+	})
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"time"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// nextOccurrence returns the item that follows a recurring item completed at
+// now, nil when the item does not recur or its rule has run out. It is due at
+// the first date of the rule after both the due date of the item and now, so
+// an item completed late does not leave a trail of overdue ones behind, and
+// the occurrences it skips count towards the COUNT of the rule. Sub-tasks are
+// not carried over.
+func nextOccurrence(item structs.TodoItem, now time.Time) (*structs.TodoItem, error) {
+	if item.Recurrence == "" || item.DueAt == nil {
+		return nil, nil
+	}
+	rule, err := structs.ParseRecurrence(item.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(item.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+	dueAt, passed, ok := rule.Next(item.DueAt.In(loc), now)
+	if !ok {
+		return nil, nil
+	}
+	recurrence := item.Recurrence
+	if rule.Count > 0 {
+		rule.Count -= passed
+		recurrence = rule.String()
+	}
+	dueAt = dueAt.UTC()
+	return &structs.TodoItem{
+		ListId:     item.ListId,
+		ParentId:   item.ParentId,
+		Item:       item.Item,
+		Notes:      item.Notes,
+		DueAt:      &dueAt,
+		Priority:   item.Priority,
+		Tags:       item.Tags,
+		Recurrence: recurrence,
+		TimeZone:   item.TimeZone,
+	}, nil
+}
+
+// recurrenceOrder is where the next occurrence of an item goes, given the
+// order the item had before it was completed: right below the item when the
+// completed item keeps its place, where the item was otherwise.
+func recurrenceOrder(policy CompletionPolicy, order int) int {
+	if policy == KeepPlace && order > 0 {
+		return order + 1
+	}
+	return order
+}
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.altair.com/todolist/pkg/structs"
+)
+
+func TestRecurrence(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			testRecurrence(t, func(policy CompletionPolicy, clock func() time.Time) Store {
+				db := setupSQLiteDB(t)
+				require.NoError(t, PrepareRanks(db, strategy))
+				return NewSqlStore(db, WithRankStrategy(strategy), WithCompletionPolicy(policy), WithClock(clock))
+			})
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testRecurrence(t, func(policy CompletionPolicy, clock func() time.Time) Store {
+			return NewMemoryStore(WithCompletionPolicy(policy), WithClock(clock))
+		})
+	})
+}
+
+// testRecurrence runs the same recurrence scenario against any Store, under
+// every completion policy.
+func testRecurrence(t *testing.T, newStore func(policy CompletionPolicy, clock func() time.Time) Store) {
+	ctx := context.Background()
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", value, newYork)
+		require.NoError(t, err)
+		return parsed.UTC()
+	}
+
+	for _, tt := range []struct {
+		policy CompletionPolicy
+		// order is where the next occurrence goes, names the ordered items after it
+		order int
+		names []string
+	}{
+		{KeepPlace, 3, []string{"a", "gym", "gym", "c"}},
+		{SinkToBottom, 2, []string{"a", "gym", "c", "gym"}},
+		{LeaveSequence, 2, []string{"a", "gym", "c"}},
+	} {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			var now time.Time
+			store := newStore(tt.policy, func() time.Time { return now })
+			update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+			add := func(item structs.TodoItem) structs.TodoItem {
+				update(func(tx Txn) error { return tx.Add(ctx, &item) })
+				return item
+			}
+			complete := func(id string, done bool) structs.TodoItem {
+				var item structs.TodoItem
+				update(func(tx Txn) error { return tx.Complete(ctx, id, done, &item) })
+				return item
+			}
+			get := func(id string) structs.TodoItem {
+				var item structs.TodoItem
+				update(func(tx Txn) error { return tx.Get(ctx, id, &item) })
+				return item
+			}
+			ordered := func() []string {
+				var items structs.TodoItemList
+				update(func(tx Txn) error { return tx.List(ctx, DefaultListId, structs.ItemQuery{}, &items) })
+				sorted := make([]structs.TodoItem, 0)
+				for _, item := range items.Items {
+					if item.Order > 0 {
+						sorted = append(sorted, item)
+					}
+				}
+				sort.Slice(sorted, func(i, j int) bool { return sorted[i].Order < sorted[j].Order })
+				return itemNames(sorted)
+			}
+
+			// on Mondays and Thursdays, across the start of daylight saving time
+			dueAt := at("2024-03-07 09:00")
+			add(structs.TodoItem{Item: "a"})
+			gym := add(structs.TodoItem{Item: "gym", DueAt: &dueAt, Priority: structs.PriorityHigh,
+				Recurrence: "FREQ=WEEKLY;BYDAY=MO,TH", TimeZone: "America/New_York"})
+			add(structs.TodoItem{Item: "c"})
+			update(func(tx Txn) error { return tx.TagItem(ctx, gym.Id, "health") })
+
+			now = at("2024-03-07 10:00")
+			completed := complete(gym.Id, true)
+			assert.True(t, completed.CompletedAt.Equal(now), "completed at the time of the clock")
+			require.NotEmpty(t, completed.NextId)
+			next := get(completed.NextId)
+			assert.Equal(t, at("2024-03-11 09:00"), *next.DueAt)
+			assert.Equal(t, "2024-03-11T13:00:00Z", next.DueAt.Format(time.RFC3339), "09:00 in daylight saving time")
+			assert.False(t, next.Done)
+			assert.Equal(t, tt.order, next.Order)
+			assert.Equal(t, 1, next.Version)
+			assert.Equal(t, structs.PriorityHigh, next.Priority)
+			assert.Equal(t, []string{"health"}, next.Tags)
+			assert.Equal(t, "FREQ=WEEKLY;BYDAY=MO,TH", next.Recurrence)
+			assert.Equal(t, "America/New_York", next.TimeZone)
+			assert.Equal(t, tt.names, ordered())
+
+			// completing it again or opening it adds nothing
+			assert.Empty(t, complete(gym.Id, true).NextId)
+			assert.Empty(t, complete(gym.Id, false).NextId)
+
+			// completed late, the occurrences in the meantime are skipped
+			now = at("2024-03-20 12:00")
+			after := get(complete(next.Id, true).NextId)
+			assert.Equal(t, at("2024-03-21 09:00"), *after.DueAt)
+
+			// until the count runs out
+			dueAt = at("2024-03-20 18:00")
+			twice := add(structs.TodoItem{Item: "twice", DueAt: &dueAt, Recurrence: "FREQ=DAILY;COUNT=2"})
+			last := get(complete(twice.Id, true).NextId)
+			assert.Equal(t, "FREQ=DAILY;COUNT=1", last.Recurrence)
+			assert.Equal(t, dueAt.Add(24*time.Hour), *last.DueAt, "days in UTC without a time zone")
+			assert.Empty(t, complete(last.Id, true).NextId)
+
+			plain := add(structs.TodoItem{Item: "plain", DueAt: &dueAt})
+			assert.Empty(t, complete(plain.Id, true).NextId)
+
+			// the rule of an item is changed like the rest of it
+			plain = get(plain.Id)
+			plain.Recurrence, plain.TimeZone = "FREQ=MONTHLY", "Europe/Athens"
+			update(func(tx Txn) error { return tx.Update(ctx, &plain) })
+			plain = get(plain.Id)
+			assert.Equal(t, "FREQ=MONTHLY", plain.Recurrence)
+			assert.Equal(t, "Europe/Athens", plain.TimeZone)
+		})
+	}
+}
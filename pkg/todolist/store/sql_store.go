@@ -4,25 +4,70 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
+	"go.altair.com/todolist/pkg/auth"
 	"go.altair.com/todolist/pkg/structs"
 )
 
-func NewSqlStore(db *sqlx.DB) Store {
+const (
+	maxTxAttempts    = 5
+	txRetryBaseDelay = 10 * time.Millisecond
+)
+
+func NewSqlStore(db *sqlx.DB, opts ...Option) Store {
+	o := newOptions(opts)
 	return &sqlStore{
-		db: db,
+		db:         db,
+		dialect:    dialectFor(db.DriverName()),
+		ranker:     newRanker(o.rankStrategy),
+		completion: o.completion,
+		clock:      o.clock,
 	}
 }
 
 type sqlStore struct {
-	db *sqlx.DB
+	db          *sqlx.DB
+	dialect     dialect
+	ranker      ranker
+	completion  CompletionPolicy
+	clock       func() time.Time
+	rebalancing atomic.Bool
+	// writing is held for reading by every Update and for writing by a
+	// background rebalance, so that the writes wait for the rebalance to be
+	// done rather than fail on the lock it holds
+	writing sync.RWMutex
 }
 
+// Update runs the action in a transaction. Transactions that fail because of a
+// serialization conflict with a concurrent one are re-run from scratch.
 func (s *sqlStore) Update(action func(tx Txn) error) error {
-	dbtx, err := s.db.Beginx()
+	s.writing.RLock()
+	defer s.writing.RUnlock()
+	return s.retry(action)
+}
+
+// retry runs the action in a transaction until it succeeds, fails for any
+// other reason than a conflict, or has been tried maxTxAttempts times.
+func (s *sqlStore) retry(action func(tx Txn) error) error {
+	for attempt := 1; ; attempt++ {
+		err := s.update(action)
+		if err == nil || attempt == maxTxAttempts || !s.dialect.retryable(err) {
+			return err
+		}
+		log.Debug().Msg(fmt.Sprintf("Retrying transaction (attempt %d) after conflict: %v", attempt, err))
+		time.Sleep(txRetryBaseDelay << (attempt - 1))
+	}
+}
+
+func (s *sqlStore) update(action func(tx Txn) error) error {
+	dbtx, err := s.db.BeginTxx(context.Background(), &sql.TxOptions{Isolation: s.dialect.isolation})
 	if err != nil {
 		return err
 	}
@@ -35,7 +80,10 @@ func (s *sqlStore) Update(action func(tx Txn) error) error {
 	}()
 
 	tx := &sqlStoreTxn{
-		txn: dbtx,
+		txn:        dbtx,
+		ranker:     s.ranker,
+		completion: s.completion,
+		clock:      s.clock,
 	}
 
 	err = action(tx)
@@ -45,32 +93,195 @@ func (s *sqlStore) Update(action func(tx Txn) error) error {
 		return err
 	}
 
-	return dbtx.Commit()
+	err = dbtx.Commit()
+	if err == nil && len(tx.rebalanceNeeded) > 0 {
+		s.rebalanceInBackground(tx.rebalanceNeeded)
+	}
+	return err
+}
+
+// rebalanceInBackground rewrites the rank keys of the sequences once they have
+// grown too long, unless a rebalance is already running.
+func (s *sqlStore) rebalanceInBackground(seqs []sequence) {
+	if !s.rebalancing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer s.rebalancing.Store(false)
+		s.writing.Lock()
+		defer s.writing.Unlock()
+		err := s.retry(func(tx Txn) error {
+			for _, seq := range seqs {
+				err := s.ranker.rebalance(context.Background(), tx.(*sqlStoreTxn), seq)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Warn().Err(err).Msg("Background rebalance failed")
+			return
+		}
+		log.Debug().Msg("Background rebalance completed")
+	}()
 }
 
 type sqlStoreTxn struct {
-	txn *sqlx.Tx
+	txn        *sqlx.Tx
+	ranker     ranker
+	completion CompletionPolicy
+	clock      func() time.Time
+	// rebalanceNeeded holds the sequences the transaction wrote an overly long rank key to
+	rebalanceNeeded []sequence
 }
 
 func readRecord(rows *sql.Rows, record *structs.TodoItem) error {
-	return rows.Scan(
+	// completed items that left the sequence have no order
+	var order sql.NullInt64
+	var completedAt, dueAt, createdAt, updatedAt, deletedAt sql.NullTime
+	err := rows.Scan(
 		&record.Id,
+		&record.ListId,
+		&record.ParentId,
 		&record.Item,
-		&record.Order,
+		&record.Notes,
+		&record.Done,
+		&completedAt,
+		&dueAt,
+		&record.Priority,
+		&record.Recurrence,
+		&record.TimeZone,
+		&record.Version,
+		&createdAt,
+		&updatedAt,
+		&deletedAt,
+		&order,
+	)
+	record.Order = int(order.Int64)
+	record.CompletedAt = nil
+	if completedAt.Valid {
+		record.CompletedAt = &completedAt.Time
+	}
+	record.DueAt = nil
+	if dueAt.Valid {
+		record.DueAt = utcSeconds(&dueAt.Time)
+	}
+	record.CreatedAt, record.UpdatedAt = nil, nil
+	if createdAt.Valid {
+		record.CreatedAt = &createdAt.Time
+	}
+	if updatedAt.Valid {
+		record.UpdatedAt = &updatedAt.Time
+	}
+	record.DeletedAt = nil
+	if deletedAt.Valid {
+		record.DeletedAt = &deletedAt.Time
+	}
+	record.Tags = nil
+	record.Blocked, record.BlockedBy = false, nil
+	return err
+}
+
+func readList(rows *sql.Rows, list *structs.List) error {
+	return rows.Scan(
+		&list.Id,
+		&list.Name,
+		&list.Order,
 	)
 }
 
+// lists is the sequence of the lists of the principal in ctx.
+func (tx *sqlStoreTxn) lists(ctx context.Context) sequence {
+	return listsSequence(auth.Principal(ctx))
+}
+
+// items is the sequence of the sub-tasks of parentId in one of the lists of
+// the principal in ctx, or of its top-level items when parentId is empty.
+func (tx *sqlStoreTxn) items(ctx context.Context, listId, parentId string) sequence {
+	return itemsSequence(auth.Principal(ctx), listId, parentId)
+}
+
+// descendants returns the ids of the sub-tasks of an item, at any depth.
+func (tx *sqlStoreTxn) descendants(ctx context.Context, listId, id string) ([]string, error) {
+	ids := make([]string, 0)
+	err := tx.txn.SelectContext(ctx, &ids, tx.txn.Rebind(`WITH RECURSIVE DESCENDANTS(ID) AS (
+            SELECT ID FROM TODOLIST WHERE OWNER = ? AND LIST_ID = ? AND PARENT_ID = ?
+            UNION ALL
+            SELECT T.ID FROM TODOLIST T JOIN DESCENDANTS D ON T.PARENT_ID = D.ID WHERE T.OWNER = ? AND T.LIST_ID = ?
+        ) SELECT ID FROM DESCENDANTS`), auth.Principal(ctx), listId, id, auth.Principal(ctx), listId)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get the sub-tasks of item %s: %v", id, err))
+	}
+	return ids, err
+}
+
+// maxBoundIds is the most ids bound to a single IN (?) list, well below the
+// 999 variables older SQLite builds allow in a statement.
+const maxBoundIds = 500
+
+// chunkIds splits ids into lists of at most maxBoundIds, for the statements
+// that bind every one of them.
+func chunkIds(ids []string) [][]string {
+	var chunks [][]string
+	for len(ids) > maxBoundIds {
+		chunks = append(chunks, ids[:maxBoundIds])
+		ids = ids[maxBoundIds:]
+	}
+	if len(ids) > 0 {
+		chunks = append(chunks, ids)
+	}
+	return chunks
+}
+
+// execIn runs a statement with an IN (?) that ids are bound to after args,
+// once for every chunk of them.
+func (tx *sqlStoreTxn) execIn(ctx context.Context, queryStmt string, ids []string, args ...interface{}) error {
+	for _, chunk := range chunkIds(ids) {
+		inStmt, inArgs, err := sqlx.In(queryStmt, append(append([]interface{}{}, args...), chunk)...)
+		if err != nil {
+			return err
+		}
+		_, err = tx.txn.ExecContext(ctx, tx.txn.Rebind(inStmt), inArgs...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkParent fails unless parentId is empty or an item in the list.
+func (tx *sqlStoreTxn) checkParent(ctx context.Context, listId, parentId string) error {
+	if parentId == "" {
+		return nil
+	}
+	var parentListId string
+	err := tx.txn.GetContext(ctx, &parentListId,
+		tx.txn.Rebind(`SELECT LIST_ID FROM TODOLIST WHERE ID = ? AND OWNER = ? AND DELETED_AT IS NULL`), parentId, auth.Principal(ctx))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("unknown parent item %s", parentId)
+		}
+		log.Debug().Msg(fmt.Sprintf("Failed to check the parent item: %v", err))
+		return err
+	}
+	if parentListId != listId {
+		return fmt.Errorf("the parent item is in another list")
+	}
+	return nil
+}
+
 func (tx *sqlStoreTxn) DbTx() interface{} {
 	return tx.txn
 }
 
 func (tx *sqlStoreTxn) CheckId(ctx context.Context, id string) error {
 	var existingId string
-	err := tx.txn.GetContext(ctx, &existingId, `SELECT ID FROM TODOLIST WHERE ID = ? LIMIT 1`, id)
+	err := tx.txn.GetContext(ctx, &existingId, tx.txn.Rebind(`SELECT ID FROM TODOLIST WHERE ID = ? AND OWNER = ? AND DELETED_AT IS NULL LIMIT 1`), id, auth.Principal(ctx))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Debug().Msg(fmt.Sprintf("ID %s does not exist", id))
-			return fmt.Errorf("ID %s does not exist", id)
+			return NotFoundf("ID %s does not exist", id)
 		}
 		log.Debug().Msg(fmt.Sprintf("Failed to check existing ID: %v", err))
 		return err
@@ -78,10 +289,11 @@ func (tx *sqlStoreTxn) CheckId(ctx context.Context, id string) error {
 	return nil
 }
 
-func (tx *sqlStoreTxn) checkIfOrderExists(ctx context.Context, order int, id string) (bool, error) {
+func (tx *sqlStoreTxn) checkIfOrderExists(ctx context.Context, seq sequence, order int, id string) (bool, error) {
 	var existingOrder int
-	query := `SELECT "ORDER" FROM TODOLIST WHERE "ORDER" = ? AND ID != ? LIMIT 1`
-	err := tx.txn.GetContext(ctx, &existingOrder, query, order, id)
+	source, args := tx.ranker.source(seq)
+	query := `SELECT "order" FROM ` + source + seq.where(`"order" = ?`, `ID != ?`) + ` LIMIT 1`
+	err := tx.txn.GetContext(ctx, &existingOrder, tx.txn.Rebind(query), append(args, seq.args(order, id)...)...)
 	if err == nil {
 		return true, nil
 	}
@@ -92,238 +304,1168 @@ func (tx *sqlStoreTxn) checkIfOrderExists(ctx context.Context, order int, id str
 	return false, err
 }
 
-func (tx *sqlStoreTxn) Add(ctx context.Context, record *structs.TodoItem) error {
-	// Generate a UUID if the ID is empty
-	if record.Id == "" {
-		record.Id = uuid.New().String()
+// checkListId fails unless the principal in ctx has a list with the id. The
+// default list is created when it is missing.
+func (tx *sqlStoreTxn) checkListId(ctx context.Context, id string) error {
+	seq := tx.lists(ctx)
+	var existingId string
+	err := tx.txn.GetContext(ctx, &existingId, tx.txn.Rebind(`SELECT ID FROM LISTS`+seq.where(`ID = ?`)+` LIMIT 1`), seq.args(id)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			if id == DefaultListId {
+				return tx.AddList(ctx, &structs.List{Id: DefaultListId, Name: defaultListName})
+			}
+			log.Debug().Msg(fmt.Sprintf("List %s does not exist", id))
+			return NotFoundf("list %s does not exist", id)
+		}
+		log.Debug().Msg(fmt.Sprintf("Failed to check existing list: %v", err))
+		return err
 	}
+	return nil
+}
 
-	// Check if any other item exists in the SQL
+// insertionOrder validates the order of a new row in seq, where 0 means the
+// end of the sequence, and opens a gap there. It returns the order to insert at.
+func (tx *sqlStoreTxn) insertionOrder(ctx context.Context, seq sequence, order int) (int, error) {
+	// Check if any other item exists in the SQL, completed items may have left the sequence
 	var count int
-	err := tx.txn.GetContext(ctx, &count, `SELECT COUNT(*) FROM TODOLIST`)
+	source, args := tx.ranker.source(seq)
+	err := tx.txn.GetContext(ctx, &count,
+		tx.txn.Rebind(`SELECT COUNT("order") FROM `+source+seq.where()), append(args, seq.args()...)...)
 	if err != nil {
 		log.Debug().Msg(fmt.Sprintf("Failed to get the count of items: %v", err))
-		return err
+		return 0, err
+	}
+
+	// Without an order the item is appended, otherwise the order has to be
+	// within the list or right after its end
+	var maxOrder int
+	if count > 0 {
+		err = tx.txn.GetContext(ctx, &maxOrder,
+			tx.txn.Rebind(`SELECT MAX("order") FROM `+source+seq.where()), append(args, seq.args()...)...)
+		if err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to get the max order: %v", err))
+			return 0, err
+		}
+	}
+	if order == 0 {
+		order = maxOrder + 1
 	}
 
 	if count == 0 {
 		// If no other items exist, the order should be 1
-		if record.Order != 1 {
-			return fmt.Errorf("order should be 1 for the first item, but got %d", record.Order)
+		if order != 1 {
+			return 0, fmt.Errorf("order should be 1 for the first item, but got %d", order)
 		}
-	} else {
-		// Otherwise, the provided order of the new item has to be greater by 1 from the current max order
-		var maxOrder int
-		err = tx.txn.GetContext(ctx, &maxOrder, `SELECT MAX("ORDER") FROM TODOLIST`)
+	} else if order < 1 || order > maxOrder+1 {
+		return 0, fmt.Errorf("order should be between 1 and %d and you provided %d", maxOrder+1, order)
+	}
+
+	if order <= maxOrder {
+		// inserting before the end, the items from the new order onwards move down by one
+		err = tx.ranker.openGap(ctx, tx, seq, order, maxOrder)
 		if err != nil {
-			log.Debug().Msg(fmt.Sprintf("Failed to get the max order: %v", err))
-			return err
+			return 0, err
 		}
-		if record.Order != maxOrder+1 {
-			return fmt.Errorf("order should be %d and you provided %d", maxOrder+1, record.Order)
+	}
+	return order, nil
+}
+
+// completionOrder checks the order an item is put at in seq against the
+// completion policy, see checkCompletionOrder. The items are only counted
+// when the policy restricts the order.
+func (tx *sqlStoreTxn) completionOrder(ctx context.Context, seq sequence, id string, done bool, order int) (int, error) {
+	if tx.completion == KeepPlace || (tx.completion == LeaveSequence && !done) {
+		return order, nil
+	}
+	var open, ordered int
+	if tx.completion == SinkToBottom {
+		var err error
+		if open, ordered, err = tx.countOrdered(ctx, seq, id); err != nil {
+			return 0, err
 		}
 	}
+	return checkCompletionOrder(tx.completion, done, open, ordered, order)
+}
 
-	_, err = tx.txn.ExecContext(ctx,
-		tx.txn.Rebind(`INSERT INTO TODOLIST(ID, ITEM, "ORDER") VALUES(?, ?, ?)`),
-		record.Id,
-		record.Item,
-		record.Order,
-	)
+// moveOrder checks the order an item of seq is moved to, see checkMoveOrder.
+func (tx *sqlStoreTxn) moveOrder(ctx context.Context, seq sequence, id string, done bool, order int) error {
+	open, ordered, err := tx.countOrdered(ctx, seq, id)
 	if err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to add item: %v", err))
+		return err
 	}
-	return err
+	return checkMoveOrder(tx.completion, done, open, ordered, order)
 }
 
-func (tx *sqlStoreTxn) Delete(ctx context.Context, id string) error {
+// countOrdered counts the open items and all items of seq with an order,
+// leaving out the item with id.
+func (tx *sqlStoreTxn) countOrdered(ctx context.Context, seq sequence, id string) (open, ordered int, err error) {
+	source, args := tx.ranker.source(seq)
+	err = tx.txn.QueryRowxContext(ctx,
+		tx.txn.Rebind(`SELECT COUNT(CASE WHEN NOT DONE THEN "order" END), COUNT("order") FROM `+
+			source+seq.where(`ID != ?`)), append(args, seq.args(id)...)...).Scan(&open, &ordered)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to count the open items: %v", err))
+	}
+	return open, ordered, err
+}
 
-	result, err := tx.txn.ExecContext(ctx, tx.txn.Rebind("DELETE FROM TODOLIST WHERE ID=?"), id)
+// takeOut takes an item at order out of seq and closes the gap it leaves.
+func (tx *sqlStoreTxn) takeOut(ctx context.Context, seq sequence, id string, order int) error {
+	var last int
+	source, args := tx.ranker.source(seq)
+	err := tx.txn.GetContext(ctx, &last,
+		tx.txn.Rebind(`SELECT MAX("order") FROM `+source+seq.where()), append(args, seq.args()...)...)
 	if err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to delete item with ID %s: %v", id, err))
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+	err = tx.ranker.detach(ctx, tx, seq, id)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
-		return fmt.Errorf("unknown id")
+	if order < last {
+		return tx.ranker.closeGap(ctx, tx, seq, order+1, last)
 	}
 	return nil
 }
 
-func (tx *sqlStoreTxn) Update(ctx context.Context, record *structs.TodoItem) error {
+func (tx *sqlStoreTxn) Add(ctx context.Context, record *structs.TodoItem) error {
+	// Generate a UUID if the ID is empty
+	ownId := record.Id != ""
+	if !ownId {
+		record.Id = uuid.New().String()
+	}
+	if record.ListId == "" {
+		record.ListId = DefaultListId
+	}
+	// items are created open, see Complete
+	record.Done = false
+	record.CompletedAt = nil
+	record.DueAt = utcSeconds(record.DueAt)
+	record.Tags = nil
+	record.Blocked, record.BlockedBy = false, nil
+	record.NotesHTML = ""
+	record.NextId = ""
+	now := writeTime()
+	record.Version, record.CreatedAt, record.UpdatedAt = 1, &now, &now
 
-	// check if the order provided to the new body is already taken by another item
-	orderNeedsChange, err := tx.checkIfOrderExists(ctx, record.Order, record.Id)
+	err := tx.checkListId(ctx, record.ListId)
 	if err != nil {
 		return err
 	}
-	if orderNeedsChange {
-		// if the order has changed, we need shift again all the items with order
-		// greater than the new order, like we did in the reorder method
-		err := tx.Reorder(ctx, record.Id, record.Order)
+	// the id of a deleted item is free again, for clients that pick their own
+	if ownId {
+		err = tx.discardTrashed(ctx, record.Id)
 		if err != nil {
 			return err
 		}
 	}
-
-	result, err := tx.txn.ExecContext(ctx,
-		tx.txn.Rebind(`UPDATE TODOLIST SET
-            ITEM = ?,
-            "ORDER" = ?
-            WHERE ID = ?`),
-		record.Item,
-		record.Order,
-		record.Id,
-	)
+	err = tx.checkParent(ctx, record.ListId, record.ParentId)
 	if err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to update item: %v", err))
 		return err
 	}
-	rowsAffected, err := result.RowsAffected()
+
+	seq := tx.items(ctx, record.ListId, record.ParentId)
+	record.Order, err = tx.completionOrder(ctx, seq, record.Id, false, record.Order)
 	if err != nil {
 		return err
 	}
-	if rowsAffected == 0 {
-		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", record.Id))
-		return fmt.Errorf("unknown id")
+	record.Order, err = tx.insertionOrder(ctx, seq, record.Order)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	err = tx.ranker.insert(ctx, tx, seq, record.Order, "OWNER, ID, LIST_ID, PARENT_ID, ITEM, NOTES, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT",
+		auth.Principal(ctx), record.Id, record.ListId, record.ParentId, record.Item, record.Notes, record.DueAt, record.Priority,
+		record.Recurrence, record.TimeZone, record.Version, record.CreatedAt, record.UpdatedAt)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to add item: %v", err))
+	}
+	return err
 }
 
-func (tx *sqlStoreTxn) ReorderItems(ctx context.Context, reorderQuery string, newOrder, currentOrder int) error {
+func (tx *sqlStoreTxn) Delete(ctx context.Context, id string, shifted *structs.TodoItemList) error {
 
-	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(reorderQuery), newOrder, currentOrder)
+	var deleted structs.TodoItem
+	err := tx.Get(ctx, id, &deleted)
 	if err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to get the current order list of items: %v", err))
 		return err
 	}
-	defer rows.Close()
 
-	reordered := false
-	for rows.Next() {
-		reordered = true
-		var record structs.TodoItem
-		if err := readRecord(rows, &record); err != nil {
-			log.Debug().Msg(fmt.Sprintf("Failed to read record: %v", err))
+	// every sibling after the deleted item moves up by one to close the gap,
+	// unless it had left the sequence
+	seq := tx.items(ctx, deleted.ListId, deleted.ParentId)
+	shifted.Items, shifted.Count = make([]structs.TodoItem, 0), 0
+	if deleted.Order > 0 {
+		source, args := tx.ranker.source(seq)
+		err = tx.selectItems(ctx, shifted,
+			`SELECT `+seq.columns+`, "order" FROM `+source+seq.where(`"order" > ?`)+` ORDER BY "order"`,
+			append(args, seq.args(deleted.Order)...)...)
+		if err != nil {
 			return err
 		}
-		var newOrderValue int
-		if newOrder > currentOrder {
-			newOrderValue = record.Order - 1
-		} else {
-			newOrderValue = record.Order + 1
+	}
+
+	// the sub-tasks go to the trash with their item and keep their places
+	// under it, the ones that are already there stay with what they went with
+	ids, err := tx.descendants(ctx, deleted.ListId, id)
+	if err != nil {
+		return err
+	}
+	ids = append(ids, id)
+	err = tx.execIn(ctx, "UPDATE TODOLIST SET DELETED_AT = ? WHERE OWNER=? AND ID IN (?) AND DELETED_AT IS NULL",
+		ids, writeTime(), auth.Principal(ctx))
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to delete item with ID %s: %v", id, err))
+		return err
+	}
+	// the item remembers its position, to be restored there
+	_, err = tx.txn.ExecContext(ctx, tx.txn.Rebind("UPDATE TODOLIST SET DELETED_ORDER = ? WHERE ID=? AND OWNER=?"),
+		deleted.Order, id, auth.Principal(ctx))
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to delete item with ID %s: %v", id, err))
+		return err
+	}
+	err = tx.touch(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+
+	if deleted.Order > 0 {
+		err = tx.ranker.detach(ctx, tx, seq, id)
+		if err != nil {
+			return err
 		}
-		_, err = tx.txn.ExecContext(ctx,
-			tx.txn.Rebind(`UPDATE TODOLIST SET "ORDER" = ? WHERE ID = ?`),
-			newOrderValue,
-			record.Id,
-		)
+	}
+	if shifted.Count > 0 {
+		err = tx.ranker.closeGap(ctx, tx, seq, deleted.Order+1, shifted.Items[shifted.Count-1].Order)
 		if err != nil {
-			log.Debug().Msg(fmt.Sprintf("Failed to update items with new order: %v", err))
 			return err
 		}
 	}
+	for i := range shifted.Items {
+		shifted.Items[i].Order--
+	}
+	return nil
+}
 
-	if !reordered {
-		return fmt.Errorf("no items were reordered")
+// trashedWith returns the ids of the sub-tasks that went to the trash along
+// with an item, at any depth. Those that were deleted on their own before are
+// left out, along with their sub-tasks.
+func (tx *sqlStoreTxn) trashedWith(ctx context.Context, id string) ([]string, error) {
+	ids := make([]string, 0)
+	err := tx.txn.SelectContext(ctx, &ids, tx.txn.Rebind(`WITH RECURSIVE TRASHED(ID) AS (
+            SELECT ID FROM TODOLIST WHERE OWNER = ? AND PARENT_ID = ? AND DELETED_AT IS NOT NULL AND DELETED_ORDER IS NULL
+            UNION ALL
+            SELECT T.ID FROM TODOLIST T JOIN TRASHED D ON T.PARENT_ID = D.ID WHERE T.OWNER = ? AND T.DELETED_AT IS NOT NULL AND T.DELETED_ORDER IS NULL
+        ) SELECT ID FROM TRASHED`), auth.Principal(ctx), id, auth.Principal(ctx))
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get the sub-tasks trashed with item %s: %v", id, err))
 	}
+	return ids, err
+}
 
-	return nil
+// itemReferences are the columns of the other tables that refer to items,
+// whose rows go along with the items they refer to when those are removed for
+// good.
+var itemReferences = []struct{ table, column string }{
+	{"ITEM_TAGS", "ITEM_ID"},
+	{"ATTACHMENTS", "ITEM_ID"},
+	{"ITEM_BLOCKERS", "ITEM_ID"},
+	{"ITEM_BLOCKERS", "BLOCKER_ID"},
 }
 
-func (tx *sqlStoreTxn) Reorder(ctx context.Context, id string, newOrder int) error {
+// discardTrashed deletes an item of the user for good if it is in the trash,
+// along with the sub-tasks that went there with it.
+func (tx *sqlStoreTxn) discardTrashed(ctx context.Context, id string) error {
+	var count int
+	err := tx.txn.GetContext(ctx, &count,
+		tx.txn.Rebind(`SELECT COUNT(*) FROM TODOLIST WHERE ID = ? AND OWNER = ? AND DELETED_AT IS NOT NULL`), id, auth.Principal(ctx))
+	if err != nil || count == 0 {
+		return err
+	}
 
-	err := tx.CheckId(ctx, id)
+	ids, err := tx.trashedWith(ctx, id)
 	if err != nil {
 		return err
 	}
+	ids = append(ids, id)
+	for _, ref := range itemReferences {
+		err = tx.execIn(ctx, `DELETE FROM `+ref.table+` WHERE OWNER = ? AND `+ref.column+` IN (
+            SELECT ID FROM TODOLIST WHERE OWNER = ? AND ID IN (?) AND DELETED_AT IS NOT NULL
+        )`, ids, auth.Principal(ctx), auth.Principal(ctx))
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.execIn(ctx, "DELETE FROM TODOLIST WHERE OWNER = ? AND ID IN (?) AND DELETED_AT IS NOT NULL", ids, auth.Principal(ctx))
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to discard item %s from the trash: %v", id, err))
+	}
+	return err
+}
+
+func (tx *sqlStoreTxn) ListTrash(ctx context.Context, items *structs.TodoItemList) error {
+	return tx.selectItems(ctx, items, `SELECT `+itemsSequence("", "", "").columns+`, DELETED_ORDER FROM TODOLIST
+        WHERE OWNER = ? AND DELETED_ORDER IS NOT NULL ORDER BY DELETED_AT DESC, ID`, auth.Principal(ctx))
+}
 
-	var currentOrder int
-	err = tx.txn.GetContext(ctx, &currentOrder, `SELECT "ORDER" FROM TODOLIST WHERE ID = ?`, id)
+func (tx *sqlStoreTxn) Restore(ctx context.Context, id string, newOrder int, item *structs.TodoItem) error {
+	var trash structs.TodoItemList
+	err := tx.selectItems(ctx, &trash, `SELECT `+itemsSequence("", "", "").columns+`, DELETED_ORDER FROM TODOLIST
+        WHERE ID = ? AND OWNER = ? AND DELETED_ORDER IS NOT NULL`, id, auth.Principal(ctx))
 	if err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to get the current order of the item: %v", err))
 		return err
 	}
+	if trash.Count == 0 {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s in the trash", id))
+		return NotFoundf("unknown id")
+	}
+	restored := trash.Items[0]
 
-	// newOrder > currentOrder: Get all the items which have Order smaller or equal than the newOrder and
-	// greater or equal than the current Order of the item with the given ID and update their Order to Order-1.
-	// newOrder < currentOrder: Get all the items which have Order greater or equal than the newOrder and
-	// smaller or equal than the current Order of the item with the given ID and update their Order to Order+1.
-
-	var reorderQuery string
-	if newOrder > currentOrder {
-		reorderQuery = `SELECT ID, ITEM, "ORDER" FROM TODOLIST WHERE "ORDER" <= ? AND "ORDER" >= ? ORDER BY "ORDER"`
-	} else {
-		reorderQuery = `SELECT ID, ITEM, "ORDER" FROM TODOLIST WHERE "ORDER" >= ? AND "ORDER" <= ? ORDER BY "ORDER"`
+	// back under its parent, unless that has gone in the meantime, in which
+	// case its old position means nothing
+	parentId := restored.ParentId
+	if parentId != "" {
+		var count int
+		err = tx.txn.GetContext(ctx, &count,
+			tx.txn.Rebind(`SELECT COUNT(*) FROM TODOLIST WHERE ID = ? AND OWNER = ? AND DELETED_AT IS NULL`), parentId, auth.Principal(ctx))
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			parentId = ""
+		}
 	}
 
-	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(reorderQuery), newOrder, currentOrder)
+	ids, err := tx.trashedWith(ctx, id)
 	if err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to get the current Order list of items: %v", err))
 		return err
 	}
-	defer rows.Close()
-
-	err = tx.ReorderItems(ctx, reorderQuery, newOrder, currentOrder)
+	ids = append(ids, id)
+	err = tx.execIn(ctx, "UPDATE TODOLIST SET DELETED_AT = NULL, DELETED_ORDER = NULL WHERE OWNER=? AND ID IN (?)", ids, auth.Principal(ctx))
 	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to restore item %s: %v", id, err))
 		return err
 	}
+	if parentId != restored.ParentId {
+		err = tx.regroup(ctx, id, restored.ListId, parentId)
+		if err != nil {
+			return err
+		}
+	}
 
-	// Update the order value for the specified item
-	_, err = tx.txn.ExecContext(ctx,
-		tx.txn.Rebind(`UPDATE TODOLIST SET "ORDER" = ? WHERE ID = ?`),
-		newOrder,
-		id,
-	)
+	seq := tx.items(ctx, restored.ListId, parentId)
+	if restored.Done && tx.completion == LeaveSequence {
+		// completed items stay out of the sequence
+		if newOrder != 0 {
+			return fmt.Errorf("completed items are not ordered")
+		}
+	} else {
+		var maxOrder int
+		source, args := tx.ranker.source(seq)
+		err = tx.txn.GetContext(ctx, &maxOrder,
+			tx.txn.Rebind(`SELECT COALESCE(MAX("order"), 0) FROM `+source+seq.where()), append(args, seq.args()...)...)
+		if err != nil {
+			return err
+		}
+		order := newOrder
+		if order == 0 && parentId == restored.ParentId && restored.Order > 0 && restored.Order <= maxOrder+1 {
+			// where it was, unless the completion policy no longer allows it
+			if _, err := tx.completionOrder(ctx, seq, id, restored.Done, restored.Order); err == nil {
+				order = restored.Order
+			}
+		}
+		order, err = tx.completionOrder(ctx, seq, id, restored.Done, order)
+		if err != nil {
+			return err
+		}
+		order, err = tx.insertionOrder(ctx, seq, order)
+		if err != nil {
+			return err
+		}
+		err = tx.ranker.attach(ctx, tx, seq, id, order)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.touch(ctx, id, nil)
 	if err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to reorder item: %v", err))
 		return err
 	}
+	return tx.Get(ctx, id, item)
+}
 
-	return nil
+func (tx *sqlStoreTxn) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	for _, ref := range itemReferences {
+		_, err := tx.txn.ExecContext(ctx, tx.txn.Rebind(`DELETE FROM `+ref.table+` WHERE EXISTS (
+            SELECT 1 FROM TODOLIST T WHERE T.OWNER = `+ref.table+`.OWNER AND T.ID = `+ref.table+`.`+ref.column+` AND T.DELETED_AT < ?
+        )`), before.UTC())
+		if err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to purge %s of the trash: %v", ref.table, err))
+			return 0, err
+		}
+	}
+	result, err := tx.txn.ExecContext(ctx, tx.txn.Rebind(`DELETE FROM TODOLIST WHERE DELETED_AT < ?`), before.UTC())
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to purge the trash: %v", err))
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	return int(purged), err
 }
 
-func (tx *sqlStoreTxn) Get(ctx context.Context, id string, item *structs.TodoItem) error {
-	queryStmt := `SELECT ID, ITEM, "ORDER" FROM TODOLIST WHERE ID=?`
+func (tx *sqlStoreTxn) Update(ctx context.Context, record *structs.TodoItem) error {
 
-	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(queryStmt), id)
+	var existing structs.TodoItem
+	err := tx.Get(ctx, record.Id, &existing)
 	if err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to get item with ID %s: %v", id, err))
 		return err
 	}
-	defer rows.Close()
+	// items change lists through MoveItem only, parents through Reparent,
+	// are completed through Complete and tagged through TagItem
+	record.ListId = existing.ListId
+	record.ParentId = existing.ParentId
+	record.Done = existing.Done
+	record.CompletedAt = existing.CompletedAt
+	record.DueAt = utcSeconds(record.DueAt)
+	record.Tags = existing.Tags
+	record.Blocked, record.BlockedBy = existing.Blocked, existing.BlockedBy
+	record.Version, record.CreatedAt, record.UpdatedAt = existing.Version, existing.CreatedAt, existing.UpdatedAt
+	seq := tx.items(ctx, existing.ListId, existing.ParentId)
 
-	if !rows.Next() {
-		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
-		return fmt.Errorf("unknown id")
+	if existing.Order == 0 {
+		// the item has left the sequence, all but its order can change
+		if record.Order != 0 {
+			return fmt.Errorf("completed items are not ordered")
+		}
+		_, err = tx.txn.ExecContext(ctx, tx.txn.Rebind(`UPDATE TODOLIST SET ITEM = ?, NOTES = ?, DUE_AT = ?, PRIORITY = ?, RECURRENCE = ?, TIME_ZONE = ?`+seq.where(`ID = ?`)),
+			seq.args(record.Item, record.Notes, record.DueAt, record.Priority, record.Recurrence, record.TimeZone, record.Id)...)
+		if err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to update item: %v", err))
+			return err
+		}
+		return tx.touch(ctx, record.Id, record)
+	}
+	if record.Order == 0 {
+		// without an order the item stays where it is
+		record.Order = existing.Order
+	}
+	if record.Order != existing.Order {
+		err = tx.moveOrder(ctx, seq, record.Id, existing.Done, record.Order)
+		if err != nil {
+			return err
+		}
 	}
 
-	if err := readRecord(rows, item); err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to read record for ID %s: %v", id, err))
+	// check if the order provided to the new body is already taken by another item
+	orderNeedsChange, err := tx.checkIfOrderExists(ctx, seq, record.Order, record.Id)
+	if err != nil {
 		return err
 	}
+	if orderNeedsChange {
+		// if the order has changed, we need shift again all the items with order
+		// greater than the new order, like we did in the reorder method
+		err := tx.ranker.move(ctx, tx, seq, record.Id, record.Order)
+		if err != nil {
+			return err
+		}
+	}
 
-	return nil
-}
+	rowsAffected, err := tx.ranker.update(ctx, tx, seq, record)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to update item: %v", err))
+		return err
+	}
+	if rowsAffected == 0 {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", record.Id))
+		return NotFoundf("unknown id")
+	}
 
-func (tx *sqlStoreTxn) List(ctx context.Context, items *structs.TodoItemList) error {
-	queryStmt := `SELECT ID, ITEM, "ORDER" FROM TODOLIST`
+	return tx.touch(ctx, record.Id, record)
+}
 
-	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(queryStmt))
+// touch bumps the version of an item after a write to it and sets the time it
+// was last updated, on record as well when it is not nil. Siblings that only
+// move along with the item keep theirs.
+func (tx *sqlStoreTxn) touch(ctx context.Context, id string, record *structs.TodoItem) error {
+	now := writeTime()
+	_, err := tx.txn.ExecContext(ctx, tx.txn.Rebind(`UPDATE TODOLIST SET VERSION = VERSION + 1, UPDATED_AT = ? WHERE ID = ? AND OWNER = ?`),
+		now, id, auth.Principal(ctx))
 	if err != nil {
-		log.Debug().Msg(fmt.Sprintf("Failed to list items: %v", err))
+		log.Debug().Msg(fmt.Sprintf("Failed to bump the version of item %s: %v", id, err))
 		return err
 	}
-	defer rows.Close()
+	if record != nil {
+		record.Version++
+		record.UpdatedAt = &now
+	}
+	return nil
+}
 
-	items.Items = make([]structs.TodoItem, 0)
-	var record structs.TodoItem
-	for rows.Next() {
+func (tx *sqlStoreTxn) Reorder(ctx context.Context, id string, newOrder int) error {
+
+	var listId, parentId string
+	var done bool
+	err := tx.txn.QueryRowxContext(ctx,
+		tx.txn.Rebind(`SELECT LIST_ID, PARENT_ID, DONE FROM TODOLIST WHERE ID = ? AND OWNER = ? AND DELETED_AT IS NULL`), id, auth.Principal(ctx)).Scan(&listId, &parentId, &done)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Debug().Msg(fmt.Sprintf("ID %s does not exist", id))
+			return NotFoundf("ID %s does not exist", id)
+		}
+		log.Debug().Msg(fmt.Sprintf("Failed to check existing ID: %v", err))
+		return err
+	}
+
+	// an item only moves among its siblings, open and completed ones may be
+	// kept apart by the completion policy
+	seq := tx.items(ctx, listId, parentId)
+	err = tx.moveOrder(ctx, seq, id, done, newOrder)
+	if err != nil {
+		return err
+	}
+	err = tx.ranker.move(ctx, tx, seq, id, newOrder)
+	if err != nil {
+		return err
+	}
+	return tx.touch(ctx, id, nil)
+}
+
+func (tx *sqlStoreTxn) MoveItem(ctx context.Context, id string, listId string, newOrder int) error {
+
+	var item structs.TodoItem
+	err := tx.Get(ctx, id, &item)
+	if err != nil {
+		return err
+	}
+	if item.ListId == listId {
+		// within its own list the item stays among its siblings
+		err = tx.relocate(ctx, &item, listId, item.ParentId, newOrder)
+		if err != nil {
+			return err
+		}
+		return tx.touch(ctx, id, nil)
+	}
+	err = tx.checkListId(ctx, listId)
+	if err != nil {
+		return err
+	}
+
+	// the item becomes a top-level item of the other list, its sub-tasks follow it
+	ids, err := tx.descendants(ctx, item.ListId, id)
+	if err != nil {
+		return err
+	}
+	err = tx.relocate(ctx, &item, listId, "", newOrder)
+	if err != nil {
+		return err
+	}
+	err = tx.touch(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	err = tx.execIn(ctx, `UPDATE TODOLIST SET LIST_ID = ?, VERSION = VERSION + 1, UPDATED_AT = ? WHERE OWNER = ? AND ID IN (?)`,
+		ids, listId, writeTime(), auth.Principal(ctx))
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to move the sub-tasks of item %s to list %s: %v", id, listId, err))
+	}
+	return err
+}
+
+func (tx *sqlStoreTxn) Reparent(ctx context.Context, id string, parentId string, newOrder int) error {
+
+	var item structs.TodoItem
+	err := tx.Get(ctx, id, &item)
+	if err != nil {
+		return err
+	}
+	err = tx.checkParent(ctx, item.ListId, parentId)
+	if err != nil {
+		return err
+	}
+	if parentId == id {
+		return fmt.Errorf("an item cannot be moved under itself or its sub-tasks")
+	}
+	if parentId != "" {
+		ids, err := tx.descendants(ctx, item.ListId, id)
+		if err != nil {
+			return err
+		}
+		for _, descendant := range ids {
+			if descendant == parentId {
+				return fmt.Errorf("an item cannot be moved under itself or its sub-tasks")
+			}
+		}
+	}
+	err = tx.relocate(ctx, &item, item.ListId, parentId, newOrder)
+	if err != nil {
+		return err
+	}
+	return tx.touch(ctx, id, nil)
+}
+
+// relocate moves an item to newOrder among the sub-tasks of parentId in a
+// list, or to their end when newOrder is 0. The gap it leaves among its former
+// siblings is closed.
+func (tx *sqlStoreTxn) relocate(ctx context.Context, item *structs.TodoItem, listId, parentId string, newOrder int) error {
+	from, to := tx.items(ctx, item.ListId, item.ParentId), tx.items(ctx, listId, parentId)
+	if item.Order == 0 {
+		// the item has left the sequence, so it has no position in either group
+		if newOrder != 0 {
+			return fmt.Errorf("completed items are not ordered")
+		}
+		return tx.regroup(ctx, item.Id, listId, parentId)
+	}
+	newOrder, err := tx.completionOrder(ctx, to, item.Id, item.Done, newOrder)
+	if err != nil {
+		return err
+	}
+	if item.ListId == listId && item.ParentId == parentId {
+		if newOrder == 0 {
+			// to the end of its own siblings
+			source, args := tx.ranker.source(from)
+			err = tx.txn.GetContext(ctx, &newOrder,
+				tx.txn.Rebind(`SELECT MAX("order") FROM `+source+from.where()), append(args, from.args()...)...)
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.moveOrder(ctx, from, item.Id, item.Done, newOrder); err != nil {
+			return err
+		}
+		return tx.ranker.move(ctx, tx, from, item.Id, newOrder)
+	}
+
+	// take the item out of its siblings and close the gap it leaves there
+	err = tx.takeOut(ctx, from, item.Id, item.Order)
+	if err != nil {
+		return err
+	}
+
+	// then make room for it among the new ones
+	newOrder, err = tx.insertionOrder(ctx, to, newOrder)
+	if err != nil {
+		return err
+	}
+	err = tx.regroup(ctx, item.Id, listId, parentId)
+	if err != nil {
+		return err
+	}
+	return tx.ranker.attach(ctx, tx, to, item.Id, newOrder)
+}
+
+// regroup sets the list and the parent of an item.
+func (tx *sqlStoreTxn) regroup(ctx context.Context, id, listId, parentId string) error {
+	_, err := tx.txn.ExecContext(ctx, tx.txn.Rebind(`UPDATE TODOLIST SET LIST_ID = ?, PARENT_ID = ? WHERE ID = ? AND OWNER = ?`),
+		listId, parentId, id, auth.Principal(ctx))
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to move item %s to list %s: %v", id, listId, err))
+	}
+	return err
+}
+
+func (tx *sqlStoreTxn) Get(ctx context.Context, id string, item *structs.TodoItem) error {
+	// the position is the one among the item's siblings, whatever they are
+	seqs := itemsSequences(auth.Principal(ctx))
+	source, args := tx.ranker.source(seqs)
+	queryStmt := `SELECT ` + seqs.columns + `, "order" FROM ` + source + ` WHERE ID=? AND OWNER=? AND DELETED_AT IS NULL`
+
+	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(queryStmt), append(args, id, auth.Principal(ctx))...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get item with ID %s: %v", id, err))
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		log.Debug().Msg(fmt.Sprintf("Unknown ID %s", id))
+		return NotFoundf("unknown id")
+	}
+
+	if err := readRecord(rows, item); err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to read record for ID %s: %v", id, err))
+		return err
+	}
+	// the connection takes one query at a time
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	if err := tx.withTags(ctx, item); err != nil {
+		return err
+	}
+	return tx.withBlockers(ctx, item)
+}
+
+func (tx *sqlStoreTxn) Complete(ctx context.Context, id string, done bool, item *structs.TodoItem) error {
+	var existing structs.TodoItem
+	err := tx.Get(ctx, id, &existing)
+	if err != nil {
+		return err
+	}
+	if existing.Done == done {
+		*item = existing
+		return nil
+	}
+
+	// the item is placed among its siblings while it is still counted as it was
+	seq := tx.items(ctx, existing.ListId, existing.ParentId)
+	switch {
+	case !done && existing.Order == 0:
+		// back into the sequence, at the end of the open items
+		order, err := tx.completionOrder(ctx, seq, id, false, 0)
+		if err != nil {
+			return err
+		}
+		order, err = tx.insertionOrder(ctx, seq, order)
+		if err != nil {
+			return err
+		}
+		err = tx.ranker.attach(ctx, tx, seq, id, order)
+		if err != nil {
+			return err
+		}
+	case tx.completion == SinkToBottom:
+		order, err := tx.completionOrder(ctx, seq, id, done, 0)
+		if err != nil {
+			return err
+		}
+		err = tx.ranker.move(ctx, tx, seq, id, order)
+		if err != nil {
+			return err
+		}
+	case tx.completion == LeaveSequence && done:
+		err = tx.takeOut(ctx, seq, id, existing.Order)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := tx.clock().UTC()
+	var completedAt *time.Time
+	if done {
+		completedAt = &now
+	}
+	_, err = tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`UPDATE TODOLIST SET DONE = ?, COMPLETED_AT = ?`+seq.where(`ID = ?`)), seq.args(done, completedAt, id)...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to complete item %s: %v", id, err))
+		return err
+	}
+	err = tx.touch(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+
+	var next *structs.TodoItem
+	if done {
+		next, err = tx.addNextOccurrence(ctx, existing, now)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Get(ctx, id, item)
+	if next != nil {
+		item.NextId = next.Id
+	}
+	return err
+}
+
+// addNextOccurrence adds the item that follows a recurring item completed at
+// now, with its tags, and returns it. It returns nil for items that do not
+// recur, see nextOccurrence.
+func (tx *sqlStoreTxn) addNextOccurrence(ctx context.Context, completed structs.TodoItem, now time.Time) (*structs.TodoItem, error) {
+	next, err := nextOccurrence(completed, now)
+	if err != nil || next == nil {
+		return nil, err
+	}
+	tags := next.Tags
+	next.Order = recurrenceOrder(tx.completion, completed.Order)
+	err = tx.Add(ctx, next)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		_, err = tx.txn.ExecContext(ctx,
+			tx.txn.Rebind(`INSERT INTO ITEM_TAGS(OWNER, ITEM_ID, TAG) VALUES(?, ?, ?)`), auth.Principal(ctx), next.Id, tag)
+		if err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to tag item %s: %v", next.Id, err))
+			return nil, err
+		}
+	}
+	next.Tags = tags
+	return next, nil
+}
+
+func (tx *sqlStoreTxn) TagItem(ctx context.Context, id string, tag string) error {
+	if err := tx.CheckId(ctx, id); err != nil {
+		return err
+	}
+	result, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`INSERT INTO ITEM_TAGS(OWNER, ITEM_ID, TAG) VALUES(?, ?, ?) ON CONFLICT DO NOTHING`), auth.Principal(ctx), id, tag)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to tag item %s: %v", id, err))
+		return err
+	}
+	return tx.touchIfAffected(ctx, id, result)
+}
+
+func (tx *sqlStoreTxn) UntagItem(ctx context.Context, id string, tag string) error {
+	if err := tx.CheckId(ctx, id); err != nil {
+		return err
+	}
+	result, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`DELETE FROM ITEM_TAGS WHERE OWNER = ? AND ITEM_ID = ? AND TAG = ?`), auth.Principal(ctx), id, tag)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to untag item %s: %v", id, err))
+		return err
+	}
+	return tx.touchIfAffected(ctx, id, result)
+}
+
+// touchIfAffected bumps the version of an item when the statement changed
+// anything, so that tagging an item twice is not a write to it.
+func (tx *sqlStoreTxn) touchIfAffected(ctx context.Context, id string, result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return nil
+	}
+	return tx.touch(ctx, id, nil)
+}
+
+func (tx *sqlStoreTxn) ListTags(ctx context.Context, tags *structs.Tags) error {
+	rows, err := tx.txn.QueryContext(ctx,
+		tx.txn.Rebind(`SELECT TAG, COUNT(*) FROM ITEM_TAGS WHERE OWNER = ? AND ITEM_ID IN (SELECT ID FROM TODOLIST WHERE OWNER = ? AND DELETED_AT IS NULL)
+            GROUP BY TAG ORDER BY TAG`), auth.Principal(ctx), auth.Principal(ctx))
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to list tags: %v", err))
+		return err
+	}
+	defer rows.Close()
+
+	tags.Items = make([]structs.Tag, 0)
+	tags.Count = 0
+	var tag structs.Tag
+	for rows.Next() {
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to read tag: %v", err))
+			return err
+		}
+		tags.Items = append(tags.Items, tag)
+		tags.Count++
+	}
+	return rows.Err()
+}
+
+func (tx *sqlStoreTxn) AddBlocker(ctx context.Context, id string, blockerId string) error {
+	if id == blockerId {
+		return fmt.Errorf("an item cannot block itself")
+	}
+	if err := tx.CheckId(ctx, id); err != nil {
+		return err
+	}
+	if err := tx.CheckId(ctx, blockerId); err != nil {
+		return err
+	}
+
+	// the blocker must not wait for the item, however indirectly, the items
+	// in the trash included since they can come back
+	var cycles int
+	err := tx.txn.GetContext(ctx, &cycles, tx.txn.Rebind(`WITH RECURSIVE BLOCKERS(ID) AS (
+            SELECT BLOCKER_ID FROM ITEM_BLOCKERS WHERE OWNER = ? AND ITEM_ID = ?
+            UNION
+            SELECT B.BLOCKER_ID FROM ITEM_BLOCKERS B JOIN BLOCKERS ON B.ITEM_ID = BLOCKERS.ID WHERE B.OWNER = ?
+        ) SELECT COUNT(*) FROM BLOCKERS WHERE ID = ?`), auth.Principal(ctx), blockerId, auth.Principal(ctx), id)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get the blockers of item %s: %v", blockerId, err))
+		return err
+	}
+	if cycles > 0 {
+		return fmt.Errorf("item %s waits for item %s already", blockerId, id)
+	}
+
+	result, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`INSERT INTO ITEM_BLOCKERS(OWNER, ITEM_ID, BLOCKER_ID) VALUES(?, ?, ?) ON CONFLICT DO NOTHING`), auth.Principal(ctx), id, blockerId)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to block item %s: %v", id, err))
+		return err
+	}
+	return tx.touchIfAffected(ctx, id, result)
+}
+
+func (tx *sqlStoreTxn) RemoveBlocker(ctx context.Context, id string, blockerId string) error {
+	if err := tx.CheckId(ctx, id); err != nil {
+		return err
+	}
+	result, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`DELETE FROM ITEM_BLOCKERS WHERE OWNER = ? AND ITEM_ID = ? AND BLOCKER_ID = ?`), auth.Principal(ctx), id, blockerId)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to unblock item %s: %v", id, err))
+		return err
+	}
+	return tx.touchIfAffected(ctx, id, result)
+}
+
+func (tx *sqlStoreTxn) MoveRelative(ctx context.Context, id string, move structs.RelativeMove) error {
+	return moveRelative(ctx, tx, tx.completion, id, move)
+}
+
+func (tx *sqlStoreTxn) Arrange(ctx context.Context, listId string, parentId string, ids []string) error {
+	return arrange(ctx, tx, listId, parentId, ids)
+}
+
+func (tx *sqlStoreTxn) arrangeSiblings(ctx context.Context, listId string, parentId string, current []string, wanted []string) error {
+	return tx.ranker.arrange(ctx, tx, tx.items(ctx, listId, parentId), current, wanted)
+}
+
+func (tx *sqlStoreTxn) SortByBlockers(ctx context.Context, listId string) error {
+	return sortByBlockers(ctx, tx, listId)
+}
+
+const attachmentColumns = "ID, ITEM_ID, NAME, CONTENT_TYPE, SIZE, DIGEST, CREATED_AT"
+
+func readAttachment(rows *sql.Rows, attachment *structs.Attachment) error {
+	var createdAt time.Time
+	err := rows.Scan(
+		&attachment.Id,
+		&attachment.ItemId,
+		&attachment.Name,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.Digest,
+		&createdAt,
+	)
+	attachment.CreatedAt = &createdAt
+	return err
+}
+
+func (tx *sqlStoreTxn) AddAttachment(ctx context.Context, attachment *structs.Attachment) error {
+	if err := tx.CheckId(ctx, attachment.ItemId); err != nil {
+		return err
+	}
+	createdAt := writeTime()
+	attachment.Id = uuid.New().String()
+	attachment.CreatedAt = &createdAt
+	_, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`INSERT INTO ATTACHMENTS(OWNER, `+attachmentColumns+`) VALUES(?, ?, ?, ?, ?, ?, ?, ?)`),
+		auth.Principal(ctx), attachment.Id, attachment.ItemId, attachment.Name, attachment.ContentType, attachment.Size, attachment.Digest, createdAt)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to attach a file to item %s: %v", attachment.ItemId, err))
+	}
+	return err
+}
+
+func (tx *sqlStoreTxn) ListAttachments(ctx context.Context, itemId string, attachments *structs.Attachments) error {
+	if err := tx.CheckId(ctx, itemId); err != nil {
+		return err
+	}
+	rows, err := tx.txn.QueryContext(ctx,
+		tx.txn.Rebind(`SELECT `+attachmentColumns+` FROM ATTACHMENTS WHERE OWNER = ? AND ITEM_ID = ? ORDER BY CREATED_AT, ID`), auth.Principal(ctx), itemId)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to list the attachments of item %s: %v", itemId, err))
+		return err
+	}
+	defer rows.Close()
+
+	attachments.Items = make([]structs.Attachment, 0)
+	attachments.Count = 0
+	for rows.Next() {
+		var attachment structs.Attachment
+		if err := readAttachment(rows, &attachment); err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to read attachment: %v", err))
+			return err
+		}
+		attachments.Items = append(attachments.Items, attachment)
+		attachments.Count++
+	}
+	return rows.Err()
+}
+
+func (tx *sqlStoreTxn) GetAttachment(ctx context.Context, itemId string, id string, attachment *structs.Attachment) error {
+	if err := tx.CheckId(ctx, itemId); err != nil {
+		return err
+	}
+	rows, err := tx.txn.QueryContext(ctx,
+		tx.txn.Rebind(`SELECT `+attachmentColumns+` FROM ATTACHMENTS WHERE OWNER = ? AND ITEM_ID = ? AND ID = ?`), auth.Principal(ctx), itemId, id)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get attachment %s: %v", id, err))
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		log.Debug().Msg(fmt.Sprintf("Unknown attachment ID %s", id))
+		return NotFoundf("unknown attachment id")
+	}
+	return readAttachment(rows, attachment)
+}
+
+func (tx *sqlStoreTxn) DeleteAttachment(ctx context.Context, itemId string, id string) error {
+	if err := tx.CheckId(ctx, itemId); err != nil {
+		return err
+	}
+	result, err := tx.txn.ExecContext(ctx,
+		tx.txn.Rebind(`DELETE FROM ATTACHMENTS WHERE OWNER = ? AND ITEM_ID = ? AND ID = ?`), auth.Principal(ctx), itemId, id)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to delete attachment %s: %v", id, err))
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		log.Debug().Msg(fmt.Sprintf("Unknown attachment ID %s", id))
+		return NotFoundf("unknown attachment id")
+	}
+	return nil
+}
+
+func (tx *sqlStoreTxn) AttachmentsSize(ctx context.Context) (int64, error) {
+	var size int64
+	err := tx.txn.GetContext(ctx, &size,
+		tx.txn.Rebind(`SELECT COALESCE(SUM(SIZE), 0) FROM ATTACHMENTS WHERE OWNER = ?`), auth.Principal(ctx))
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to sum the size of the attachments: %v", err))
+	}
+	return size, err
+}
+
+func (tx *sqlStoreTxn) AttachmentDigests(ctx context.Context) (map[string]bool, error) {
+	var digests []string
+	err := tx.txn.SelectContext(ctx, &digests, `SELECT DISTINCT DIGEST FROM ATTACHMENTS`)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to list the digests of the attachments: %v", err))
+		return nil, err
+	}
+	used := make(map[string]bool, len(digests))
+	for _, digest := range digests {
+		used[digest] = true
+	}
+	return used, nil
+}
+
+func (tx *sqlStoreTxn) List(ctx context.Context, listId string, query structs.ItemQuery, items *structs.TodoItemList) error {
+	err := tx.checkListId(ctx, listId)
+	if err != nil {
+		return err
+	}
+
+	// every filter goes through an index
+	var conditions []string
+	var args []interface{}
+	if query.DueBefore != nil {
+		conditions = append(conditions, "DUE_AT < ?")
+		args = append(args, query.DueBefore.UTC())
+	}
+	if query.Overdue {
+		conditions = append(conditions, "DUE_AT < ? AND NOT DONE")
+		args = append(args, tx.clock().UTC())
+	}
+	if query.Priority != "" {
+		conditions = append(conditions, "PRIORITY = ?")
+		args = append(args, query.Priority)
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, "ID IN (SELECT ITEM_ID FROM ITEM_TAGS WHERE OWNER = ? AND TAG = ?)")
+		args = append(args, auth.Principal(ctx), query.Tag)
+	}
+
+	// the sub-tasks are listed along with the top-level items, the trash is not
+	conditions = append([]string{"OWNER = ?", "LIST_ID = ?", "DELETED_AT IS NULL"}, conditions...)
+	args = append([]interface{}{auth.Principal(ctx), listId}, args...)
+
+	// pages go by parent, by order with the items without one last, and by id
+	var total int
+	paged := query.Limit > 0 || query.Cursor != nil
+	if paged {
+		err = tx.txn.GetContext(ctx, &total, tx.txn.Rebind(`SELECT COUNT(*) FROM TODOLIST WHERE `+strings.Join(conditions, " AND ")), args...)
+		if err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to count items: %v", err))
+			return err
+		}
+	}
+	orderBy := ` ORDER BY PARENT_ID, "order" IS NULL, "order", ID`
+	if cursor := query.Cursor; cursor != nil {
+		condition, conditionArgs := pastCursorCondition(*cursor)
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+		if cursor.Backward {
+			orderBy = ` ORDER BY PARENT_ID DESC, "order" IS NULL DESC, "order" DESC, ID DESC`
+		}
+	}
+	if query.Limit > 0 {
+		// one more tells whether there is a next page
+		orderBy += ` LIMIT ?`
+		args = append(args, query.Limit+1)
+	}
+
+	// the positions are those among the siblings of each item in the list
+	seqs := itemsSequences(auth.Principal(ctx), listId)
+	source, sourceArgs := tx.ranker.source(seqs)
+	var rows structs.TodoItemList
+	err = tx.selectItems(ctx, &rows, `SELECT `+seqs.columns+`, "order" FROM `+source+
+		` WHERE `+strings.Join(conditions, " AND ")+orderBy, append(sourceArgs, args...)...)
+	if err != nil {
+		return err
+	}
+	if !paged {
+		total = rows.Count
+	}
+	paginate(rows.Items, query, total, items)
+	return nil
+}
+
+func (tx *sqlStoreTxn) Siblings(ctx context.Context, listId string, parentId string, items *structs.TodoItemList) error {
+	if err := tx.checkListId(ctx, listId); err != nil {
+		return err
+	}
+	seq := tx.items(ctx, listId, parentId)
+	source, args := tx.ranker.source(seq)
+	return tx.readItems(ctx, items,
+		`SELECT `+seq.columns+`, "order" FROM `+source+seq.where(`"order" IS NOT NULL`, `DELETED_AT IS NULL`)+` ORDER BY "order"`,
+		append(args, seq.args()...)...)
+}
+
+// selectItems reads the items of a query along with their tags and blockers.
+func (tx *sqlStoreTxn) selectItems(ctx context.Context, items *structs.TodoItemList, queryStmt string, args ...interface{}) error {
+	if err := tx.readItems(ctx, items, queryStmt, args...); err != nil {
+		return err
+	}
+	records := make([]*structs.TodoItem, 0, items.Count)
+	for i := range items.Items {
+		records = append(records, &items.Items[i])
+	}
+	if err := tx.withTags(ctx, records...); err != nil {
+		return err
+	}
+	return tx.withBlockers(ctx, records...)
+}
+
+// readItems reads the items of a query without their tags and blockers.
+func (tx *sqlStoreTxn) readItems(ctx context.Context, items *structs.TodoItemList, queryStmt string, args ...interface{}) error {
+	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(queryStmt), args...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to list items: %v", err))
+		return err
+	}
+	defer rows.Close()
+
+	items.Items = make([]structs.TodoItem, 0)
+	items.Count = 0
+	var record structs.TodoItem
+	for rows.Next() {
 		if err := readRecord(rows, &record); err != nil {
 			log.Debug().Msg(fmt.Sprintf("Failed to read record: %v", err))
 			return err
@@ -331,5 +1473,278 @@ func (tx *sqlStoreTxn) List(ctx context.Context, items *structs.TodoItemList) er
 		items.Items = append(items.Items, record)
 		items.Count++
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// the connection takes one query at a time
+	return rows.Close()
+}
+
+// withBlockers reads the blockers of items owned by the principal in ctx,
+// leaving out those in the trash.
+func (tx *sqlStoreTxn) withBlockers(ctx context.Context, items ...*structs.TodoItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	byId := make(map[string]*structs.TodoItem, len(items))
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		byId[item.Id] = item
+		ids = append(ids, item.Id)
+	}
+	for _, chunk := range chunkIds(ids) {
+		if err := tx.blockersOf(ctx, chunk, byId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockersOf adds the blockers of the items with ids to those of byId.
+func (tx *sqlStoreTxn) blockersOf(ctx context.Context, ids []string, byId map[string]*structs.TodoItem) error {
+	queryStmt, args, err := sqlx.In(`SELECT B.ITEM_ID, B.BLOCKER_ID, T.DONE FROM ITEM_BLOCKERS B JOIN TODOLIST T ON T.OWNER = B.OWNER AND T.ID = B.BLOCKER_ID
+        WHERE B.OWNER = ? AND B.ITEM_ID IN (?) AND T.DELETED_AT IS NULL ORDER BY B.BLOCKER_ID`, auth.Principal(ctx), ids)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(queryStmt), args...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get the blockers of items: %v", err))
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, blockerId string
+		var done bool
+		if err := rows.Scan(&id, &blockerId, &done); err != nil {
+			return err
+		}
+		// an id that does not match any of the items is left alone
+		item, ok := byId[id]
+		if !ok {
+			continue
+		}
+		item.BlockedBy = append(item.BlockedBy, blockerId)
+		item.Blocked = item.Blocked || !done
+	}
+	return rows.Err()
+}
+
+// withTags reads the tags of items owned by the principal in ctx.
+func (tx *sqlStoreTxn) withTags(ctx context.Context, items ...*structs.TodoItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	byId := make(map[string]*structs.TodoItem, len(items))
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		byId[item.Id] = item
+		ids = append(ids, item.Id)
+	}
+	for _, chunk := range chunkIds(ids) {
+		if err := tx.tagsOf(ctx, chunk, byId); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// tagsOf adds the tags of the items with ids to those of byId.
+func (tx *sqlStoreTxn) tagsOf(ctx context.Context, ids []string, byId map[string]*structs.TodoItem) error {
+	queryStmt, args, err := sqlx.In(`SELECT ITEM_ID, TAG FROM ITEM_TAGS WHERE OWNER = ? AND ITEM_ID IN (?) ORDER BY TAG`, auth.Principal(ctx), ids)
+	if err != nil {
+		return err
+	}
+	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(queryStmt), args...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get the tags of items: %v", err))
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		// an id that does not match any of the items is left alone
+		item, ok := byId[id]
+		if !ok {
+			continue
+		}
+		item.Tags = append(item.Tags, tag)
+	}
+	return rows.Err()
+}
+
+func (tx *sqlStoreTxn) AddList(ctx context.Context, list *structs.List) error {
+	// Generate a UUID if the ID is empty
+	if list.Id == "" {
+		list.Id = uuid.New().String()
+	}
+
+	seq := tx.lists(ctx)
+	var err error
+	list.Order, err = tx.insertionOrder(ctx, seq, list.Order)
+	if err != nil {
+		return err
+	}
+
+	err = tx.ranker.insert(ctx, tx, seq, list.Order, "OWNER, "+seq.columns, auth.Principal(ctx), list.Id, list.Name)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to add list: %v", err))
+	}
+	return err
+}
+
+func (tx *sqlStoreTxn) DeleteList(ctx context.Context, id string, shifted *structs.Lists) error {
+	if id == DefaultListId {
+		return fmt.Errorf("the default list cannot be deleted")
+	}
+
+	var deleted structs.List
+	err := tx.GetList(ctx, id, &deleted)
+	if err != nil {
+		return err
+	}
+
+	// every list after the deleted one moves up by one to close the gap
+	seq := tx.lists(ctx)
+	source, args := tx.ranker.source(seq)
+	err = tx.selectLists(ctx, shifted,
+		`SELECT `+seq.columns+`, "order" FROM `+source+seq.where(`"order" > ?`)+` ORDER BY "order"`,
+		append(args, seq.args(deleted.Order)...)...)
+	if err != nil {
+		return err
+	}
+
+	// the items go with their list
+	for _, ref := range itemReferences {
+		_, err = tx.txn.ExecContext(ctx, tx.txn.Rebind("DELETE FROM "+ref.table+" WHERE OWNER=? AND "+ref.column+" IN (SELECT ID FROM TODOLIST WHERE LIST_ID=? AND OWNER=?)"),
+			auth.Principal(ctx), id, auth.Principal(ctx))
+		if err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to delete %s of the items of list %s: %v", ref.table, id, err))
+			return err
+		}
+	}
+	_, err = tx.txn.ExecContext(ctx, tx.txn.Rebind("DELETE FROM TODOLIST WHERE LIST_ID=? AND OWNER=?"), id, auth.Principal(ctx))
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to delete the items of list %s: %v", id, err))
+		return err
+	}
+	_, err = tx.txn.ExecContext(ctx, tx.txn.Rebind("DELETE FROM LISTS"+seq.where("ID=?")), seq.args(id)...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to delete list with ID %s: %v", id, err))
+		return err
+	}
+
+	if shifted.Count > 0 {
+		err = tx.ranker.closeGap(ctx, tx, seq, deleted.Order+1, shifted.Items[shifted.Count-1].Order)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range shifted.Items {
+		shifted.Items[i].Order--
+	}
+	return nil
+}
+
+func (tx *sqlStoreTxn) UpdateList(ctx context.Context, list *structs.List) error {
+	seq := tx.lists(ctx)
+	result, err := tx.txn.ExecContext(ctx, tx.txn.Rebind(`UPDATE LISTS SET NAME = ?`+seq.where(`ID = ?`)), seq.args(list.Name, list.Id)...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to update list: %v", err))
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		log.Debug().Msg(fmt.Sprintf("Unknown list ID %s", list.Id))
+		return NotFoundf("unknown list id")
+	}
+
+	// without an order the list stays where it is
+	if list.Order == 0 {
+		return nil
+	}
+	return tx.ReorderList(ctx, list.Id, list.Order)
+}
+
+func (tx *sqlStoreTxn) ReorderList(ctx context.Context, id string, newOrder int) error {
+	err := tx.checkListId(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	seq := tx.lists(ctx)
+	var count int
+	err = tx.txn.GetContext(ctx, &count, tx.txn.Rebind(`SELECT COUNT(*) FROM LISTS`+seq.where()), seq.args()...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to get the count of lists: %v", err))
+		return err
+	}
+	if newOrder < 1 || newOrder > count {
+		return fmt.Errorf("order should be between 1 and %d and you provided %d", count, newOrder)
+	}
+
+	return tx.ranker.move(ctx, tx, seq, id, newOrder)
+}
+
+func (tx *sqlStoreTxn) GetList(ctx context.Context, id string, list *structs.List) error {
+	if id == DefaultListId {
+		if err := tx.checkListId(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	seq := tx.lists(ctx)
+	var lists structs.Lists
+	source, args := tx.ranker.source(seq)
+	err := tx.selectLists(ctx, &lists, `SELECT `+seq.columns+`, "order" FROM `+source+seq.where(`ID=?`), append(args, seq.args(id)...)...)
+	if err != nil {
+		return err
+	}
+	if lists.Count == 0 {
+		log.Debug().Msg(fmt.Sprintf("Unknown list ID %s", id))
+		return NotFoundf("unknown list id")
+	}
+	*list = lists.Items[0]
+	return nil
+}
+
+func (tx *sqlStoreTxn) ListLists(ctx context.Context, lists *structs.Lists) error {
+	// every user has the default list, even before they have used it
+	err := tx.checkListId(ctx, DefaultListId)
+	if err != nil {
+		return err
+	}
+	seq := tx.lists(ctx)
+	source, args := tx.ranker.source(seq)
+	return tx.selectLists(ctx, lists, `SELECT `+seq.columns+`, "order" FROM `+source+seq.where()+` ORDER BY "order"`, append(args, seq.args()...)...)
+}
+
+func (tx *sqlStoreTxn) selectLists(ctx context.Context, lists *structs.Lists, queryStmt string, args ...interface{}) error {
+	rows, err := tx.txn.QueryContext(ctx, tx.txn.Rebind(queryStmt), args...)
+	if err != nil {
+		log.Debug().Msg(fmt.Sprintf("Failed to list lists: %v", err))
+		return err
+	}
+	defer rows.Close()
+
+	lists.Items = make([]structs.List, 0)
+	lists.Count = 0
+	var list structs.List
+	for rows.Next() {
+		if err := readList(rows, &list); err != nil {
+			log.Debug().Msg(fmt.Sprintf("Failed to read list: %v", err))
+			return err
+		}
+		lists.Items = append(lists.Items, list)
+		lists.Count++
+	}
+	return rows.Err()
+}
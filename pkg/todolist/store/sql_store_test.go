@@ -3,12 +3,17 @@ package store
 import (
 	"context"
 	"database/sql"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.altair.com/todolist/pkg/auth"
 	"go.altair.com/todolist/pkg/structs"
 )
 
@@ -21,6 +26,45 @@ func setupMockDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
 	return sqlxDB, mock
 }
 
+func itemRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"ID", "LIST_ID", "PARENT_ID", "ITEM", "NOTES", "DONE", "COMPLETED_AT", "DUE_AT", "PRIORITY", "RECURRENCE", "TIME_ZONE", "VERSION", "CREATED_AT", "UPDATED_AT", "DELETED_AT", "order"})
+}
+
+// expectNotTrashed expects the id of a new item to be looked up in the trash,
+// where it is not.
+func expectNotTrashed(mock sqlmock.Sqlmock, id string) {
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM TODOLIST WHERE ID = \? AND OWNER = \? AND DELETED_AT IS NOT NULL`).WithArgs(id, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+}
+
+// expectNoTags expects the items that were just read to have their tags read,
+// which they have none of.
+func expectNoTags(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT ITEM_ID, TAG FROM ITEM_TAGS WHERE OWNER = \? AND ITEM_ID IN \(.*\) ORDER BY TAG`).WillReturnRows(sqlmock.NewRows([]string{"ITEM_ID", "TAG"}))
+}
+
+// expectNoBlockers expects the blockers of items to be looked up, which they
+// have none of.
+func expectNoBlockers(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(`SELECT B.ITEM_ID, B.BLOCKER_ID, T.DONE FROM ITEM_BLOCKERS B`).WillReturnRows(sqlmock.NewRows([]string{"ITEM_ID", "BLOCKER_ID", "DONE"}))
+}
+
+// expectNoSubtasks expects the sub-tasks of an item of the default list to be
+// looked up, which it has none of.
+func expectNoSubtasks(mock sqlmock.Sqlmock, id string) {
+	mock.ExpectQuery(`WITH RECURSIVE DESCENDANTS`).WithArgs(auth.Anonymous, DefaultListId, id, auth.Anonymous, DefaultListId).WillReturnRows(sqlmock.NewRows([]string{"ID"}))
+}
+
+// expectTouch expects the version of an item to be bumped.
+func expectTouch(mock sqlmock.Sqlmock, id string) {
+	mock.ExpectExec(`UPDATE TODOLIST SET VERSION = VERSION \+ 1, UPDATED_AT = \? WHERE ID = \? AND OWNER = \?`).WithArgs(sqlmock.AnyArg(), id, auth.Anonymous).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectCountOrdered expects the siblings of the top-level item id to be
+// counted, all of them open.
+func expectCountOrdered(mock sqlmock.Sqlmock, id string, siblings int) {
+	mock.ExpectQuery(`SELECT COUNT\(CASE WHEN NOT DONE THEN "order" END\), COUNT\("order"\) FROM TODOLIST WHERE ID != \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(id, auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"open", "ordered"}).AddRow(siblings, siblings))
+}
+
 func TestDelete(t *testing.T) {
 	db, mock := setupMockDB(t)
 	defer db.Close()
@@ -29,16 +73,72 @@ func TestDelete(t *testing.T) {
 	ctx := context.Background()
 	id := uuid.New().String()
 
-	mock.ExpectBegin()
-	mock.ExpectExec(`DELETE FROM TODOLIST WHERE ID=\?`).WithArgs(id).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectCommit()
+	t.Run("Delete closes the gap", func(t *testing.T) {
+		shiftedId := uuid.New().String()
 
-	err := store.Update(func(tx Txn) error {
-		return tx.Delete(ctx, id)
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE ID=\? AND OWNER=\?`).WithArgs(id, auth.Anonymous).WillReturnRows(itemRows().AddRow(id, DefaultListId, "", "panos", "", false, nil, nil, "", "", "", 1, nil, nil, nil, 2))
+		expectNoTags(mock)
+		expectNoBlockers(mock)
+		mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE "order" > \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \? ORDER BY "order"`).WithArgs(2, auth.Anonymous, DefaultListId, "").WillReturnRows(itemRows().AddRow(shiftedId, DefaultListId, "", "geo", "", false, nil, nil, "", "", "", 1, nil, nil, nil, 3))
+		expectNoTags(mock)
+		expectNoBlockers(mock)
+		expectNoSubtasks(mock, id)
+		mock.ExpectExec(`UPDATE TODOLIST SET DELETED_AT = \? WHERE OWNER=\? AND ID IN \(\?\) AND DELETED_AT IS NULL`).WithArgs(sqlmock.AnyArg(), auth.Anonymous, id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE TODOLIST SET DELETED_ORDER = \? WHERE ID=\? AND OWNER=\?`).WithArgs(2, id, auth.Anonymous).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTouch(mock, id)
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = NULL WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(id, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = -\("order" \+ \?\) WHERE "order" BETWEEN \? AND \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(-1, 3, 3, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = -"order" WHERE "order" < 0 AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		var shifted structs.TodoItemList
+		err := store.Update(func(tx Txn) error {
+			return tx.Delete(ctx, id, &shifted)
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, shifted.Count)
+		assert.Equal(t, structs.TodoItem{Id: shiftedId, ListId: DefaultListId, Item: "geo", Order: 2, Version: 1}, shifted.Items[0])
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
-	assert.NoError(t, err)
-	assert.NoError(t, mock.ExpectationsWereMet())
+	t.Run("Delete the last item", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE ID=\? AND OWNER=\?`).WithArgs(id, auth.Anonymous).WillReturnRows(itemRows().AddRow(id, DefaultListId, "", "panos", "", false, nil, nil, "", "", "", 1, nil, nil, nil, 3))
+		expectNoTags(mock)
+		expectNoBlockers(mock)
+		mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE "order" > \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \? ORDER BY "order"`).WithArgs(3, auth.Anonymous, DefaultListId, "").WillReturnRows(itemRows())
+		expectNoSubtasks(mock, id)
+		mock.ExpectExec(`UPDATE TODOLIST SET DELETED_AT = \? WHERE OWNER=\? AND ID IN \(\?\) AND DELETED_AT IS NULL`).WithArgs(sqlmock.AnyArg(), auth.Anonymous, id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE TODOLIST SET DELETED_ORDER = \? WHERE ID=\? AND OWNER=\?`).WithArgs(3, id, auth.Anonymous).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTouch(mock, id)
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = NULL WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(id, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		var shifted structs.TodoItemList
+		err := store.Update(func(tx Txn) error {
+			return tx.Delete(ctx, id, &shifted)
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, shifted.Count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown ID", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE ID=\? AND OWNER=\?`).WithArgs(id, auth.Anonymous).WillReturnRows(itemRows())
+		mock.ExpectRollback()
+
+		var shifted structs.TodoItemList
+		err := store.Update(func(tx Txn) error {
+			return tx.Delete(ctx, id, &shifted)
+		})
+
+		assert.EqualError(t, err, "unknown id")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
 
 func TestUpdate(t *testing.T) {
@@ -55,8 +155,12 @@ func TestUpdate(t *testing.T) {
 	}
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SELECT "ORDER" FROM TODOLIST WHERE "ORDER" = \? AND ID != \? LIMIT 1`).WithArgs(todoItem.Order, todoItem.Id).WillReturnRows(sqlmock.NewRows([]string{"ORDER"}))
-	mock.ExpectExec(`UPDATE TODOLIST SET ITEM = \?, "ORDER" = \? WHERE ID = \?`).WithArgs(todoItem.Item, todoItem.Order, todoItem.Id).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE ID=\? AND OWNER=\?`).WithArgs(todoItem.Id, auth.Anonymous).WillReturnRows(itemRows().AddRow(todoItem.Id, DefaultListId, "", "Item", "", false, nil, nil, "", "", "", 1, nil, nil, nil, 1))
+	expectNoTags(mock)
+	expectNoBlockers(mock)
+	mock.ExpectQuery(`SELECT "order" FROM TODOLIST WHERE "order" = \? AND ID != \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \? LIMIT 1`).WithArgs(todoItem.Order, todoItem.Id, auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"order"}))
+	mock.ExpectExec(`UPDATE TODOLIST SET ITEM = \?, NOTES = \?, DUE_AT = \?, PRIORITY = \?, RECURRENCE = \?, TIME_ZONE = \?, "order" = \? WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(todoItem.Item, "", nil, "", "", "", todoItem.Order, todoItem.Id, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(1, 1))
+	expectTouch(mock, todoItem.Id)
 	mock.ExpectCommit()
 
 	err := store.Update(func(tx Txn) error {
@@ -76,7 +180,9 @@ func TestGet(t *testing.T) {
 	id := uuid.New().String()
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SELECT ID, ITEM, "ORDER" FROM TODOLIST WHERE ID=\?`).WithArgs(id).WillReturnRows(sqlmock.NewRows([]string{"ID", "ITEM", "ORDER"}).AddRow(id, "Test Item", 1))
+	mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE ID=\? AND OWNER=\?`).WithArgs(id, auth.Anonymous).WillReturnRows(itemRows().AddRow(id, DefaultListId, "", "Test Item", "", false, nil, nil, "", "", "", 1, nil, nil, nil, 1))
+	expectNoTags(mock)
+	expectNoBlockers(mock)
 	mock.ExpectCommit()
 
 	var todoItem structs.TodoItem
@@ -86,6 +192,7 @@ func TestGet(t *testing.T) {
 
 	assert.NoError(t, err)
 	assert.Equal(t, "Test Item", todoItem.Item)
+	assert.Equal(t, DefaultListId, todoItem.ListId)
 	assert.Equal(t, 1, todoItem.Order)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -98,12 +205,16 @@ func TestList(t *testing.T) {
 	ctx := context.Background()
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(`SELECT ID, ITEM, "ORDER" FROM TODOLIST`).WillReturnRows(sqlmock.NewRows([]string{"ID", "ITEM", "ORDER"}).AddRow(uuid.New().String(), "panos", 1).AddRow(uuid.New().String(), "geo", 2))
+	mock.ExpectQuery(`SELECT ID FROM LISTS WHERE ID = \? AND OWNER = \? LIMIT 1`).WithArgs(DefaultListId, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(DefaultListId))
+	mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \?`).WithArgs(auth.Anonymous, DefaultListId).
+		WillReturnRows(itemRows().AddRow(uuid.New().String(), DefaultListId, "", "panos", "", false, nil, nil, "", "", "", 1, nil, nil, nil, 1).AddRow(uuid.New().String(), DefaultListId, "", "geo", "", false, nil, nil, "", "", "", 1, nil, nil, nil, 2))
+	expectNoTags(mock)
+	expectNoBlockers(mock)
 	mock.ExpectCommit()
 
 	var todoItemList structs.TodoItemList
 	err := store.Update(func(tx Txn) error {
-		return tx.List(ctx, &todoItemList)
+		return tx.List(ctx, DefaultListId, structs.ItemQuery{}, &todoItemList)
 	})
 
 	assert.NoError(t, err)
@@ -127,8 +238,10 @@ func TestAdd(t *testing.T) {
 		}
 
 		mock.ExpectBegin()
-		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM TODOLIST`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-		mock.ExpectExec(`INSERT INTO TODOLIST`).WithArgs(todoItem.Id, todoItem.Item, todoItem.Order).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(`SELECT ID FROM LISTS WHERE ID = \? AND OWNER = \? LIMIT 1`).WithArgs(DefaultListId, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(DefaultListId))
+		expectNotTrashed(mock, todoItem.Id)
+		mock.ExpectQuery(`SELECT COUNT\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec(`INSERT INTO TODOLIST`).WithArgs(auth.Anonymous, todoItem.Id, DefaultListId, "", todoItem.Item, "", nil, "", "", "", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), todoItem.Order).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
 		err := store.Update(func(tx Txn) error {
@@ -147,9 +260,11 @@ func TestAdd(t *testing.T) {
 		}
 
 		mock.ExpectBegin()
-		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM TODOLIST`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
-		mock.ExpectQuery(`SELECT MAX\("ORDER"\) FROM TODOLIST`).WillReturnRows(sqlmock.NewRows([]string{"ORDER"}).AddRow(1))
-		mock.ExpectExec(`INSERT INTO TODOLIST`).WithArgs(todoItem.Id, todoItem.Item, todoItem.Order).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(`SELECT ID FROM LISTS WHERE ID = \? AND OWNER = \? LIMIT 1`).WithArgs(DefaultListId, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(DefaultListId))
+		expectNotTrashed(mock, todoItem.Id)
+		mock.ExpectQuery(`SELECT COUNT\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(`SELECT MAX\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"order"}).AddRow(1))
+		mock.ExpectExec(`INSERT INTO TODOLIST`).WithArgs(auth.Anonymous, todoItem.Id, DefaultListId, "", todoItem.Item, "", nil, "", "", "", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), todoItem.Order).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
 		err := store.Update(func(tx Txn) error {
@@ -168,8 +283,10 @@ func TestAdd(t *testing.T) {
 		}
 
 		mock.ExpectBegin()
-		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM TODOLIST`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
-		mock.ExpectQuery(`SELECT MAX\("ORDER"\) FROM TODOLIST`).WillReturnRows(sqlmock.NewRows([]string{"ORDER"}).AddRow(1))
+		mock.ExpectQuery(`SELECT ID FROM LISTS WHERE ID = \? AND OWNER = \? LIMIT 1`).WithArgs(DefaultListId, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(DefaultListId))
+		expectNotTrashed(mock, todoItem.Id)
+		mock.ExpectQuery(`SELECT COUNT\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(`SELECT MAX\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"order"}).AddRow(1))
 		mock.ExpectRollback()
 
 		err := store.Update(func(tx Txn) error {
@@ -177,7 +294,7 @@ func TestAdd(t *testing.T) {
 		})
 
 		assert.Error(t, err)
-		assert.Equal(t, "order should be 2 and you provided 3", err.Error())
+		assert.Equal(t, "order should be between 1 and 2 and you provided 3", err.Error())
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
@@ -189,8 +306,9 @@ func TestAdd(t *testing.T) {
 		}
 
 		mock.ExpectBegin()
-		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM TODOLIST`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-		mock.ExpectExec(`INSERT INTO TODOLIST`).WithArgs(sqlmock.AnyArg(), todoItem.Item, todoItem.Order).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(`SELECT ID FROM LISTS WHERE ID = \? AND OWNER = \? LIMIT 1`).WithArgs(DefaultListId, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(DefaultListId))
+		mock.ExpectQuery(`SELECT COUNT\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec(`INSERT INTO TODOLIST`).WithArgs(auth.Anonymous, sqlmock.AnyArg(), DefaultListId, "", todoItem.Item, "", nil, "", "", "", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), todoItem.Order).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
 		err := store.Update(func(tx Txn) error {
@@ -201,6 +319,56 @@ func TestAdd(t *testing.T) {
 		assert.NotEmpty(t, todoItem.Id)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
+
+	t.Run("Add item without order", func(t *testing.T) {
+		todoItem := &structs.TodoItem{
+			Id:   uuid.New().String(),
+			Item: "kostas",
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID FROM LISTS WHERE ID = \? AND OWNER = \? LIMIT 1`).WithArgs(DefaultListId, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(DefaultListId))
+		expectNotTrashed(mock, todoItem.Id)
+		mock.ExpectQuery(`SELECT COUNT\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectQuery(`SELECT MAX\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"order"}).AddRow(2))
+		mock.ExpectExec(`INSERT INTO TODOLIST`).WithArgs(auth.Anonymous, todoItem.Id, DefaultListId, "", todoItem.Item, "", nil, "", "", "", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), 3).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := store.Update(func(tx Txn) error {
+			return tx.Add(ctx, todoItem)
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, todoItem.Order)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Insert item before the end", func(t *testing.T) {
+		todoItem := &structs.TodoItem{
+			Id:    uuid.New().String(),
+			Item:  "nekta",
+			Order: 2,
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID FROM LISTS WHERE ID = \? AND OWNER = \? LIMIT 1`).WithArgs(DefaultListId, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(DefaultListId))
+		expectNotTrashed(mock, todoItem.Id)
+		mock.ExpectQuery(`SELECT COUNT\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(`SELECT MAX\("order"\) FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"order"}).AddRow(3))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = -\("order" \+ \?\) WHERE "order" BETWEEN \? AND \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).
+			WithArgs(1, 2, 3, auth.Anonymous, DefaultListId, "").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = -"order" WHERE "order" < 0 AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(`INSERT INTO TODOLIST`).WithArgs(auth.Anonymous, todoItem.Id, DefaultListId, "", todoItem.Item, "", nil, "", "", "", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := store.Update(func(tx Txn) error {
+			return tx.Add(ctx, todoItem)
+		})
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
 
 func TestCheckId(t *testing.T) {
@@ -214,8 +382,8 @@ func TestCheckId(t *testing.T) {
 	t.Run("ID exists", func(t *testing.T) {
 		mock.ExpectBegin()
 
-		mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \? LIMIT 1`).
-			WithArgs(id).
+		mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \? AND OWNER = \? AND DELETED_AT IS NULL LIMIT 1`).
+			WithArgs(id, auth.Anonymous).
 			WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(id))
 
 		mock.ExpectCommit()
@@ -232,8 +400,8 @@ func TestCheckId(t *testing.T) {
 	t.Run("ID does not exist", func(t *testing.T) {
 		mock.ExpectBegin()
 
-		mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \? LIMIT 1`).
-			WithArgs(id).
+		mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \? AND OWNER = \? AND DELETED_AT IS NULL LIMIT 1`).
+			WithArgs(id, auth.Anonymous).
 			WillReturnError(sql.ErrNoRows)
 
 		mock.ExpectRollback()
@@ -250,8 +418,8 @@ func TestCheckId(t *testing.T) {
 	t.Run("Database error", func(t *testing.T) {
 		mock.ExpectBegin()
 
-		mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \? LIMIT 1`).
-			WithArgs(id).
+		mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \? AND OWNER = \? AND DELETED_AT IS NULL LIMIT 1`).
+			WithArgs(id, auth.Anonymous).
 			WillReturnError(assert.AnError)
 
 		mock.ExpectRollback()
@@ -264,3 +432,876 @@ func TestCheckId(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
+
+func setupMockPostgresDB(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	sqlxDB := sqlx.NewDb(db, "pgx")
+	return sqlxDB, mock
+}
+
+func TestUpdateRetry(t *testing.T) {
+	id := uuid.New().String()
+	serializationFailure := &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+
+	t.Run("Postgres retries serialization failures", func(t *testing.T) {
+		db, mock := setupMockPostgresDB(t)
+		defer db.Close()
+		store := NewSqlStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \$1 AND OWNER = \$2 AND DELETED_AT IS NULL LIMIT 1`).WithArgs(id, auth.Anonymous).WillReturnError(serializationFailure)
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \$1 AND OWNER = \$2 AND DELETED_AT IS NULL LIMIT 1`).WithArgs(id, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"ID"}).AddRow(id))
+		mock.ExpectCommit()
+
+		attempts := 0
+		err := store.Update(func(tx Txn) error {
+			attempts++
+			return tx.CheckId(context.Background(), id)
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Postgres gives up after max attempts", func(t *testing.T) {
+		db, mock := setupMockPostgresDB(t)
+		defer db.Close()
+		store := NewSqlStore(db)
+
+		for i := 0; i < maxTxAttempts; i++ {
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \$1 AND OWNER = \$2 AND DELETED_AT IS NULL LIMIT 1`).WithArgs(id, auth.Anonymous).WillReturnError(serializationFailure)
+			mock.ExpectRollback()
+		}
+
+		err := store.Update(func(tx Txn) error {
+			return tx.CheckId(context.Background(), id)
+		})
+
+		assert.ErrorIs(t, err, serializationFailure)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Other errors are not retried", func(t *testing.T) {
+		db, mock := setupMockPostgresDB(t)
+		defer db.Close()
+		store := NewSqlStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID FROM TODOLIST WHERE ID = \$1 AND OWNER = \$2 AND DELETED_AT IS NULL LIMIT 1`).WithArgs(id, auth.Anonymous).WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		err := store.Update(func(tx Txn) error {
+			return tx.CheckId(context.Background(), id)
+		})
+
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestReorder(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	store := NewSqlStore(db)
+	ctx := context.Background()
+	id := uuid.New().String()
+
+	t.Run("Move down shifts the items in between up", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT LIST_ID, PARENT_ID, DONE FROM TODOLIST WHERE ID = \? AND OWNER = \?`).WithArgs(id, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"LIST_ID", "PARENT_ID", "DONE"}).AddRow(DefaultListId, "", false))
+		expectCountOrdered(mock, id, 4)
+		mock.ExpectQuery(`SELECT "order" FROM TODOLIST WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(id, auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"order"}).AddRow(2))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = NULL WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(id, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = -\("order" \+ \?\) WHERE "order" BETWEEN \? AND \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(-1, 3, 5, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = -"order" WHERE "order" < 0 AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = \? WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(5, id, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTouch(mock, id)
+		mock.ExpectCommit()
+
+		err := store.Update(func(tx Txn) error {
+			return tx.Reorder(ctx, id, 5)
+		})
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Move up shifts the items in between down", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT LIST_ID, PARENT_ID, DONE FROM TODOLIST WHERE ID = \? AND OWNER = \?`).WithArgs(id, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"LIST_ID", "PARENT_ID", "DONE"}).AddRow(DefaultListId, "", false))
+		expectCountOrdered(mock, id, 4)
+		mock.ExpectQuery(`SELECT "order" FROM TODOLIST WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(id, auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"order"}).AddRow(5))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = NULL WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(id, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = -\("order" \+ \?\) WHERE "order" BETWEEN \? AND \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(1, 1, 4, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 4))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = -"order" WHERE "order" < 0 AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 4))
+		mock.ExpectExec(`UPDATE TODOLIST SET "order" = \? WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(1, id, auth.Anonymous, DefaultListId, "").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectTouch(mock, id)
+		mock.ExpectCommit()
+
+		err := store.Update(func(tx Txn) error {
+			return tx.Reorder(ctx, id, 1)
+		})
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Same order moves no item", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT LIST_ID, PARENT_ID, DONE FROM TODOLIST WHERE ID = \? AND OWNER = \?`).WithArgs(id, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"LIST_ID", "PARENT_ID", "DONE"}).AddRow(DefaultListId, "", false))
+		expectCountOrdered(mock, id, 4)
+		mock.ExpectQuery(`SELECT "order" FROM TODOLIST WHERE ID = \? AND OWNER = \? AND LIST_ID = \? AND PARENT_ID = \?`).WithArgs(id, auth.Anonymous, DefaultListId, "").WillReturnRows(sqlmock.NewRows([]string{"order"}).AddRow(3))
+		// the request is still a write to the item
+		expectTouch(mock, id)
+		mock.ExpectCommit()
+
+		err := store.Update(func(tx Txn) error {
+			return tx.Reorder(ctx, id, 3)
+		})
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Past the end is rejected", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT LIST_ID, PARENT_ID, DONE FROM TODOLIST WHERE ID = \? AND OWNER = \?`).WithArgs(id, auth.Anonymous).WillReturnRows(sqlmock.NewRows([]string{"LIST_ID", "PARENT_ID", "DONE"}).AddRow(DefaultListId, "", false))
+		expectCountOrdered(mock, id, 4)
+		mock.ExpectRollback()
+
+		err := store.Update(func(tx Txn) error {
+			return tx.Reorder(ctx, id, 6)
+		})
+
+		assert.EqualError(t, err, "order should be between 1 and 5 and you provided 6")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestOwnerScoping(t *testing.T) {
+	db, mock := setupMockDB(t)
+	defer db.Close()
+
+	store := NewSqlStore(db)
+	ctx := auth.WithPrincipal(context.Background(), "bob")
+	id := uuid.New().String()
+
+	t.Run("Another owner's item is not found", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE ID=\? AND OWNER=\?`).WithArgs(id, "bob").WillReturnRows(itemRows())
+		mock.ExpectRollback()
+
+		var item structs.TodoItem
+		err := store.Update(func(tx Txn) error {
+			return tx.Get(ctx, id, &item)
+		})
+
+		assert.EqualError(t, err, "unknown id")
+		assert.True(t, IsNotFound(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("The default list is created on first use", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT ID FROM LISTS WHERE ID = \? AND OWNER = \? LIMIT 1`).WithArgs(DefaultListId, "bob").WillReturnRows(sqlmock.NewRows([]string{"ID"}))
+		mock.ExpectQuery(`SELECT COUNT\("order"\) FROM LISTS WHERE OWNER = \?`).WithArgs("bob").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec(`INSERT INTO LISTS\(OWNER, ID, NAME, "order"\)`).WithArgs("bob", DefaultListId, "Todo", 1).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(`SELECT ID, LIST_ID, PARENT_ID, ITEM, NOTES, DONE, COMPLETED_AT, DUE_AT, PRIORITY, RECURRENCE, TIME_ZONE, VERSION, CREATED_AT, UPDATED_AT, DELETED_AT, "order" FROM TODOLIST WHERE OWNER = \? AND LIST_ID = \?`).WithArgs("bob", DefaultListId).WillReturnRows(itemRows())
+		mock.ExpectCommit()
+
+		var items structs.TodoItemList
+		err := store.Update(func(tx Txn) error {
+			return tx.List(ctx, DefaultListId, structs.ItemQuery{}, &items)
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, items.Count)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestOwnerIsolation(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			store := NewSqlStore(db, WithRankStrategy(strategy))
+			alice := auth.WithPrincipal(context.Background(), "alice")
+			bob := auth.WithPrincipal(context.Background(), "bob")
+
+			milk := structs.TodoItem{Item: "Milk"}
+			bread := structs.TodoItem{Item: "Bread"}
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.Add(alice, &milk) }))
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.Add(alice, &bread) }))
+
+			// every owner orders their own default list
+			beer := structs.TodoItem{Item: "Beer"}
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.Add(bob, &beer) }))
+			assert.Equal(t, 1, beer.Order)
+
+			var items structs.TodoItemList
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.List(bob, DefaultListId, structs.ItemQuery{}, &items) }))
+			assert.Equal(t, []structs.TodoItem{beer}, items.Items)
+
+			// the items of another owner cannot be reached through their id
+			for name, action := range map[string]func(tx Txn) error{
+				"Get":     func(tx Txn) error { return tx.Get(bob, milk.Id, &structs.TodoItem{}) },
+				"CheckId": func(tx Txn) error { return tx.CheckId(bob, milk.Id) },
+				"Update":  func(tx Txn) error { return tx.Update(bob, &structs.TodoItem{Id: milk.Id, Item: "Wine", Order: 1}) },
+				"Reorder": func(tx Txn) error { return tx.Reorder(bob, milk.Id, 1) },
+				"Move":    func(tx Txn) error { return tx.MoveItem(bob, milk.Id, DefaultListId, 1) },
+				"Delete":  func(tx Txn) error { return tx.Delete(bob, milk.Id, &structs.TodoItemList{}) },
+			} {
+				err := store.Update(action)
+				assert.True(t, IsNotFound(err), "%s: %v", name, err)
+			}
+
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.List(alice, DefaultListId, structs.ItemQuery{}, &items) }))
+			assert.Equal(t, []structs.TodoItem{milk, bread}, items.Items)
+
+			// nor can their lists
+			work := structs.List{Name: "Work"}
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.AddList(alice, &work) }))
+			err := store.Update(func(tx Txn) error { return tx.List(bob, work.Id, structs.ItemQuery{}, &items) })
+			assert.True(t, IsNotFound(err))
+			err = store.Update(func(tx Txn) error { return tx.MoveItem(bob, beer.Id, work.Id, 0) })
+			assert.True(t, IsNotFound(err))
+			err = store.Update(func(tx Txn) error { return tx.DeleteList(bob, work.Id, &structs.Lists{}) })
+			assert.True(t, IsNotFound(err))
+
+			var lists structs.Lists
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.ListLists(bob, &lists) }))
+			assert.Equal(t, []structs.List{{Id: DefaultListId, Name: "Todo", Order: 1}}, lists.Items)
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.ListLists(alice, &lists) }))
+			assert.Equal(t, 2, lists.Count)
+
+			// ids only have to be unique per owner
+			copied := structs.TodoItem{Id: milk.Id, Item: "Milk"}
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.Add(bob, &copied) }))
+			assert.Equal(t, 2, copied.Order)
+		})
+	}
+}
+
+func TestDueDates(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			testDueDates(t, NewSqlStore(db, WithRankStrategy(strategy)))
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testDueDates(t, NewMemoryStore())
+	})
+}
+
+// testDueDates runs the same due date scenario against any Store.
+func testDueDates(t *testing.T, store Store) {
+	ctx := context.Background()
+	athens := time.FixedZone("EEST", 3*60*60)
+	at := func(t time.Time) *time.Time { return &t }
+	list := func(query structs.ItemQuery) []string {
+		var items structs.TodoItemList
+		require.NoError(t, store.Update(func(tx Txn) error { return tx.List(ctx, DefaultListId, query, &items) }))
+		names := itemNames(items.Items)
+		sort.Strings(names)
+		return names
+	}
+
+	past := time.Now().Add(-48 * time.Hour).In(athens)
+	future := time.Now().Add(48 * time.Hour).In(athens)
+	for _, item := range []*structs.TodoItem{
+		{Item: "late", DueAt: at(past)},
+		{Item: "done", DueAt: at(past)},
+		{Item: "soon", DueAt: at(future)},
+		{Item: "someday"},
+	} {
+		require.NoError(t, store.Update(func(tx Txn) error { return tx.Add(ctx, item) }))
+		if item.Item == "done" {
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.Complete(ctx, item.Id, true, item) }))
+		}
+		if item.Item == "late" {
+			// due dates are kept in UTC, to the second
+			var got structs.TodoItem
+			require.NoError(t, store.Update(func(tx Txn) error { return tx.Get(ctx, item.Id, &got) }))
+			assert.Equal(t, time.UTC, got.DueAt.Location())
+			assert.Equal(t, past.Truncate(time.Second).Unix(), got.DueAt.Unix())
+		}
+	}
+
+	assert.Equal(t, []string{"done", "late", "someday", "soon"}, list(structs.ItemQuery{}))
+	assert.Equal(t, []string{"done", "late"}, list(structs.ItemQuery{DueBefore: at(time.Now())}))
+	assert.Equal(t, []string{"done", "late", "soon"}, list(structs.ItemQuery{DueBefore: at(future.Add(time.Hour))}))
+	assert.Equal(t, []string{"late"}, list(structs.ItemQuery{Overdue: true}))
+	assert.Empty(t, list(structs.ItemQuery{Overdue: true, DueBefore: at(past.Add(-time.Hour))}))
+
+	// a new due date replaces the old one, none clears it
+	var items structs.TodoItemList
+	require.NoError(t, store.Update(func(tx Txn) error { return tx.List(ctx, DefaultListId, structs.ItemQuery{}, &items) }))
+	for _, item := range items.Items {
+		switch item.Item {
+		case "soon":
+			item.DueAt = at(past)
+		case "late":
+			item.DueAt = nil
+		default:
+			continue
+		}
+		require.NoError(t, store.Update(func(tx Txn) error { return tx.Update(ctx, &item) }))
+	}
+	assert.Equal(t, []string{"soon"}, list(structs.ItemQuery{Overdue: true}))
+}
+
+func TestTags(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			testTags(t, NewSqlStore(db, WithRankStrategy(strategy)))
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testTags(t, NewMemoryStore())
+	})
+}
+
+// testTags runs the same priority and tag scenario against any Store.
+func testTags(t *testing.T, store Store) {
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	list := func(listId string, query structs.ItemQuery) []string {
+		var items structs.TodoItemList
+		update(func(tx Txn) error { return tx.List(ctx, listId, query, &items) })
+		names := itemNames(items.Items)
+		sort.Strings(names)
+		return names
+	}
+	tags := func(ctx context.Context) []structs.Tag {
+		var tags structs.Tags
+		update(func(tx Txn) error { return tx.ListTags(ctx, &tags) })
+		return tags.Items
+	}
+
+	milk := structs.TodoItem{Item: "milk", Priority: structs.PriorityHigh, Tags: []string{"ignored"}}
+	bread := structs.TodoItem{Item: "bread", Priority: structs.PriorityLow}
+	taxes := structs.TodoItem{Item: "taxes", Priority: structs.PriorityHigh}
+	for _, item := range []*structs.TodoItem{&milk, &bread, &taxes} {
+		update(func(tx Txn) error { return tx.Add(ctx, item) })
+	}
+	assert.Nil(t, milk.Tags)
+
+	update(func(tx Txn) error { return tx.TagItem(ctx, milk.Id, "shop") })
+	update(func(tx Txn) error { return tx.TagItem(ctx, milk.Id, "home") })
+	// tagging twice changes nothing
+	update(func(tx Txn) error { return tx.TagItem(ctx, milk.Id, "shop") })
+	update(func(tx Txn) error { return tx.TagItem(ctx, bread.Id, "shop") })
+	update(func(tx Txn) error { return tx.TagItem(ctx, taxes.Id, "home") })
+
+	var got structs.TodoItem
+	update(func(tx Txn) error { return tx.Get(ctx, milk.Id, &got) })
+	assert.Equal(t, []string{"home", "shop"}, got.Tags)
+	assert.Equal(t, structs.PriorityHigh, got.Priority)
+	assert.Equal(t, []structs.Tag{{Name: "home", Count: 2}, {Name: "shop", Count: 2}}, tags(ctx))
+
+	assert.Equal(t, []string{"bread", "milk"}, list(DefaultListId, structs.ItemQuery{Tag: "shop"}))
+	assert.Equal(t, []string{"milk", "taxes"}, list(DefaultListId, structs.ItemQuery{Priority: structs.PriorityHigh}))
+	assert.Equal(t, []string{"bread"}, list(DefaultListId, structs.ItemQuery{Tag: "shop", Priority: structs.PriorityLow}))
+	assert.Empty(t, list(DefaultListId, structs.ItemQuery{Tag: "work"}))
+
+	// an update keeps the tags and replaces the priority
+	update(func(tx Txn) error { return tx.Update(ctx, &structs.TodoItem{Id: milk.Id, Item: "oat milk", Order: 1}) })
+	update(func(tx Txn) error { return tx.Get(ctx, milk.Id, &got) })
+	assert.Equal(t, []string{"home", "shop"}, got.Tags)
+	assert.Equal(t, structs.Priority(""), got.Priority)
+
+	update(func(tx Txn) error { return tx.UntagItem(ctx, milk.Id, "shop") })
+	update(func(tx Txn) error { return tx.UntagItem(ctx, milk.Id, "shop") })
+	update(func(tx Txn) error { return tx.Delete(ctx, taxes.Id, &structs.TodoItemList{}) })
+	assert.Equal(t, []structs.Tag{{Name: "home", Count: 1}, {Name: "shop", Count: 1}}, tags(ctx))
+
+	// the tags of a list go with it
+	work := structs.List{Name: "Work"}
+	update(func(tx Txn) error { return tx.AddList(ctx, &work) })
+	report := structs.TodoItem{Item: "report", ListId: work.Id}
+	update(func(tx Txn) error { return tx.Add(ctx, &report) })
+	update(func(tx Txn) error { return tx.TagItem(ctx, report.Id, "office") })
+	assert.Equal(t, []string{"report"}, list(work.Id, structs.ItemQuery{Tag: "office"}))
+	update(func(tx Txn) error { return tx.DeleteList(ctx, work.Id, &structs.Lists{}) })
+	assert.Equal(t, []structs.Tag{{Name: "home", Count: 1}, {Name: "shop", Count: 1}}, tags(ctx))
+
+	// every owner has tags of their own
+	bob := auth.WithPrincipal(ctx, "bob")
+	assert.Empty(t, tags(bob))
+	err := store.Update(func(tx Txn) error { return tx.TagItem(bob, milk.Id, "shop") })
+	assert.True(t, IsNotFound(err))
+}
+
+func TestTagsOfManyItems(t *testing.T) {
+	db := setupSQLiteDB(t)
+	ids := seedItems(t, db, DenseRanking, "", 1200)
+	store := NewSqlStore(db)
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	update(func(tx Txn) error { return tx.TagItem(ctx, ids[0], "home") })
+	update(func(tx Txn) error { return tx.TagItem(ctx, ids[1199], "shop") })
+	update(func(tx Txn) error { return tx.TagItem(ctx, ids[1199], "home") })
+
+	// more items than a statement can bind ids
+	items := make([]*structs.TodoItem, len(ids))
+	for i, id := range ids {
+		items[i] = &structs.TodoItem{Id: id}
+	}
+	update(func(tx Txn) error { return tx.(*sqlStoreTxn).withTags(ctx, items...) })
+	assert.Equal(t, []string{"home"}, items[0].Tags)
+	assert.Nil(t, items[600].Tags)
+	assert.Equal(t, []string{"home", "shop"}, items[1199].Tags)
+}
+
+func TestSubtasks(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			testSubtasks(t, NewSqlStore(db, WithRankStrategy(strategy)))
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testSubtasks(t, NewMemoryStore())
+	})
+}
+
+// testSubtasks runs the same sub-task scenario against any Store.
+func testSubtasks(t *testing.T, store Store) {
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	add := func(name, listId, parentId string) structs.TodoItem {
+		item := structs.TodoItem{Item: name, ListId: listId, ParentId: parentId}
+		update(func(tx Txn) error { return tx.Add(ctx, &item) })
+		return item
+	}
+	// children returns the names of the sub-tasks of parentId in their order
+	children := func(listId, parentId string) []string {
+		var items structs.TodoItemList
+		update(func(tx Txn) error { return tx.List(ctx, listId, structs.ItemQuery{}, &items) })
+		siblings := make([]structs.TodoItem, 0)
+		for _, item := range items.Items {
+			if item.ParentId == parentId {
+				siblings = append(siblings, item)
+			}
+		}
+		sort.Slice(siblings, func(i, j int) bool { return siblings[i].Order < siblings[j].Order })
+		for i, item := range siblings {
+			assert.Equal(t, i+1, item.Order, "the siblings of %s are numbered densely", item.Item)
+		}
+		return itemNames(siblings)
+	}
+
+	a, b, c := add("a", DefaultListId, ""), add("b", DefaultListId, ""), add("c", DefaultListId, "")
+	a1, a2 := add("a1", DefaultListId, a.Id), add("a2", DefaultListId, a.Id)
+	assert.Equal(t, 1, a1.Order)
+	assert.Equal(t, 2, a2.Order)
+	assert.Equal(t, []string{"a", "b", "c"}, children(DefaultListId, ""))
+
+	err := store.Update(func(tx Txn) error {
+		return tx.Add(ctx, &structs.TodoItem{Item: "x", ParentId: uuid.New().String()})
+	})
+	assert.ErrorContains(t, err, "unknown parent item")
+	work := structs.List{Name: "Work"}
+	update(func(tx Txn) error { return tx.AddList(ctx, &work) })
+	err = store.Update(func(tx Txn) error {
+		return tx.Add(ctx, &structs.TodoItem{Item: "x", ListId: work.Id, ParentId: a.Id})
+	})
+	assert.EqualError(t, err, "the parent item is in another list")
+
+	// reordering stays among the siblings
+	update(func(tx Txn) error { return tx.Reorder(ctx, a2.Id, 1) })
+	assert.Equal(t, []string{"a2", "a1"}, children(DefaultListId, a.Id))
+	assert.Equal(t, []string{"a", "b", "c"}, children(DefaultListId, ""))
+
+	// re-parenting closes the gap among the old siblings
+	update(func(tx Txn) error { return tx.Reparent(ctx, b.Id, a.Id, 0) })
+	assert.Equal(t, []string{"a2", "a1", "b"}, children(DefaultListId, a.Id))
+	assert.Equal(t, []string{"a", "c"}, children(DefaultListId, ""))
+
+	// an item cannot be moved under itself or its sub-tasks
+	for _, parentId := range []string{a.Id, a1.Id} {
+		err = store.Update(func(tx Txn) error { return tx.Reparent(ctx, a.Id, parentId, 0) })
+		assert.EqualError(t, err, "an item cannot be moved under itself or its sub-tasks")
+	}
+
+	update(func(tx Txn) error { return tx.Reparent(ctx, b.Id, "", 1) })
+	assert.Equal(t, []string{"b", "a", "c"}, children(DefaultListId, ""))
+	assert.Equal(t, []string{"a2", "a1"}, children(DefaultListId, a.Id))
+
+	// the sub-tasks go with their item
+	var shifted structs.TodoItemList
+	update(func(tx Txn) error { return tx.Delete(ctx, a.Id, &shifted) })
+	assert.Equal(t, []string{"c"}, itemNames(shifted.Items))
+	assert.Equal(t, 2, shifted.Items[0].Order)
+	err = store.Update(func(tx Txn) error { return tx.Get(ctx, a1.Id, &structs.TodoItem{}) })
+	assert.True(t, IsNotFound(err))
+
+	// and follow it to another list, where it becomes a top-level item
+	c1 := add("c1", DefaultListId, c.Id)
+	update(func(tx Txn) error { return tx.Reparent(ctx, c.Id, b.Id, 0) })
+	update(func(tx Txn) error { return tx.MoveItem(ctx, c.Id, work.Id, 0) })
+	assert.Empty(t, children(DefaultListId, b.Id))
+	assert.Equal(t, []string{"c"}, children(work.Id, ""))
+	assert.Equal(t, []string{"c1"}, children(work.Id, c.Id))
+	var moved structs.TodoItem
+	update(func(tx Txn) error { return tx.Get(ctx, c1.Id, &moved) })
+	assert.Equal(t, work.Id, moved.ListId)
+}
+
+func TestVersions(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			testVersions(t, NewSqlStore(db, WithRankStrategy(strategy)))
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testVersions(t, NewMemoryStore())
+	})
+}
+
+// testVersions runs the same versioning scenario against any Store.
+func testVersions(t *testing.T, store Store) {
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	get := func(id string) structs.TodoItem {
+		var item structs.TodoItem
+		update(func(tx Txn) error { return tx.Get(ctx, id, &item) })
+		return item
+	}
+
+	a, b := structs.TodoItem{Item: "a"}, structs.TodoItem{Item: "b"}
+	update(func(tx Txn) error { return tx.Add(ctx, &a) })
+	update(func(tx Txn) error { return tx.Add(ctx, &b) })
+	assert.Equal(t, 1, a.Version)
+	require.NotNil(t, a.CreatedAt)
+	assert.Equal(t, a.CreatedAt, a.UpdatedAt)
+	stored := get(a.Id)
+	assert.Equal(t, 1, stored.Version)
+	assert.True(t, a.CreatedAt.Equal(*stored.CreatedAt))
+
+	// the client cannot set the version
+	edited := structs.TodoItem{Id: a.Id, Item: "a2", Order: 1, Version: 7}
+	update(func(tx Txn) error { return tx.Update(ctx, &edited) })
+	assert.Equal(t, 2, edited.Version)
+	stored = get(a.Id)
+	assert.Equal(t, 2, stored.Version)
+	assert.True(t, a.CreatedAt.Equal(*stored.CreatedAt))
+	assert.False(t, stored.UpdatedAt.Before(*a.UpdatedAt))
+
+	// moving an item is a write to it, but not to the sibling it passes
+	update(func(tx Txn) error { return tx.Reorder(ctx, a.Id, 2) })
+	assert.Equal(t, 3, get(a.Id).Version)
+	assert.Equal(t, 1, get(b.Id).Version)
+
+	var done structs.TodoItem
+	update(func(tx Txn) error { return tx.Complete(ctx, b.Id, true, &done) })
+	assert.Equal(t, 2, done.Version)
+	update(func(tx Txn) error { return tx.Complete(ctx, b.Id, true, &done) })
+	assert.Equal(t, 2, done.Version, "completing a completed item writes nothing")
+
+	update(func(tx Txn) error { return tx.TagItem(ctx, b.Id, "home") })
+	update(func(tx Txn) error { return tx.TagItem(ctx, b.Id, "home") })
+	assert.Equal(t, 3, get(b.Id).Version, "tagging an item twice is a single write")
+	update(func(tx Txn) error { return tx.UntagItem(ctx, b.Id, "home") })
+	update(func(tx Txn) error { return tx.UntagItem(ctx, b.Id, "home") })
+	assert.Equal(t, 4, get(b.Id).Version)
+
+	update(func(tx Txn) error { return tx.Reparent(ctx, b.Id, a.Id, 0) })
+	assert.Equal(t, 5, get(b.Id).Version)
+	assert.Equal(t, 3, get(a.Id).Version)
+}
+
+func TestTrash(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			testTrash(t, NewSqlStore(db, WithRankStrategy(strategy)))
+		})
+	}
+	t.Run("memory", func(t *testing.T) {
+		testTrash(t, NewMemoryStore())
+	})
+}
+
+// testTrash runs the same trash scenario against any Store.
+func testTrash(t *testing.T, store Store) {
+	ctx := context.Background()
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	// list returns the names of the live sub-tasks of parentId in their order
+	list := func(parentId string) []string {
+		var items structs.TodoItemList
+		update(func(tx Txn) error { return tx.List(ctx, DefaultListId, structs.ItemQuery{}, &items) })
+		siblings := make([]structs.TodoItem, 0)
+		for _, item := range items.Items {
+			if item.ParentId == parentId {
+				siblings = append(siblings, item)
+			}
+		}
+		sort.Slice(siblings, func(i, j int) bool { return siblings[i].Order < siblings[j].Order })
+		return itemNames(siblings)
+	}
+	trash := func() []string {
+		var items structs.TodoItemList
+		update(func(tx Txn) error { return tx.ListTrash(ctx, &items) })
+		for _, item := range items.Items {
+			assert.NotNil(t, item.DeletedAt)
+		}
+		return itemNames(items.Items)
+	}
+	del := func(id string) {
+		update(func(tx Txn) error { return tx.Delete(ctx, id, &structs.TodoItemList{}) })
+	}
+	restore := func(id string, order int) (structs.TodoItem, error) {
+		var item structs.TodoItem
+		err := store.Update(func(tx Txn) error { return tx.Restore(ctx, id, order, &item) })
+		return item, err
+	}
+
+	a, b, c := structs.TodoItem{Item: "a"}, structs.TodoItem{Item: "b"}, structs.TodoItem{Item: "c"}
+	for _, item := range []*structs.TodoItem{&a, &b, &c} {
+		update(func(tx Txn) error { return tx.Add(ctx, item) })
+	}
+	s1, s2 := structs.TodoItem{Item: "s1", ParentId: b.Id}, structs.TodoItem{Item: "s2", ParentId: b.Id}
+	update(func(tx Txn) error { return tx.Add(ctx, &s1) })
+	update(func(tx Txn) error { return tx.Add(ctx, &s2) })
+	update(func(tx Txn) error { return tx.TagItem(ctx, b.Id, "home") })
+
+	// a sub-task deleted on its own stays in the trash when its item is restored
+	del(s2.Id)
+	del(b.Id)
+	assert.Equal(t, []string{"a", "c"}, list(""))
+	assert.ElementsMatch(t, []string{"b", "s2"}, trash())
+	err := store.Update(func(tx Txn) error { return tx.Get(ctx, b.Id, &structs.TodoItem{}) })
+	assert.True(t, IsNotFound(err))
+	var tags structs.Tags
+	update(func(tx Txn) error { return tx.ListTags(ctx, &tags) })
+	assert.Equal(t, 0, tags.Count)
+
+	restored, err := restore(b.Id, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, restored.Order, "back where it was")
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, []string{"home"}, restored.Tags)
+	assert.Equal(t, []string{"a", "b", "c"}, list(""))
+	assert.Equal(t, []string{"s1"}, list(b.Id))
+	assert.Equal(t, []string{"s2"}, trash())
+
+	_, err = restore(b.Id, 0)
+	assert.True(t, IsNotFound(err), "it is no longer in the trash")
+	_, err = restore(s1.Id, 0)
+	assert.True(t, IsNotFound(err), "it went to the trash with its item")
+
+	// or at the requested position
+	del(a.Id)
+	restored, err = restore(a.Id, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, restored.Order)
+	assert.Equal(t, []string{"b", "a", "c"}, list(""))
+
+	// a sub-task whose item has gone is restored as a top-level item
+	del(s1.Id)
+	del(b.Id)
+	restored, err = restore(s1.Id, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "", restored.ParentId)
+	assert.Equal(t, []string{"a", "c", "s1"}, list(""))
+
+	// the id of a deleted item can be used again
+	reused := structs.TodoItem{Id: b.Id, Item: "b2"}
+	update(func(tx Txn) error { return tx.Add(ctx, &reused) })
+	assert.Equal(t, []string{"s2"}, trash())
+
+	var purged int
+	update(func(tx Txn) error {
+		var err error
+		purged, err = tx.PurgeTrash(ctx, time.Now().Add(-time.Hour))
+		return err
+	})
+	assert.Equal(t, 0, purged, "nothing has been in the trash for an hour")
+	update(func(tx Txn) error {
+		var err error
+		purged, err = tx.PurgeTrash(ctx, time.Now().Add(time.Second))
+		return err
+	})
+	assert.Equal(t, 1, purged)
+	assert.Empty(t, trash())
+	_, err = restore(s2.Id, 0)
+	assert.True(t, IsNotFound(err))
+}
+
+func TestManySubtasks(t *testing.T) {
+	for _, strategy := range []RankStrategy{DenseRanking, LexoRanking} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupSQLiteDB(t)
+			require.NoError(t, PrepareRanks(db, strategy))
+			store := NewSqlStore(db, WithRankStrategy(strategy))
+			ctx := context.Background()
+			update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+			count := func(query string) int {
+				var n int
+				require.NoError(t, db.Get(&n, query))
+				return n
+			}
+
+			// more sub-tasks than a statement can bind ids
+			parent := structs.TodoItem{Item: "parent"}
+			update(func(tx Txn) error { return tx.Add(ctx, &parent) })
+			ids := seedItems(t, db, strategy, parent.Id, 1200)
+			update(func(tx Txn) error { return tx.TagItem(ctx, ids[1100], "home") })
+
+			update(func(tx Txn) error { return tx.Delete(ctx, parent.Id, &structs.TodoItemList{}) })
+			assert.Equal(t, 1201, count(`SELECT COUNT(*) FROM TODOLIST WHERE DELETED_AT IS NOT NULL`))
+			update(func(tx Txn) error { return tx.Restore(ctx, parent.Id, 0, &structs.TodoItem{}) })
+			assert.Equal(t, 0, count(`SELECT COUNT(*) FROM TODOLIST WHERE DELETED_AT IS NOT NULL`))
+
+			work := structs.List{Name: "Work"}
+			update(func(tx Txn) error { return tx.AddList(ctx, &work) })
+			update(func(tx Txn) error { return tx.MoveItem(ctx, parent.Id, work.Id, 0) })
+			assert.Equal(t, 1201, count(`SELECT COUNT(*) FROM TODOLIST WHERE LIST_ID = '`+work.Id+`'`))
+
+			update(func(tx Txn) error { return tx.Delete(ctx, parent.Id, &structs.TodoItemList{}) })
+			update(func(tx Txn) error {
+				_, err := tx.PurgeTrash(ctx, time.Now().Add(time.Second))
+				return err
+			})
+			assert.Equal(t, 0, count(`SELECT COUNT(*) FROM TODOLIST`))
+			assert.Equal(t, 0, count(`SELECT COUNT(*) FROM ITEM_TAGS`))
+		})
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	t.Run("sqlite", func(t *testing.T) {
+		testAttachments(t, NewSqlStore(setupSQLiteDB(t)))
+	})
+	t.Run("memory", func(t *testing.T) {
+		testAttachments(t, NewMemoryStore())
+	})
+}
+
+// testAttachments runs the same attachment scenario against any Store.
+func testAttachments(t *testing.T, store Store) {
+	ctx := auth.WithPrincipal(context.Background(), "alice")
+	bob := auth.WithPrincipal(context.Background(), "bob")
+	update := func(action func(tx Txn) error) { require.NoError(t, store.Update(action)) }
+	add := func(item structs.TodoItem) structs.TodoItem {
+		update(func(tx Txn) error { return tx.Add(ctx, &item) })
+		return item
+	}
+	attach := func(itemId, name, digest string, size int64) structs.Attachment {
+		attachment := structs.Attachment{ItemId: itemId, Name: name, ContentType: "text/plain", Digest: digest, Size: size}
+		update(func(tx Txn) error { return tx.AddAttachment(ctx, &attachment) })
+		return attachment
+	}
+	names := func(itemId string) []string {
+		var attachments structs.Attachments
+		update(func(tx Txn) error { return tx.ListAttachments(ctx, itemId, &attachments) })
+		assert.Equal(t, len(attachments.Items), attachments.Count)
+		names := make([]string, 0)
+		for _, attachment := range attachments.Items {
+			names = append(names, attachment.Name)
+		}
+		return names
+	}
+	size := func(ctx context.Context) int64 {
+		var size int64
+		update(func(tx Txn) error {
+			var err error
+			size, err = tx.AttachmentsSize(ctx)
+			return err
+		})
+		return size
+	}
+	digests := func() map[string]bool {
+		var used map[string]bool
+		update(func(tx Txn) error {
+			var err error
+			used, err = tx.AttachmentDigests(ctx)
+			return err
+		})
+		return used
+	}
+
+	bills := add(structs.TodoItem{Item: "Pay bills"})
+	car := add(structs.TodoItem{Item: "Wash car"})
+	invoice := attach(bills.Id, "invoice.txt", "d1", 10)
+	assert.NotEmpty(t, invoice.Id)
+	assert.NotNil(t, invoice.CreatedAt)
+	attach(bills.Id, "receipt.txt", "d2", 20)
+	attach(car.Id, "copy.txt", "d1", 10)
+	assert.Equal(t, []string{"invoice.txt", "receipt.txt"}, names(bills.Id))
+	assert.Equal(t, int64(40), size(ctx))
+	assert.Equal(t, map[string]bool{"d1": true, "d2": true}, digests())
+
+	var got structs.Attachment
+	update(func(tx Txn) error { return tx.GetAttachment(ctx, bills.Id, invoice.Id, &got) })
+	assert.Equal(t, invoice.Name, got.Name)
+	assert.Equal(t, invoice.Digest, got.Digest)
+	assert.True(t, invoice.CreatedAt.Equal(*got.CreatedAt))
+
+	// attachments are not part of the item
+	var item structs.TodoItem
+	update(func(tx Txn) error { return tx.Get(ctx, bills.Id, &item) })
+	assert.Equal(t, 1, item.Version)
+
+	// nor are they found through another item or by another user
+	err := store.Update(func(tx Txn) error { return tx.GetAttachment(ctx, car.Id, invoice.Id, &got) })
+	assert.True(t, IsNotFound(err))
+	err = store.Update(func(tx Txn) error { return tx.GetAttachment(bob, bills.Id, invoice.Id, &got) })
+	assert.True(t, IsNotFound(err))
+	err = store.Update(func(tx Txn) error {
+		return tx.AddAttachment(bob, &structs.Attachment{ItemId: bills.Id, Name: "x", ContentType: "text/plain", Digest: "d3"})
+	})
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, int64(0), size(bob))
+
+	update(func(tx Txn) error { return tx.DeleteAttachment(ctx, bills.Id, invoice.Id) })
+	assert.Equal(t, []string{"receipt.txt"}, names(bills.Id))
+	err = store.Update(func(tx Txn) error { return tx.DeleteAttachment(ctx, bills.Id, invoice.Id) })
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, map[string]bool{"d1": true, "d2": true}, digests(), "the copy still uses d1")
+
+	// attachments go to the trash with their item and come back with it
+	update(func(tx Txn) error { return tx.Delete(ctx, bills.Id, &structs.TodoItemList{}) })
+	err = store.Update(func(tx Txn) error { return tx.ListAttachments(ctx, bills.Id, &structs.Attachments{}) })
+	assert.True(t, IsNotFound(err))
+	update(func(tx Txn) error { return tx.Restore(ctx, bills.Id, 0, &item) })
+	assert.Equal(t, []string{"receipt.txt"}, names(bills.Id))
+
+	// and are removed for good along with it
+	update(func(tx Txn) error { return tx.Delete(ctx, bills.Id, &structs.TodoItemList{}) })
+	update(func(tx Txn) error {
+		_, err := tx.PurgeTrash(ctx, time.Now().Add(time.Second))
+		return err
+	})
+	assert.Equal(t, map[string]bool{"d1": true}, digests())
+	assert.Equal(t, int64(10), size(ctx))
+
+	// or with their list
+	var home structs.List
+	update(func(tx Txn) error {
+		home = structs.List{Name: "Home"}
+		return tx.AddList(ctx, &home)
+	})
+	plants := add(structs.TodoItem{ListId: home.Id, Item: "Water plants"})
+	attach(plants.Id, "schedule.txt", "d4", 5)
+	update(func(tx Txn) error { return tx.DeleteList(ctx, home.Id, &structs.Lists{}) })
+	assert.Equal(t, map[string]bool{"d1": true}, digests())
+}
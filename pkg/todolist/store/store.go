@@ -2,22 +2,213 @@ package store
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"go.altair.com/todolist/pkg/structs"
 )
 
+// DefaultListId is the list every user starts with, created the first time
+// it is needed. Items added without a list go there.
+const DefaultListId = "default"
+
+const defaultListName = "Todo"
+
+// NotFoundError is returned for ids that do not exist, which includes those of
+// the items and lists of other users.
+type NotFoundError struct {
+	msg string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.msg
+}
+
+// NotFoundf returns a NotFoundError with the formatted message.
+func NotFoundf(format string, args ...interface{}) error {
+	return &NotFoundError{msg: fmt.Sprintf(format, args...)}
+}
+
+func IsNotFound(err error) bool {
+	var notFound *NotFoundError
+	return errors.As(err, &notFound)
+}
+
+type Option func(o *options)
+
+type options struct {
+	rankStrategy RankStrategy
+	completion   CompletionPolicy
+	clock        func() time.Time
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		rankStrategy: DenseRanking,
+		completion:   KeepPlace,
+		clock:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithRankStrategy selects how the SQL store persists item positions,
+// DenseRanking by default. The memory store keeps dense positions.
+func WithRankStrategy(strategy RankStrategy) Option {
+	return func(o *options) {
+		o.rankStrategy = strategy
+	}
+}
+
+// WithCompletionPolicy selects where completed items go in the order of their
+// list, KeepPlace by default.
+func WithCompletionPolicy(policy CompletionPolicy) Option {
+	return func(o *options) {
+		o.completion = policy
+	}
+}
+
+// WithClock sets what the store takes the time to be when it completes items,
+// finds the overdue ones and works out the next occurrence of recurring ones,
+// time.Now by default.
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
 type Store interface {
 	Update(action func(tx Txn) error) error
 }
 
+// Txn scopes every query to the items and lists of the principal found in
+// the context, see auth.Principal.
+//
+// Every method that writes to an item bumps its version, including the
+// tagging and blocking ones when they change anything; the siblings that only
+// move along keep theirs.
 type Txn interface {
+	// Add inserts an item at item.Order, moving the items from that order
+	// onwards down by one. Without an order the item is appended and
+	// item.Order is set to its position. Orders past the end of the list are
+	// rejected rather than clamped.
 	Add(ctx context.Context, item *structs.TodoItem) error
-	Delete(ctx context.Context, id string) error
+	// Delete moves an item along with its sub-tasks to the trash and closes
+	// the gap it leaves. The siblings that moved up as a result are returned
+	// in shifted, with their new order. Items in the trash are left out by
+	// every other method but ListTrash, Restore and PurgeTrash.
+	Delete(ctx context.Context, id string, shifted *structs.TodoItemList) error
+	// ListTrash returns the items that were deleted, most recent first, with
+	// the order they had. The sub-tasks deleted along with them are not
+	// listed.
+	ListTrash(ctx context.Context, items *structs.TodoItemList) error
+	// Restore puts an item back from the trash at newOrder among its
+	// siblings, or at the order it had when newOrder is 0 and it still fits,
+	// otherwise at their end. It goes back under its parent, or to the top
+	// level when that is gone, and the sub-tasks that were deleted with it
+	// come back too. The item is returned in item.
+	Restore(ctx context.Context, id string, newOrder int, item *structs.TodoItem) error
+	// PurgeTrash removes the items of every user that went to the trash
+	// before then for good, and returns how many.
+	PurgeTrash(ctx context.Context, before time.Time) (int, error)
+	// Update replaces the item, and sets its new version in e. Without an
+	// order the item keeps the one it has.
 	Update(ctx context.Context, e *structs.TodoItem) error
 	Get(ctx context.Context, id string, item *structs.TodoItem) error
-	List(ctx context.Context, items *structs.TodoItemList) error
+	// List returns the items of a list that match query, sub-tasks included.
+	List(ctx context.Context, listId string, query structs.ItemQuery, items *structs.TodoItemList) error
+	// Siblings returns the sub-tasks of parentId in a list, or its top-level
+	// items when parentId is empty, that have an order, in their order. Their
+	// tags and blockers are left out.
+	Siblings(ctx context.Context, listId string, parentId string, items *structs.TodoItemList) error
 	DbTx() interface{}
 	CheckId(ctx context.Context, id string) error
+	// Reorder moves an item to newOrder, within the orders the completion
+	// policy allows for it.
 	Reorder(ctx context.Context, id string, newOrder int) error
-	ReorderItems(ctx context.Context, query string, newOrder int, oldOrder int) error
+	// MoveRelative moves an item among its siblings as move tells, and for a
+	// swap the other item as well. Moves in a direction go as far as the
+	// completion policy allows and are no write at the end of the way.
+	MoveRelative(ctx context.Context, id string, move structs.RelativeMove) error
+	// Arrange puts the sub-tasks of parentId in a list, or its top-level
+	// items when parentId is empty, in the order of ids. The ids must be
+	// those of the items with an order, each once, or it fails with an
+	// OrderConflictError. The items are moved all at once, and keep their
+	// versions as they only shift along.
+	Arrange(ctx context.Context, listId string, parentId string, ids []string) error
+	// Complete marks an item done, or open again when done is false, and
+	// places it according to the completion policy. The item is returned in
+	// item.
+	Complete(ctx context.Context, id string, done bool, item *structs.TodoItem) error
+	// TagItem tags an item, unless it already is.
+	TagItem(ctx context.Context, id string, tag string) error
+	// UntagItem removes a tag from an item, if it has it.
+	UntagItem(ctx context.Context, id string, tag string) error
+	// ListTags returns the tags on the items of the principal, sorted by
+	// name, with the number of items that have each.
+	ListTags(ctx context.Context, tags *structs.Tags) error
+	// MoveItem moves an item to newOrder in another list, or to its end when
+	// newOrder is 0. Both lists are renumbered. The item becomes a top-level
+	// item of the other list and its sub-tasks go along with it.
+	MoveItem(ctx context.Context, id string, listId string, newOrder int) error
+	// Reparent makes an item a sub-task of parentId in the same list, or a
+	// top-level item when parentId is empty, at newOrder among its new
+	// siblings or at their end when newOrder is 0. An item cannot be moved
+	// under itself or its sub-tasks.
+	Reparent(ctx context.Context, id string, parentId string, newOrder int) error
+
+	// AddBlocker makes an item wait for blockerId, another item of the
+	// principal in any list, unless it already does. Blockers that would make
+	// items wait for each other, however indirectly, are rejected.
+	AddBlocker(ctx context.Context, id string, blockerId string) error
+	// RemoveBlocker stops an item waiting for blockerId, if it does.
+	RemoveBlocker(ctx context.Context, id string, blockerId string) error
+	// SortByBlockers reorders each set of siblings of a list so that no item
+	// comes before an item it waits for, directly or through other items.
+	// Otherwise the items keep the order they had as far as they can.
+	SortByBlockers(ctx context.Context, listId string) error
+
+	// AddAttachment attaches a file to an item, and sets the id and creation
+	// time of the attachment. Attachments are not part of the item and leave
+	// its version alone. They go to the trash with their item, and are only
+	// removed for good along with it.
+	AddAttachment(ctx context.Context, attachment *structs.Attachment) error
+	// ListAttachments returns the attachments of an item, oldest first.
+	ListAttachments(ctx context.Context, itemId string, attachments *structs.Attachments) error
+	GetAttachment(ctx context.Context, itemId string, id string, attachment *structs.Attachment) error
+	DeleteAttachment(ctx context.Context, itemId string, id string) error
+	// AttachmentsSize is the total size of the attachments of the principal,
+	// those of the items in the trash included.
+	AttachmentsSize(ctx context.Context) (int64, error)
+	// AttachmentDigests returns the digests of the attachments of every user.
+	// The content stored under any other digest is no longer used.
+	AttachmentDigests(ctx context.Context) (map[string]bool, error)
+
+	// AddList inserts a list at list.Order, the same way Add does for items.
+	AddList(ctx context.Context, list *structs.List) error
+	// DeleteList removes a list along with its items, and returns the lists
+	// that moved up in shifted. The default list cannot be deleted.
+	DeleteList(ctx context.Context, id string, shifted *structs.Lists) error
+	// UpdateList renames a list, and moves it when list.Order is set.
+	UpdateList(ctx context.Context, list *structs.List) error
+	GetList(ctx context.Context, id string, list *structs.List) error
+	ListLists(ctx context.Context, lists *structs.Lists) error
+	ReorderList(ctx context.Context, id string, newOrder int) error
+}
+
+// utcSeconds is how due dates are stored: in UTC, to the second.
+func utcSeconds(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	utc := t.UTC().Truncate(time.Second)
+	return &utc
+}
+
+// writeTime is the time of a write, to the precision both databases keep.
+func writeTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
 }
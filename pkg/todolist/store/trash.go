@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// PurgeTrashEvery purges the items that have been in the trash for longer
+// than retention from s, right away and then every interval until ctx is
+// done. Failures are logged, the next round tries again.
+func PurgeTrashEvery(ctx context.Context, s Store, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purgeTrash(ctx, s, retention)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeTrash(ctx context.Context, s Store, retention time.Duration) {
+	var purged int
+	err := s.Update(func(tx Txn) error {
+		var err error
+		purged, err = tx.PurgeTrash(ctx, time.Now().Add(-retention))
+		return err
+	})
+	if err != nil {
+		log.Warn().Err(err).Msg("Trash purge failed")
+		return
+	}
+	if purged > 0 {
+		log.Debug().Msg(fmt.Sprintf("Purged %d items from the trash", purged))
+	}
+}
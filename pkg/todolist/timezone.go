@@ -0,0 +1,54 @@
+package todolist
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.altair.com/todolist/pkg/structs"
+)
+
+// TimeZoneHeader names the zone the times of a response are rendered in, when
+// the tz query parameter does not.
+const TimeZoneHeader = "Time-Zone"
+
+type locationKey struct{}
+
+// timeZone resolves the zone the times of the response are rendered in, UTC
+// unless the request names another one. Unknown zones are rejected.
+func timeZone(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("tz")
+		if name == "" {
+			name = r.Header.Get(TimeZoneHeader)
+		}
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := structs.ValidateVar(name, "iana_timezone"); err != nil {
+			http.Error(w, "Unknown time zone "+strconv.Quote(name), http.StatusBadRequest)
+			return
+		}
+		loc, _ := time.LoadLocation(name)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), locationKey{}, loc)))
+	})
+}
+
+// location is the zone the times of the response to r are rendered in.
+func location(r *http.Request) *time.Location {
+	if loc, ok := r.Context().Value(locationKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+// recurIn works the recurrence of item out in the zone of r, unless the item
+// names a zone of its own.
+func recurIn(r *http.Request, item *structs.TodoItem) {
+	if item.Recurrence != "" && item.TimeZone == "" {
+		item.TimeZone = location(r).String()
+	}
+}